@@ -0,0 +1,262 @@
+package main
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+
+	"encr.dev/compiler"
+	"encr.dev/pkg/configdiff"
+	"encr.dev/pkg/cueutil"
+)
+
+func init() {
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Config management commands",
+	}
+	rootCmd.AddCommand(configCmd)
+
+	var jsonOutput bool
+	configDiffCmd := &cobra.Command{
+		Use:   "diff <from> <to> [--json]",
+		Short: "Compares the resolved config of each service between two environments or revisions",
+		Long: `Evaluates the config of each service for two environments, optionally at
+different git revisions of the app, and prints the values which differ.
+
+Each environment is given as [<name>=]<type>[@<revision>], where the type is one of:
+  local:       local development, as run by 'encore run'
+  test:        tests, as run by 'encore test'
+  development: a development environment in the cloud
+  ephemeral:   a preview environment in the cloud
+  production:  a production environment in the cloud
+
+The name is given to the config as #Meta.Environment.Name, and defaults to the type.
+Without a revision the config is evaluated from the working tree of the app.
+
+Examples:
+  encore config diff development production
+  encore config diff production@main production
+  encore config diff staging=development@v1.2.0 staging=development@v1.3.0`,
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			appRoot, _ := determineAppRoot()
+			from, err := evalConfigSpec(appRoot, args[0])
+			if err != nil {
+				fatal(err)
+			}
+			to, err := evalConfigSpec(appRoot, args[1])
+			if err != nil {
+				fatal(err)
+			}
+
+			diff, err := configdiff.Diff(from, to)
+			if err != nil {
+				fatal(err)
+			}
+			if jsonOutput {
+				if diff == nil {
+					diff = []configdiff.Service{}
+				}
+				out, err := json.MarshalIndent(diff, "", "  ")
+				if err != nil {
+					fatal(err)
+				}
+				fmt.Println(string(out))
+				return
+			}
+			printConfigDiff(diff)
+		},
+	}
+
+	configCmd.AddCommand(configDiffCmd)
+	configDiffCmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the differences as JSON")
+
+	configScaffoldCmd := &cobra.Command{
+		Use:   "scaffold",
+		Short: "Creates skeleton config files for the local, development and production environments",
+		Long: `Writes a local.cue, development.cue and production.cue file for each service which
+loads config, stubbing out the fields which must be given for each environment.
+
+Config is only scaffolded for apps without any config files of their own, and only
+once for each service, so files which have since been deleted are not recreated.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			appRoot, _ := determineAppRoot()
+			written, err := compiler.ScaffoldConfig(appRoot)
+			if err != nil {
+				fatal(err)
+			}
+			if len(written) == 0 {
+				fmt.Println("No config was scaffolded, as the app already has config files or its services have been scaffolded before.")
+				return
+			}
+
+			names := maps.Keys(written)
+			slices.Sort(names)
+			for _, name := range names {
+				fmt.Printf("%s: created %s\n", color.New(color.Bold).Sprint(name), strings.Join(written[name], ", "))
+			}
+		},
+	}
+	configCmd.AddCommand(configScaffoldCmd)
+}
+
+// configEnvTypes are the types of environments config can be evaluated for, by the name they're given on the command line
+var configEnvTypes = map[string]*cueutil.Meta{
+	"local":       {EnvType: cueutil.EnvType_Development, CloudType: cueutil.CloudType_Local},
+	"test":        {EnvType: cueutil.EnvType_Test, CloudType: cueutil.CloudType_Local},
+	"development": {EnvType: cueutil.EnvType_Development, CloudType: cueutil.CloudType_Encore},
+	"ephemeral":   {EnvType: cueutil.EnvType_Ephemeral, CloudType: cueutil.CloudType_Encore},
+	"production":  {EnvType: cueutil.EnvType_Production, CloudType: cueutil.CloudType_Encore},
+}
+
+// evalConfigSpec evaluates the config of each service for the environment described by spec,
+// in the form [<name>=]<type>[@<revision>], checking out the revision of the app if one is given.
+func evalConfigSpec(appRoot, spec string) (map[string]string, error) {
+	envSpec, revision := spec, ""
+	if idx := strings.Index(spec, "@"); idx >= 0 {
+		envSpec, revision = spec[:idx], spec[idx+1:]
+		if revision == "" {
+			return nil, fmt.Errorf("invalid environment %q: missing revision after '@'", spec)
+		}
+	}
+	name, typ := envSpec, envSpec
+	if idx := strings.Index(envSpec, "="); idx >= 0 {
+		name, typ = envSpec[:idx], envSpec[idx+1:]
+	}
+	envType, ok := configEnvTypes[typ]
+	if !ok {
+		return nil, fmt.Errorf("invalid environment %q: unknown environment type %q", spec, typ)
+	} else if name == "" {
+		return nil, fmt.Errorf("invalid environment %q: missing environment name before '='", spec)
+	}
+
+	meta := &cueutil.Meta{
+		// The base URL of the API isn't known, so it's given a placeholder
+		APIBaseURL: "http://localhost:4000",
+		EnvName:    name,
+		EnvType:    envType.EnvType,
+		CloudType:  envType.CloudType,
+	}
+
+	if revision == "" {
+		return compiler.EvalConfig(appRoot, meta)
+	}
+	dir, err := os.MkdirTemp("", "encore-config-")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	if err := extractRevision(appRoot, revision, dir); err != nil {
+		return nil, err
+	}
+	configs, err := compiler.EvalConfig(dir, meta)
+	if err != nil {
+		return nil, fmt.Errorf("revision %s: %w", revision, err)
+	}
+	return configs, nil
+}
+
+// extractRevision writes the app as of the given git revision into dst
+func extractRevision(appRoot, revision, dst string) error {
+	// Run from the app root, git archive only includes the files of the app
+	// if it's within a subdirectory of the repository, relative to the app root
+	var stderr strings.Builder
+	cmd := exec.Command("git", "archive", "--format=tar", revision)
+	cmd.Dir = appRoot
+	cmd.Stderr = &stderr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("unable to run git: %w", err)
+	}
+
+	extractErr := extractTar(out, dst)
+	_, _ = io.Copy(io.Discard, out)
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("unable to get revision %s of the app: %s", revision, strings.TrimSpace(stderr.String()))
+	}
+	return extractErr
+}
+
+// extractTar extracts the regular files and directories within the tar archive into dst
+func extractTar(r io.Reader, dst string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		path := filepath.Join(dst, filepath.FromSlash(hdr.Name))
+		if !strings.HasPrefix(path, filepath.Clean(dst)+string(filepath.Separator)) {
+			return fmt.Errorf("invalid path in archive: %s", hdr.Name)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// printConfigDiff prints the changes to the config of each service
+func printConfigDiff(diff []configdiff.Service) {
+	if len(diff) == 0 {
+		fmt.Println("The config of every service is the same.")
+		return
+	}
+
+	for i, svc := range diff {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s:\n", color.New(color.Bold).Sprint(svc.Name))
+		for _, change := range svc.Changes {
+			path := change.Path
+			if path == "" {
+				path = "(entire config)"
+			}
+			switch {
+			case change.From == nil:
+				fmt.Println(color.GreenString("  + %s: %s", path, change.To))
+			case change.To == nil:
+				fmt.Println(color.RedString("  - %s: %s", path, change.From))
+			default:
+				fmt.Println(color.YellowString("  ~ %s: %s -> %s", path, change.From, change.To))
+			}
+		}
+	}
+}
@@ -4,11 +4,14 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
 	"time"
 
 	"github.com/spf13/cobra"
 
 	"encr.dev/cli/cmd/encore/cmdutil"
+	"encr.dev/compiler"
 	"encr.dev/internal/clientgen"
 	daemonpb "encr.dev/proto/encore/daemon"
 )
@@ -114,8 +117,54 @@ which may require the user-facing wrapper code to be manually generated.`,
 		},
 	}
 
+	var docsDir string
+	genConfigDocsCmd := &cobra.Command{
+		Use:   "config-docs [--output=dir]",
+		Short: "Generates markdown documentation for the config of your services",
+		Long: `Generates a markdown reference of the config of each service which loads config,
+listing each field with its type, default and documentation.
+
+By default the documentation of every service is written to stdout. If an
+output directory is given, it's written to a <service>.md file within it instead.`,
+		Args: cobra.ExactArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			appRoot, _ := determineAppRoot()
+			docs, err := compiler.GenConfigDocs(appRoot)
+			if err != nil {
+				fatal(err)
+			}
+
+			svcs := make([]string, 0, len(docs))
+			for svc := range docs {
+				svcs = append(svcs, svc)
+			}
+			sort.Strings(svcs)
+
+			if docsDir == "" {
+				for i, svc := range svcs {
+					if i > 0 {
+						fmt.Println()
+					}
+					os.Stdout.Write(docs[svc])
+				}
+				return
+			}
+
+			if err := os.MkdirAll(docsDir, 0755); err != nil {
+				fatal(err)
+			}
+			for _, svc := range svcs {
+				if err := os.WriteFile(filepath.Join(docsDir, svc+".md"), docs[svc], 0644); err != nil {
+					fatal(err)
+				}
+			}
+			fmt.Printf("successfully generated config documentation for %d services.\n", len(svcs))
+		},
+	}
+
 	genCmd.AddCommand(genClientCmd)
 	genCmd.AddCommand(genWrappersCmd)
+	genCmd.AddCommand(genConfigDocsCmd)
 
 	genClientCmd.Flags().StringVarP(&lang, "lang", "l", "", "The language to generate code for (\"typescript\", \"javascript\", and \"go\" are supported)")
 	_ = genClientCmd.RegisterFlagCompletionFunc("lang", cmdutil.AutoCompleteFromStaticList(
@@ -129,4 +178,7 @@ which may require the user-facing wrapper code to be manually generated.`,
 
 	genClientCmd.Flags().StringVarP(&envName, "env", "e", "", "The environment to fetch the API for (defaults to the primary environment)")
 	_ = genClientCmd.RegisterFlagCompletionFunc("env", cmdutil.AutoCompleteEnvSlug)
+
+	genConfigDocsCmd.Flags().StringVarP(&docsDir, "output", "o", "", "The directory to write the documentation of each service to")
+	_ = genConfigDocsCmd.MarkFlagDirname("output")
 }
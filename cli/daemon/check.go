@@ -8,7 +8,17 @@ import (
 func (s *Server) Check(req *daemonpb.CheckRequest, stream daemonpb.Daemon_CheckServer) error {
 	slog := &streamLog{stream: stream, buffered: false}
 	log := newStreamLogger(slog)
-	buildDir, err := s.mgr.Check(stream.Context(), req.AppRoot, req.WorkingDir, req.CodegenDebug)
+	app, err := s.apps.Track(req.AppRoot)
+	if err != nil {
+		log.Error().Msgf("failed to resolve app: %v", err)
+		streamExit(stream, 1)
+		return nil
+	}
+
+	buildDir, warnings, err := s.mgr.Check(stream.Context(), app, req.WorkingDir, req.CodegenDebug)
+	for _, warning := range warnings {
+		log.Warn().Msg(warning)
+	}
 
 	exitCode := 0
 	if err != nil {
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 
+	"encr.dev/cli/daemon/apps"
 	"encr.dev/compiler"
 	"encr.dev/internal/env"
 	"encr.dev/internal/version"
@@ -15,17 +16,40 @@ import (
 )
 
 // Check checks the app for errors.
-// It reports a buildDir (if available) when codegenDebug is true.
-func (mgr *Manager) Check(ctx context.Context, appRoot, relwd string, codegenDebug bool) (buildDir string, err error) {
+// It reports a buildDir (if available) when codegenDebug is true,
+// and any warnings about the app which don't fail the check.
+func (mgr *Manager) Check(ctx context.Context, app *apps.Instance, relwd string, codegenDebug bool) (buildDir string, warnings []string, err error) {
+	appRoot := app.Root()
 	vcsRevision := vcs.GetRevision(appRoot)
 
 	exp, err := appfile.Experiments(appRoot)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 	expSet, err := experiments.NewSet(exp, nil)
 	if err != nil {
-		return "", err
+		return "", nil, err
+	}
+
+	parse, err := mgr.parseApp(parseAppParams{
+		App:        app,
+		WorkingDir: relwd,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Fields of the config tagged as sensitive are given the values of the app's secrets,
+	// so the config is only complete once they're fetched
+	var secrets map[string]string
+	if uses, err := compiler.ConfigUsesSecrets(appRoot, parse); err != nil {
+		return "", nil, err
+	} else if uses {
+		data, err := mgr.Secret.Load(app).Get(ctx, expSet)
+		if err != nil {
+			return "", nil, fmt.Errorf("unable to fetch the secrets given to the config: %v", err)
+		}
+		secrets = data.Values
 	}
 
 	// TODO: We should check that all secret keys are defined as well.
@@ -41,20 +65,53 @@ func (mgr *Manager) Check(ctx context.Context, appRoot, relwd string, codegenDeb
 		BuildTags:             []string{"encore_local", "encore_no_gcp", "encore_no_aws", "encore_no_azure"},
 		Experiments:           expSet,
 		Meta: &cueutil.Meta{
-			// Dummy data to satisfy config validation.
+			// The config is checked as it's computed by `encore run`, with a dummy base URL
 			APIBaseURL: "http://localhost:0",
-			EnvName:    "encore-check",
+			EnvName:    "local",
 			EnvType:    cueutil.EnvType_Development,
 			CloudType:  cueutil.CloudType_Local,
+			Secrets:    secrets,
 		},
+		Parse: parse,
 	}
+	cfg.ValidateConfigFor = configValidationEnvs(cfg.Meta)
 	result, err := compiler.Build(appRoot, cfg)
-	if result != nil && result.Dir != "" {
-		if codegenDebug {
-			buildDir = result.Dir
-		} else {
-			os.RemoveAll(result.Dir)
+	if result != nil {
+		warnings = result.ConfigWarnings
+		if result.Dir != "" {
+			if codegenDebug {
+				buildDir = result.Dir
+			} else {
+				os.RemoveAll(result.Dir)
+			}
+		}
+	}
+	return buildDir, warnings, err
+}
+
+// configValidationEnvs returns the kinds of environments the config of the app is validated in,
+// other than the environment described by current. This catches invalid config for environments
+// other than the one being built, which would otherwise only be found when the app starts there.
+//
+// The environments aren't given names, so config specific to a named environment (i.e. within
+// `if #Meta.Environment.Name == "prod"`) is left incomplete. The config is only checked for
+// values which conflict with its schema, rather than required to be complete.
+func configValidationEnvs(current *cueutil.Meta) []*cueutil.Meta {
+	envs := []*cueutil.Meta{
+		{EnvType: cueutil.EnvType_Development, CloudType: cueutil.CloudType_Local},
+		{EnvType: cueutil.EnvType_Test, CloudType: cueutil.CloudType_Local},
+		{EnvType: cueutil.EnvType_Development, CloudType: cueutil.CloudType_Encore},
+		{EnvType: cueutil.EnvType_Ephemeral, CloudType: cueutil.CloudType_Encore},
+		{EnvType: cueutil.EnvType_Production, CloudType: cueutil.CloudType_Encore},
+	}
+
+	var rtn []*cueutil.Meta
+	for _, env := range envs {
+		if env.EnvType == current.EnvType && env.CloudType == current.CloudType {
+			continue
 		}
+		env.APIBaseURL = "http://localhost:0"
+		rtn = append(rtn, env)
 	}
-	return buildDir, err
+	return rtn
 }
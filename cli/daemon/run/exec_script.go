@@ -114,6 +114,7 @@ func (mgr *Manager) ExecScript(ctx context.Context, p ExecScriptParams) (err err
 				EnvName:    "local",
 				EnvType:    cueutil.EnvType_Development,
 				CloudType:  cueutil.CloudType_Local,
+				Env:        environMap(append(os.Environ(), p.Environ...)),
 			},
 			ExecScript: &compiler.ExecScriptConfig{
 				ScriptMainPkg: p.ScriptRelPath,
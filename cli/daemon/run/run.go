@@ -269,8 +269,41 @@ func (r *Run) buildAndStart(ctx context.Context, tracker *optracker.OpTracker) e
 		return err
 	}
 
+	// The config of the services may be given secrets, so they're fetched before it's computed
+	appSecrets := usesSecrets(parse.Meta)
+	configSecrets, err := compiler.ConfigUsesSecrets(r.App.Root(), parse)
+	if err != nil {
+		return err
+	}
+	var secrets map[string]string
+	secretsFetched := make(chan struct{})
+	if appSecrets || configSecrets {
+		jobs.Go("Fetching application secrets", true, 150*time.Millisecond, func(ctx context.Context) error {
+			defer close(secretsFetched)
+			data, err := r.secrets.Get(ctx, expSet)
+			if err != nil && !appSecrets && ctx.Err() == nil {
+				// Only the config is given secrets, so it's left without their values (and is reported
+				// as incomplete if they're required) rather than failing runs of the app offline
+				log.Warn().Err(err).Str("app_id", r.App.PlatformOrLocalID()).Msg("unable to fetch the secrets given to the config")
+				return nil
+			} else if err != nil {
+				return err
+			}
+			secrets = data.Values
+			return nil
+		})
+	} else {
+		close(secretsFetched)
+	}
+
 	var build *compiler.Result
 	jobs.Go("Compiling application source code", false, 0, func(ctx context.Context) (err error) {
+		select {
+		case <-secretsFetched:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
 		//goland:noinspection HttpUrlsUsage
 		cfg := &compiler.Config{
 			Revision:              parse.Meta.AppRevision,
@@ -286,6 +319,8 @@ func (r *Run) buildAndStart(ctx context.Context, tracker *optracker.OpTracker) e
 				EnvName:    "local",
 				EnvType:    cueutil.EnvType_Development,
 				CloudType:  cueutil.CloudType_Local,
+				Secrets:    secrets,
+				Env:        environMap(r.params.Environ),
 			},
 			Parse:     parse,
 			BuildTags: []string{"encore_local", "encore_no_gcp", "encore_no_aws", "encore_no_azure"},
@@ -304,18 +339,6 @@ func (r *Run) buildAndStart(ctx context.Context, tracker *optracker.OpTracker) e
 		}
 	}()
 
-	var secrets map[string]string
-	if usesSecrets(parse.Meta) {
-		jobs.Go("Fetching application secrets", true, 150*time.Millisecond, func(ctx context.Context) error {
-			data, err := r.secrets.Get(ctx, expSet)
-			if err != nil {
-				return err
-			}
-			secrets = data.Values
-			return nil
-		})
-	}
-
 	if err := jobs.Wait(); err != nil {
 		return err
 	}
@@ -686,6 +709,18 @@ func encodeSecretsEnv(secrets map[string]string) string {
 	return buf.String()
 }
 
+// environMap converts environment variables in the format of os.Environ() to a map.
+// Later variables override earlier ones of the same name, as they do for a process.
+func environMap(environ []string) map[string]string {
+	env := make(map[string]string, len(environ))
+	for _, e := range environ {
+		if name, value, ok := strings.Cut(e, "="); ok {
+			env[name] = value
+		}
+	}
+	return env
+}
+
 func usesSecrets(md *meta.Data) bool {
 	for _, pkg := range md.Pkgs {
 		if len(pkg.Secrets) > 0 {
@@ -132,6 +132,8 @@ func (mgr *Manager) Test(ctx context.Context, params TestParams) (err error) {
 			EnvName:    "local",
 			EnvType:    cueutil.EnvType_Test,
 			CloudType:  cueutil.CloudType_Local,
+			Secrets:    secrets,
+			Env:        environMap(params.Environ),
 		},
 		Test: &compiler.TestConfig{
 			Env: append(params.Environ,
@@ -143,5 +145,6 @@ func (mgr *Manager) Test(ctx context.Context, params TestParams) (err error) {
 			Stderr: params.Stderr,
 		},
 	}
+	cfg.ValidateConfigFor = configValidationEnvs(cfg.Meta)
 	return compiler.Test(ctx, params.App.Root(), cfg)
 }
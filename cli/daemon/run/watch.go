@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"encr.dev/cli/daemon/apps"
+	"encr.dev/pkg/cueutil"
 	"encr.dev/pkg/errlist"
 	"encr.dev/pkg/watcher"
 )
@@ -68,6 +69,6 @@ func ignoreEvent(ev watcher.Event) bool {
 	case ".go", ".sql", ".mod", ".sum", ".work", ".app", ".cue":
 		return false
 	default:
-		return true
+		return !cueutil.IsConfigDataFile(ev.Path)
 	}
 }
@@ -66,7 +66,7 @@ func (s *Server) updateGitIgnore(i *apps.Instance) error {
 	}
 
 	// Find which directives are already present
-	directives := []string{"encore.gen.go", "encore.gen.cue", "/.encore"}
+	directives := []string{"encore.gen.go", "encore.gen.cue", "encore.gen.schema.json", "/.encore"}
 	found := make([]bool, len(directives))
 	scanner := bufio.NewScanner(bytes.NewReader(data))
 	for scanner.Scan() {
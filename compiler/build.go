@@ -24,6 +24,7 @@ import (
 	"encr.dev/internal/optracker"
 	"encr.dev/parser"
 	"encr.dev/parser/est"
+	"encr.dev/pkg/appfile"
 	"encr.dev/pkg/cueutil"
 	"encr.dev/pkg/errinsrc"
 	"encr.dev/pkg/errinsrc/srcerrors"
@@ -84,6 +85,11 @@ type Config struct {
 	// application
 	Meta *cueutil.Meta
 
+	// ValidateConfigFor are additional environments the config of each service is validated in,
+	// so invalid config is reported before it's deployed to them. Unlike Meta, the configs
+	// computed for these environments are discarded.
+	ValidateConfigFor []*cueutil.Meta
+
 	// If Parse is set, the build will skip parsing the app again
 	// and use the information provided.
 	Parse *parser.Result
@@ -118,6 +124,10 @@ type Result struct {
 	Parse       *parser.Result    // set only if build succeeded
 	ConfigFiles fs.FS             // all found configuration files within the application source
 	Configs     map[string]string // each services runtime config as defined
+
+	// ConfigWarnings are the warnings about the config of the services, such as
+	// deprecated fields which are still set, in the order they were found
+	ConfigWarnings []string
 }
 
 // Build builds the application.
@@ -156,10 +166,17 @@ type builder struct {
 	cuegen  *cuegen.Generator
 	bundled *serviceBundle
 
+	appConfig *appfile.Config // how the config of each service is generated, as set in encore.app
+
 	res         *parser.Result
 	configFiles fs.FS
 	configs     map[string]string // Configs by service name -> config JSON
 
+	scaffolded map[string]string // the config files scaffolded for each service, by service name
+
+	configWarnings []string        // warnings about the config of the services
+	seenWarnings   map[string]bool // the warnings already in configWarnings
+
 	appCheckOpID optracker.OperationID
 	codegenOpID  optracker.OperationID
 	lastOpID     optracker.OperationID
@@ -225,6 +242,7 @@ func (b *builder) Build() (res *Result, err error) {
 	res.Parse = b.res
 	res.ConfigFiles = b.configFiles
 	res.Configs = b.configs
+	res.ConfigWarnings = b.configWarnings
 	return res, nil
 }
 
@@ -263,10 +281,29 @@ func (b *builder) parseApp() error {
 		return err
 	}
 
+	f, err := appfile.ParseFile(filepath.Join(b.appRoot, appfile.Name))
+	if err != nil {
+		return err
+	}
+	b.appConfig = f.Config
+	if b.appConfig == nil {
+		b.appConfig = &appfile.Config{}
+	}
+	cuegenOpts := &cuegen.Options{
+		DefineNamedTypes: b.appConfig.DefineNamedTypes,
+		ServiceMetadata:  b.cueServiceMetadata,
+	}
+	if b.appConfig.SharedDefinitions {
+		cuegenOpts.SharedPackage = sharedCuePackage
+	}
+	if b.appConfig.NullablePointers {
+		cuegenOpts.NullablePointers = cuegen.NullDefault
+	}
+
 	if pc := b.cfg.Parse; pc != nil {
 		b.res = pc
 		b.codegen = codegen.NewBuilder(b.res)
-		b.cuegen = cuegen.NewGenerator(b.res)
+		b.cuegen = cuegen.NewGenerator(b.res, cuegenOpts)
 		b.bundled = newServiceBundle(b.res.App.Services)
 		return nil
 	}
@@ -284,7 +321,7 @@ func (b *builder) parseApp() error {
 
 	if err == nil {
 		b.codegen = codegen.NewBuilder(b.res)
-		b.cuegen = cuegen.NewGenerator(b.res)
+		b.cuegen = cuegen.NewGenerator(b.res, cuegenOpts)
 		b.bundled = newServiceBundle(b.res.App.Services)
 	}
 
@@ -316,16 +353,13 @@ func (b *builder) checkApp() error {
 					serviceConfigsChecked[res.Svc] = struct{}{}
 
 					if err := b.computeConfigForService(res.Svc); err != nil {
-						if list := errlist.Convert(err); list != nil {
-							err = list
-
-							errinsrc.AddHintFromGo(err, b.res.FileSet, res.FuncCall, "config loaded from here")
-						} else {
-							err = srcerrors.UnknownErrorCompilingConfig(
-								b.res.FileSet, res.FuncCall, err,
-							)
+						panic(bailout{b.configError(res, err, "config loaded from here")})
+					}
+					for _, meta := range b.cfg.ValidateConfigFor {
+						if err := b.validateConfigForService(res.Svc, meta); err != nil {
+							hint := fmt.Sprintf("config loaded from here, which is invalid in %s environments", describeEnv(meta))
+							panic(bailout{b.configError(res, err, hint)})
 						}
-						panic(bailout{err})
 					}
 				}
 			}
@@ -335,6 +369,16 @@ func (b *builder) checkApp() error {
 	return nil
 }
 
+// configError converts an error computing the config loaded by res into an error
+// pointing at where the config is loaded, with the given hint.
+func (b *builder) configError(res *est.Config, err error, hint string) error {
+	if list := errlist.Convert(err); list != nil {
+		errinsrc.AddHintFromGo(list, b.res.FileSet, res.FuncCall, hint)
+		return list
+	}
+	return srcerrors.UnknownErrorCompilingConfig(b.res.FileSet, res.FuncCall, err)
+}
+
 func (b *builder) writeModFile() error {
 	defer b.trace("write mod file")()
 	newPath := b.cfg.EncoreRuntimePath
@@ -407,7 +451,7 @@ func (b *builder) writePackages() error {
 		}
 	}
 
-	return nil
+	return b.generateSharedCueFile(b.workdir)
 }
 
 func (b *builder) buildMain() error {
@@ -1,13 +1,18 @@
 package compiler
 
 import (
+	"bytes"
+	"fmt"
 	"io/fs"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"encr.dev/parser"
 	"encr.dev/parser/est"
 	"encr.dev/pkg/cueutil"
 	"encr.dev/pkg/eerror"
+	"encr.dev/pkg/errinsrc/srcerrors"
 	"encr.dev/pkg/vfs"
 )
 
@@ -23,6 +28,11 @@ func (b *builder) pickupConfigFiles() error {
 			return true
 		}
 
+		// any config given as YAML or JSON, rather than CUE
+		if cueutil.IsConfigDataFile(path) {
+			return true
+		}
+
 		// Pickup any files within a CUE module folder (either at the root of the app or in a subfolder)
 		if strings.Contains(path, "/cue.mod/") || strings.HasPrefix(path, "cue.mod/") {
 			return true
@@ -37,12 +47,128 @@ func (b *builder) pickupConfigFiles() error {
 	return nil
 }
 
+// EvalConfig computes the config of each service of the app which loads config, in the environment
+// described by meta, as the JSON given to the service at runtime, keyed by the name of the service.
+//
+// The CUE files Encore generates for the services are regenerated in memory rather than read from
+// disk, so the config reflects the current config types even if the app hasn't been built since.
+func EvalConfig(appRoot string, meta *cueutil.Meta) (configs map[string]string, err error) {
+	b := &builder{
+		cfg:     &Config{Meta: meta},
+		appRoot: appRoot,
+		configs: make(map[string]string),
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			if b, ok := e.(bailout); ok {
+				err = b.err
+			} else {
+				err = srcerrors.UnhandledPanic(e)
+			}
+		}
+	}()
+
+	if err := b.parseApp(); err != nil {
+		return nil, err
+	}
+	if err := b.pickupConfigFiles(); err != nil {
+		return nil, err
+	}
+	if err := b.regenerateConfigFiles(); err != nil {
+		return nil, err
+	}
+	for _, svc := range b.res.App.Services {
+		if len(svc.ConfigLoads) == 0 {
+			continue
+		}
+		if err := b.computeConfigForService(svc); err != nil {
+			return nil, err
+		}
+	}
+	return b.configs, nil
+}
+
+// ConfigUsesSecrets reports whether the config of any service of the parsed app is given the values
+// of the app's secrets, through fields tagged as sensitive, so the secrets must be fetched before its
+// config can be computed.
+func ConfigUsesSecrets(appRoot string, res *parser.Result) (uses bool, err error) {
+	b := &builder{
+		cfg:     &Config{Parse: res},
+		appRoot: appRoot,
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			if b, ok := e.(bailout); ok {
+				err = b.err
+			} else {
+				err = srcerrors.UnhandledPanic(e)
+			}
+		}
+	}()
+
+	if err := b.parseApp(); err != nil {
+		return false, err
+	}
+	secretTag := []byte("@tag(" + cueutil.SecretTagPrefix)
+	for _, svc := range b.res.App.Services {
+		f, err := b.cuegen.UserFacing(svc)
+		if err != nil {
+			return false, err
+		} else if bytes.Contains(f, secretTag) {
+			return true, nil
+		}
+	}
+	shared, err := b.cuegen.SharedDefinitions()
+	if err != nil {
+		return false, err
+	}
+	return bytes.Contains(shared, secretTag), nil
+}
+
+// regenerateConfigFiles replaces the generated CUE files within the picked up config files with
+// newly generated ones, keeping the user section of the files they replace
+func (b *builder) regenerateConfigFiles() error {
+	files, ok := b.configFiles.(*vfs.VFS)
+	if !ok {
+		return nil
+	}
+
+	for _, svc := range b.res.App.Services {
+		f, err := b.cuegen.UserFacing(svc)
+		if err != nil {
+			return err
+		} else if len(f) == 0 {
+			continue
+		}
+
+		path := filepath.Join(svc.Root.RelPath, "encore.gen.cue")
+		if previous, err := files.ReadFile(filepath.ToSlash(path)); err == nil {
+			f = b.cuegen.PreserveUserSection(f, previous)
+		}
+		if _, err := files.AddFile(path, f, time.Now()); err != nil {
+			return err
+		}
+	}
+
+	shared, err := b.cuegen.SharedDefinitions()
+	if err != nil {
+		return err
+	} else if len(shared) > 0 {
+		path := filepath.Join("cue.mod", "gen", filepath.FromSlash(sharedCuePackage), "encore.gen.cue")
+		if _, err := files.AddFile(path, shared, time.Now()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // computeConfigForService takes a given service and computes the configuration needed for it
 func (b *builder) computeConfigForService(service *est.Service) error {
-	cfg, err := cueutil.LoadFromFS(b.configFiles, service.Root.RelPath, b.cfg.Meta)
+	cfg, deprecated, err := cueutil.LoadFromFSWithDeprecations(b.configFiles, service.Root.RelPath, b.cfg.Meta)
 	if err != nil {
 		return err
 	}
+	b.warnDeprecatedConfig(service, deprecated)
 
 	bytes, err := cfg.MarshalJSON()
 	if err != nil {
@@ -52,3 +178,39 @@ func (b *builder) computeConfigForService(service *est.Service) error {
 
 	return nil
 }
+
+// validateConfigForService checks the configuration of the given service doesn't conflict with its
+// schema in the environment described by meta. Values which depend on what meta leaves unset, such as
+// the name of the environment, may be incomplete.
+func (b *builder) validateConfigForService(service *est.Service, meta *cueutil.Meta) error {
+	deprecated, err := cueutil.ValidateFromFS(b.configFiles, service.Root.RelPath, meta)
+	if err != nil {
+		return err
+	}
+	b.warnDeprecatedConfig(service, deprecated)
+	return nil
+}
+
+// warnDeprecatedConfig adds a warning for each deprecated field still set by the config of the service.
+// Fields set for more than one environment are only warned about once.
+func (b *builder) warnDeprecatedConfig(service *est.Service, deprecated []cueutil.DeprecatedField) {
+	for _, field := range deprecated {
+		warning := fmt.Sprintf("service %s: %s", service.Name, field)
+		if b.seenWarnings[warning] {
+			continue
+		}
+		if b.seenWarnings == nil {
+			b.seenWarnings = make(map[string]bool)
+		}
+		b.seenWarnings[warning] = true
+		b.configWarnings = append(b.configWarnings, warning)
+	}
+}
+
+// describeEnv describes the kind of environment meta is for (i.e. "local development")
+func describeEnv(meta *cueutil.Meta) string {
+	if meta.CloudType == cueutil.CloudType_Local {
+		return "local " + string(meta.EnvType)
+	}
+	return string(meta.EnvType)
+}
@@ -0,0 +1,191 @@
+package compiler
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/rogpeppe/go-internal/txtar"
+
+	"encr.dev/pkg/cueutil"
+)
+
+const nullablePointersApp = `
+-- encore.app --
+{"id": "test", "config": {"nullable_pointers": true}}
+-- go.mod --
+module encore.app
+
+require encore.dev v1.1.0
+-- svc/types.go --
+package svc
+
+type Limits struct {
+	MaxConns int
+}
+
+type Config struct {
+	Name     string
+	Nickname *string
+	Limits   *Limits
+	Replicas *int ` + "`default:\"3\"`" + `
+}
+-- svc/svc.go --
+package svc
+
+import (
+	"context"
+
+	"encore.dev/config"
+)
+
+var cfg = config.Load[*Config]()
+
+//encore:api
+func Get(ctx context.Context) error { return nil }
+-- svc/config.cue --
+Name: "primary"
+-- svc/unmarshal_test.go --
+package svc
+
+import (
+	"os"
+	"testing"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+func TestUnmarshal(t *testing.T) {
+	itr := jsoniter.ParseString(jsoniter.ConfigDefault, os.Getenv("SVC_CONFIG"))
+	cfg := encoreInternalConfigUnmarshaler_ptr_Config(itr, nil)
+	if itr.Error != nil {
+		t.Fatal(itr.Error)
+	}
+	if cfg.Name != "primary" {
+		t.Errorf("got Name %q, want %q", cfg.Name, "primary")
+	}
+	if cfg.Nickname != nil {
+		t.Errorf("got Nickname %q, want nil", *cfg.Nickname)
+	}
+	if cfg.Limits != nil {
+		t.Errorf("got Limits %+v, want nil", *cfg.Limits)
+	}
+	if cfg.Replicas == nil || *cfg.Replicas != 3 {
+		t.Errorf("got Replicas %v, want 3", cfg.Replicas)
+	}
+}
+`
+
+func TestNullablePointers(t *testing.T) {
+	c := qt.New(t)
+	appRoot := c.TempDir()
+	c.Assert(txtar.Write(txtar.Parse([]byte(nullablePointersApp)), appRoot), qt.IsNil)
+
+	// Pointers left out of the config are null, unless they have a default of their own
+	configs, err := EvalConfig(appRoot, &cueutil.Meta{
+		APIBaseURL: "http://localhost:4000",
+		EnvName:    "local",
+		EnvType:    cueutil.EnvType_Development,
+		CloudType:  cueutil.CloudType_Local,
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(configs["svc"], qt.JSONEquals, map[string]any{
+		"Name":     "primary",
+		"Nickname": nil,
+		"Limits":   nil,
+		"Replicas": 3,
+	})
+
+	if testing.Short() {
+		c.Skip("skipping running the config unmarshalers in short mode")
+	}
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		c.Skip("skipping running the config unmarshalers as go is not installed")
+	}
+	runtimePath, err := filepath.Abs(filepath.Join("..", "runtime"))
+	c.Assert(err, qt.IsNil)
+
+	// Run the unmarshalers generated for the app against the computed config, outside of
+	// the app so config.Load isn't called without the runtime being initialised
+	b := &builder{cfg: &Config{}, appRoot: appRoot}
+	c.Assert(b.parseApp(), qt.IsNil)
+	f, err := b.codegen.ConfigUnmarshalers(b.res.App.Services[0])
+	c.Assert(err, qt.IsNil)
+
+	modDir := c.TempDir()
+	svcDir := filepath.Join(modDir, "svc")
+	c.Assert(os.MkdirAll(svcDir, 0755), qt.IsNil)
+	// Require the same versions of the runtime's dependencies as it does, so they are
+	// found in the module cache
+	runtimeMod, err := os.ReadFile(filepath.Join(runtimePath, "go.mod"))
+	c.Assert(err, qt.IsNil)
+	gomod := strings.Replace(string(runtimeMod), "module encore.dev", "module encore.app", 1) +
+		"\nrequire encore.dev v1.1.0\n\nreplace encore.dev => " + runtimePath + "\n"
+	c.Assert(os.WriteFile(filepath.Join(modDir, "go.mod"), []byte(gomod), 0644), qt.IsNil)
+	gosum, err := os.ReadFile(filepath.Join(runtimePath, "go.sum"))
+	c.Assert(err, qt.IsNil)
+	c.Assert(os.WriteFile(filepath.Join(modDir, "go.sum"), gosum, 0644), qt.IsNil)
+	for _, name := range []string{"types.go", "unmarshal_test.go"} {
+		data, err := os.ReadFile(filepath.Join(appRoot, "svc", name))
+		c.Assert(err, qt.IsNil)
+		c.Assert(os.WriteFile(filepath.Join(svcDir, name), data, 0644), qt.IsNil)
+	}
+	out, err := os.Create(filepath.Join(svcDir, "encore_internal__config_unmarshalers.go"))
+	c.Assert(err, qt.IsNil)
+	c.Assert(f.Render(out), qt.IsNil)
+	c.Assert(out.Close(), qt.IsNil)
+
+	cmd := exec.Command(goBin, "test", "./svc")
+	cmd.Dir = modDir
+	cmd.Env = append(os.Environ(), "SVC_CONFIG="+configs["svc"], "GOFLAGS=-mod=mod", "GOPROXY=off")
+	output, err := cmd.CombinedOutput()
+	c.Assert(err, qt.IsNil, qt.Commentf("%s", strings.TrimSpace(string(output))))
+}
+
+func TestConfigUsesSecrets(t *testing.T) {
+	c := qt.New(t)
+
+	// Lists and structs can't be given secrets, so only scalar sensitive fields use them
+	for field, want := range map[string]bool{
+		"Password string `encore:\"sensitive\"`":                           true,
+		"Password string":                                                  false,
+		"Tokens []string `encore:\"sensitive\"`":                           false,
+		"Database struct{ Password config.String `encore:\"sensitive\"` }": true,
+	} {
+		archive := `
+-- encore.app --
+{"id": "test"}
+-- go.mod --
+module encore.app
+-- svc/svc.go --
+package svc
+
+import (
+	"context"
+
+	"encore.dev/config"
+)
+
+type Config struct {
+	Host string
+	` + field + `
+}
+
+var cfg = config.Load[*Config]()
+
+//encore:api
+func Get(ctx context.Context) error { return nil }
+`
+		appRoot := c.TempDir()
+		c.Assert(txtar.Write(txtar.Parse([]byte(archive)), appRoot), qt.IsNil)
+		b := &builder{cfg: &Config{}, appRoot: appRoot}
+		c.Assert(b.parseApp(), qt.IsNil)
+		uses, err := ConfigUsesSecrets(appRoot, b.res)
+		c.Assert(err, qt.IsNil)
+		c.Check(uses, qt.Equals, want, qt.Commentf("field %s", field))
+	}
+}
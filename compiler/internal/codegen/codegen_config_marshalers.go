@@ -70,6 +70,10 @@ type configUnmarshalersBuilder struct {
 	md                   *meta.Data
 	marshaller           *gocodegen.MarshallingCodeGenerator
 	concreteUnmarshalers []*Statement
+
+	// timeLayout is the layout times are read with for the field currently being read,
+	// as given by its `timeformat` tag, or empty if they are read as RFC3339 times
+	timeLayout string
 }
 
 // FindAllTypes returns a list of all decl's used within a services config.
@@ -288,16 +292,11 @@ func (cb *configUnmarshalersBuilder) readStruct(f *Group, struc *schema.Struct)
 	).Bool().Block(
 		Switch(Id("field")).BlockFunc(func(f *Group) {
 			for i, field := range struc.Fields {
-				jsonName := field.Name
-				for _, tag := range field.Tags {
-					if tag.Key == "json" {
-						if tag.Name != "" {
-							jsonName = tag.Name
-						}
-					}
-				}
-
+				jsonName := fieldJSONName(field)
+				prevLayout := cb.timeLayout
+				cb.timeLayout = fieldTimeLayout(field)
 				rhs, returnType := cb.readType(field.Typ, Lit(jsonName))
+				cb.timeLayout = prevLayout
 				f.Case(Lit(jsonName)).Block(Id("obj").Dot(field.Name).Op("=").Add(rhs))
 
 				fieldTypes[i] = Id(field.Name).Add(returnType)
@@ -309,9 +308,44 @@ func (cb *configUnmarshalersBuilder) readStruct(f *Group, struc *schema.Struct)
 		Return(True()),
 	))
 
+	// Fields read from environment variables are overridden once the config has been read,
+	// so the value given in the config is only used if the variable isn't set
+	for _, field := range struc.Fields {
+		for _, tag := range field.Tags {
+			if tag.Key == "envvar" && tag.Name != "" {
+				f.Qual("encore.dev/config", "ReadEnv").Call(
+					Lit(tag.Name),
+					Append(Id("path"), Lit(fieldJSONName(field))),
+					Op("&").Id("obj").Dot(field.Name),
+				)
+			}
+		}
+	}
+
 	return Struct(fieldTypes...)
 }
 
+// fieldJSONName returns the name of the field within the JSON representation of the config
+func fieldJSONName(field *schema.Field) string {
+	for _, tag := range field.Tags {
+		if tag.Key == "json" && tag.Name != "" {
+			return tag.Name
+		}
+	}
+	return field.Name
+}
+
+// fieldTimeLayout returns the layout of the times held by the field, as given by its `timeformat` tag,
+// or empty if the field doesn't have one
+func fieldTimeLayout(field *schema.Field) string {
+	for _, tag := range field.Tags {
+		if tag.Key == "timeformat" {
+			return tag.Name
+		}
+	}
+	return ""
+}
+
 // typeUnmarshalerFunc returns a `f` function which can be used to read the given value of `typ` and the type
 // that function f returns.
 //
@@ -387,17 +421,33 @@ func (cb *configUnmarshalersBuilder) readBuiltin(builtin schema.Builtin) (reader
 		return Id("itr").Dot("ReadFloat64").Call(), Float64()
 	case schema.Builtin_STRING:
 		return Id("itr").Dot("ReadString").Call(), String()
-	case schema.Builtin_BYTES, schema.Builtin_TIME, schema.Builtin_UUID, schema.Builtin_JSON, schema.Builtin_USER_ID:
+	case schema.Builtin_UUID:
+		// UUIDs are only accepted in their canonical form, as constrained by the generated CUE
+		return Qual("encore.dev/config", "ReadUUID").Call(Id("itr")), Qual("encore.dev/types/uuid", "UUID")
+	case schema.Builtin_JSON:
+		// Raw JSON is written in config as a string holding the encoded value
+		rtnTyp := Qual("encoding/json", "RawMessage")
+		return Func().Params().Params(Id("rtn").Add(rtnTyp)).Block(
+			Id("s").Op(":=").Id("itr").Dot("ReadString").Call(),
+			If(Op("!").Qual("encoding/json", "Valid").Call(Index().Byte().Call(Id("s")))).Block(
+				Panic(Qual("fmt", "Sprintf").Call(Lit("unable to decode the config: invalid JSON: %q"), Id("s"))),
+			),
+			Return(rtnTyp.Clone().Call(Id("s"))),
+		).Call(), rtnTyp
+	case schema.Builtin_TIME:
+		// Times of fields with a `timeformat` tag are written in config using that layout
+		// rather than as RFC3339 times, as constrained by the generated CUE
+		if cb.timeLayout != "" {
+			return Qual("encore.dev/config", "ReadTime").Call(Id("itr"), Lit(cb.timeLayout)), Qual("time", "Time")
+		}
+		fallthrough
+	case schema.Builtin_BYTES, schema.Builtin_USER_ID:
 		var rtnTyp *Statement
 		switch builtin {
 		case schema.Builtin_BYTES:
 			rtnTyp = Index().Byte()
 		case schema.Builtin_TIME:
 			rtnTyp = Qual("time", "Time")
-		case schema.Builtin_UUID:
-			rtnTyp = Qual("encore.dev/types/uuid", "UUID")
-		case schema.Builtin_JSON:
-			rtnTyp = Qual("encoding/json", "RawMessage")
 		case schema.Builtin_USER_ID:
 			rtnTyp = Qual("encore.dev/beta/auth", "UID")
 		}
@@ -424,6 +474,38 @@ func (cb *configUnmarshalersBuilder) readBuiltin(builtin schema.Builtin) (reader
 		return Id("itr").Dot("ReadInt").Call(), Int()
 	case schema.Builtin_UINT:
 		return Id("itr").Dot("ReadUint").Call(), Uint()
+	case schema.Builtin_NUMBER:
+		return Id("itr").Dot("ReadNumber").Call(), Qual("encoding/json", "Number")
+	case schema.Builtin_DURATION:
+		// Durations are written in config as strings such as "1h30m", rather than
+		// as the number of nanoseconds they are encoded as everywhere else
+		rtnTyp := Qual("time", "Duration")
+		return Func().Params().Params(Id("rtn").Add(rtnTyp)).Block(
+			List(Id("rtn"), Err()).Op(":=").Qual("time", "ParseDuration").Call(Id("itr").Dot("ReadString").Call()),
+			If(Err().Op("!=").Nil()).Block(
+				Panic(Qual("fmt", "Sprintf").Call(Lit("unable to decode the config: %v"), Err())),
+			),
+			Return(),
+		).Call(), rtnTyp
+	case schema.Builtin_DECIMAL:
+		// Decimals are written in config as strings, so they don't lose precision
+		rtnTyp := Qual("github.com/shopspring/decimal", "Decimal")
+		return Func().Params().Params(Id("rtn").Add(rtnTyp)).Block(
+			List(Id("rtn"), Err()).Op(":=").Qual("github.com/shopspring/decimal", "NewFromString").Call(Id("itr").Dot("ReadString").Call()),
+			If(Err().Op("!=").Nil()).Block(
+				Panic(Qual("fmt", "Sprintf").Call(Lit("unable to decode the config: %v"), Err())),
+			),
+			Return(),
+		).Call(), rtnTyp
+	case schema.Builtin_RAT:
+		rtnTyp := Qual("math/big", "Rat")
+		return Func().Params().Params(Id("rtn").Add(rtnTyp)).Block(
+			Id("s").Op(":=").Id("itr").Dot("ReadString").Call(),
+			If(List(Id("_"), Id("ok")).Op(":=").Id("rtn").Dot("SetString").Call(Id("s")), Op("!").Id("ok")).Block(
+				Panic(Qual("fmt", "Sprintf").Call(Lit("unable to decode the config: invalid rational number: %q"), Id("s"))),
+			),
+			Return(),
+		).Call(), rtnTyp
 	default:
 		panic(fmt.Sprintf("unsupported builtin type: %v", builtin))
 	}
@@ -162,6 +162,18 @@ func (b *Builder) schemaBuiltInToGoType(builtin schema.Builtin) *Statement {
 	case schema.Builtin_JSON:
 		return Qual("encoding/json", "RawMessage")
 
+	case schema.Builtin_NUMBER:
+		return Qual("encoding/json", "Number")
+
+	case schema.Builtin_DURATION:
+		return Qual("time", "Duration")
+
+	case schema.Builtin_DECIMAL:
+		return Qual("github.com/shopspring/decimal", "Decimal")
+
+	case schema.Builtin_RAT:
+		return Qual("math/big", "Rat")
+
 	case schema.Builtin_USER_ID:
 		return Qual("encore.dev/beta/auth", "UID")
 
@@ -0,0 +1,39 @@
+package cuegen
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// checksumPrefix starts the line in the footer of a generated file holding its checksum
+const checksumPrefix = "// Checksum: sha256:"
+
+// VerifyChecksum reports whether the content of a file generated with Options.EmitChecksum
+// still matches the checksum in its footer, such that it has not been edited since it was
+// generated. Files without a checksum are never verified.
+//
+// Any user section (see UserSectionMarker) is not part of the checksum, so may be edited.
+func (g *Generator) VerifyChecksum(content []byte) bool {
+	content, _ = splitUserSection(content)
+	idx := bytes.LastIndex(content, []byte("\n"+checksumPrefix))
+	if idx < 0 {
+		return false
+	}
+	sum := bytes.TrimSpace(content[idx+1+len(checksumPrefix):])
+	return string(sum) == checksum(bytes.TrimSuffix(content[:idx], []byte("\r")))
+}
+
+// appendChecksum appends a line holding the checksum of the generated file to its footer
+func appendChecksum(content []byte) []byte {
+	sum := checksum(content)
+	return append(content, []byte("\n"+checksumPrefix+sum+"\n")...)
+}
+
+// checksum hashes the content of a generated file, ignoring the line endings it was
+// checked out with so that the checksum only depends on the content itself
+func checksum(content []byte) string {
+	content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+	hash := sha256.Sum256(content)
+	return hex.EncodeToString(hash[:])
+}
@@ -13,26 +13,38 @@ import (
 // definitionGenerator is used to count the number of types a specific named type
 // is used (named types include type arguments, such that Option[string] != Option[int]).
 //
-// It also counts the number of times a unique named type uses a decl.
+// It also counts the number of times a decl is used, across all of its type arguments.
+//
+// It also counts the number of times each shape of anonymous struct is used as a map value.
 //
 // This allows us to:
 // - determine if we should inline a named type into a config field if it's only used once
 // - generate a unique name for a generic decl if it's used with multiple type arguments
+// - generate definitions for each instantiation of a generic decl used more than once
+// - hoist map values of the same anonymous struct shape into a single definition
 type definitionGenerator struct {
-	decls          []*schema.Decl
-	ids            []*schema.Named
-	definitionName map[int]string // id -> name
-	nameCount      map[string]int // name -> usage count for base name
-	counts         map[int]int    // id -> usage count for ID
+	decls      []*schema.Decl
+	ids        []*schema.Named
+	baseName   map[int]string // id -> name of the definition, before it's made unique
+	counts     map[int]int    // id -> usage count for ID
+	declCounts map[uint32]int // decl id -> usage count for the decl, with any type arguments
+	recursive  map[int]bool   // id -> whether the type refers back to itself
+
+	qualifier func(decl *schema.Decl) string // if set, returns a prefix qualifying the names of definitions
+
+	shapes     []*schema.Struct // anonymous structs used as map values
+	shapeCount map[int]int      // shape id -> usage count
 }
 
 func newDefinitionGenerator(decls []*schema.Decl) *definitionGenerator {
 	return &definitionGenerator{
-		decls:          decls,
-		ids:            nil,
-		definitionName: make(map[int]string),
-		nameCount:      make(map[string]int),
-		counts:         make(map[int]int),
+		decls:      decls,
+		ids:        nil,
+		baseName:   make(map[int]string),
+		counts:     make(map[int]int),
+		declCounts: make(map[uint32]int),
+		recursive:  make(map[int]bool),
+		shapeCount: make(map[int]int),
 	}
 }
 
@@ -52,26 +64,72 @@ func (n *definitionGenerator) ID(named *schema.Named) int {
 	n.ids = append(n.ids, named)
 	id := len(n.ids) - 1
 
-	// Create a unique name for this definition
-	defaultName := n.typeToDefinitionName(&schema.Type{Typ: &schema.Type_Named{Named: named}})
-	usageCount, found := n.nameCount[defaultName]
-	if !found {
-		n.definitionName[id] = defaultName
-	} else {
-		n.definitionName[id] = fmt.Sprintf("%s_%d", defaultName, usageCount)
-	}
-	n.nameCount[defaultName] = usageCount + 1
+	n.baseName[id] = n.typeToDefinitionName(&schema.Type{Typ: &schema.Type_Named{Named: named}})
 
 	return id
 }
 
+// definitionName returns the unique name of the definition for the id.
+//
+// Types whose names would otherwise be the same are told apart by a suffix, given in the
+// order of the packages they're declared in rather than the order they're found in, so
+// reordering the fields which use them doesn't rename their definitions.
+func (n *definitionGenerator) definitionName(id int) string {
+	base := n.baseName[id]
+	key := n.typeKey(&schema.Type{Typ: &schema.Type_Named{Named: n.ids[id]}})
+
+	rank := 0
+	for other, otherBase := range n.baseName {
+		if other != id && otherBase == base && n.typeKey(&schema.Type{Typ: &schema.Type_Named{Named: n.ids[other]}}) < key {
+			rank++
+		}
+	}
+	return suffixedName(base, rank)
+}
+
+// suffixedName returns the name with a suffix telling it apart from the rank other definitions of the same name
+func suffixedName(name string, rank int) string {
+	if rank == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s_%d", name, rank)
+}
+
+// typeKey returns a key which identifies the type by the packages and names of the decls within it
+func (n *definitionGenerator) typeKey(typ *schema.Type) string {
+	switch typ := typ.Typ.(type) {
+	case *schema.Type_Named:
+		decl := n.decls[typ.Named.Id]
+		key := decl.Loc.GetPkgPath() + "." + decl.Name
+		if len(typ.Named.TypeArguments) > 0 {
+			args := make([]string, len(typ.Named.TypeArguments))
+			for i, arg := range typ.Named.TypeArguments {
+				args[i] = n.typeKey(arg)
+			}
+			key += "[" + strings.Join(args, ",") + "]"
+		}
+		return key
+	case *schema.Type_List:
+		return "[]" + n.typeKey(typ.List.Elem)
+	case *schema.Type_Map:
+		return "map[" + n.typeKey(typ.Map.Key) + "]" + n.typeKey(typ.Map.Value)
+	case *schema.Type_Pointer:
+		return "*" + n.typeKey(typ.Pointer.Base)
+	case *schema.Type_Config:
+		return n.typeKey(typ.Config.Elem)
+	default:
+		return n.typeToDefinitionName(&schema.Type{Typ: typ})
+	}
+}
+
 func (n *definitionGenerator) CueIdent(named *schema.Named) *ast.Ident {
-	return ast.NewIdent("#" + n.definitionName[n.ID(named)])
+	return ast.NewIdent("#" + n.definitionName(n.ID(named)))
 }
 
 func (n *definitionGenerator) Inc(named *schema.Named) {
 	id := n.ID(named)
 	n.counts[id]++
+	n.declCounts[named.Id]++
 }
 
 func (n *definitionGenerator) Count(named *schema.Named) int {
@@ -79,10 +137,85 @@ func (n *definitionGenerator) Count(named *schema.Named) int {
 	return n.counts[id]
 }
 
+// DeclCount returns the number of times the decl of the named type is used,
+// with any type arguments
+func (n *definitionGenerator) DeclCount(named *schema.Named) int {
+	return n.declCounts[named.Id]
+}
+
+func (n *definitionGenerator) MarkRecursive(named *schema.Named) {
+	id := n.ID(named)
+	n.recursive[id] = true
+}
+
+func (n *definitionGenerator) IsRecursive(named *schema.Named) bool {
+	id := n.ID(named)
+	return n.recursive[id]
+}
+
+// shapeID returns the id for the shape of an anonymous struct used as a map value.
+// If two structs of the same shape are passed in, it will return the same id.
+func (n *definitionGenerator) shapeID(stru *schema.Struct) int {
+	for idx, other := range n.shapes {
+		if reflect.DeepEqual(stru, other) {
+			return idx
+		}
+	}
+
+	n.shapes = append(n.shapes, stru)
+	return len(n.shapes) - 1
+}
+
+// shapeName returns the name of the definition for the shape of map value. Shapes have no
+// name of their own, so they're numbered in the order they're first used in, after any
+// named types with the same name.
+func (n *definitionGenerator) shapeName(id int) string {
+	rank := id
+	for _, base := range n.baseName {
+		if base == "MapValue" {
+			rank++
+		}
+	}
+	return suffixedName("MapValue", rank)
+}
+
+func (n *definitionGenerator) IncShape(stru *schema.Struct) {
+	n.shapeCount[n.shapeID(stru)]++
+}
+
+// ShapeCount returns the number of times a struct of the same shape is used as a map value
+func (n *definitionGenerator) ShapeCount(stru *schema.Struct) int {
+	for idx, other := range n.shapes {
+		if reflect.DeepEqual(stru, other) {
+			return n.shapeCount[idx]
+		}
+	}
+	return 0
+}
+
+func (n *definitionGenerator) ShapeCueIdent(stru *schema.Struct) *ast.Ident {
+	return ast.NewIdent("#" + n.shapeName(n.shapeID(stru)))
+}
+
+// ShapesWithCountsOver returns the shapes of map values used more than x times.
+func (n *definitionGenerator) ShapesWithCountsOver(x int) []*schema.Struct {
+	var rtn []*schema.Struct
+	for id, stru := range n.shapes {
+		if n.shapeCount[id] > x {
+			rtn = append(rtn, stru)
+		}
+	}
+	return rtn
+}
+
+// NamesWithCountsOver returns the named types used more than x times, along with
+// any recursive types as they can never be inlined, and instantiations of generic
+// decls used more than x times.
 func (n *definitionGenerator) NamesWithCountsOver(x int) []*schema.Named {
 	rtn := make([]*schema.Named, 0, len(n.ids))
 	for id, name := range n.ids {
-		if n.counts[id] > x {
+		generic := len(name.TypeArguments) > 0 && n.declCounts[name.Id] > x
+		if n.counts[id] > x || n.recursive[id] || generic {
 			rtn = append(rtn, name)
 		}
 	}
@@ -99,7 +232,11 @@ func (n *definitionGenerator) typeToDefinitionName(typ *schema.Type) string {
 	switch typ := typ.Typ.(type) {
 	case *schema.Type_Named:
 		var name strings.Builder
-		name.WriteString(n.decls[typ.Named.Id].Name)
+		decl := n.decls[typ.Named.Id]
+		if n.qualifier != nil {
+			name.WriteString(n.qualifier(decl))
+		}
+		name.WriteString(decl.Name)
 		for _, typeArg := range typ.Named.TypeArguments {
 			name.WriteString("_")
 			name.WriteString(n.typeToDefinitionName(typeArg))
@@ -145,10 +282,16 @@ func (n *definitionGenerator) typeToDefinitionName(typ *schema.Type) string {
 			return "bytes"
 		case schema.Builtin_TIME:
 			return "string"
+		case schema.Builtin_DURATION:
+			return "string"
 		case schema.Builtin_UUID:
 			return "string"
 		case schema.Builtin_JSON:
 			return "string"
+		case schema.Builtin_NUMBER:
+			return "number"
+		case schema.Builtin_DECIMAL, schema.Builtin_RAT:
+			return "decimal"
 		case schema.Builtin_USER_ID:
 			return "string"
 		case schema.Builtin_INT:
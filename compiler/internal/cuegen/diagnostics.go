@@ -0,0 +1,50 @@
+package cuegen
+
+import (
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// Severity is how severe a Diagnostic is
+type Severity string
+
+const (
+	// SeverityError is a problem which stopped the config of a service from being generated
+	SeverityError Severity = "error"
+
+	// SeverityWarning is a problem with the generated config which did not stop it from being generated
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic is a problem found while generating the config of a service
+type Diagnostic struct {
+	Service  string   `json:"service"`
+	Field    string   `json:"field,omitempty"` // the dotted labels of the field the problem was found in, if any
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+// Report is the JSON report written to Options.DiagnosticsReport
+type Report struct {
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+// warn records a warning against the field currently being generated, unless it has already
+// been recorded (as fields are generated once for each variant of a union they belong to)
+func (s *service) warn(message string) {
+	diagnostic := s.diagnostic(SeverityWarning, message)
+	if !slices.Contains(s.diagnostics, diagnostic) {
+		s.diagnostics = append(s.diagnostics, diagnostic)
+	}
+}
+
+// diagnostic creates a diagnostic for the field currently being generated
+func (s *service) diagnostic(severity Severity, message string) Diagnostic {
+	return Diagnostic{
+		Service:  s.svc.Name,
+		Field:    strings.Join(s.fieldPath, "."),
+		Severity: severity,
+		Message:  message,
+	}
+}
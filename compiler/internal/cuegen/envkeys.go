@@ -0,0 +1,107 @@
+package cuegen
+
+import (
+	"cuelang.org/go/cue/ast"
+	"cuelang.org/go/cue/token"
+	"golang.org/x/exp/slices"
+
+	"encr.dev/pkg/idents"
+)
+
+// envKeysDefinition creates the #EnvConfig definition, which describes the config when given as
+// environment variables. Each scalar field of #Config is given under a single key, formed by
+// joining the labels of the fields leading to it with double underscores (i.e. `DATABASE__HOST`).
+//
+// The keys are derived from the fields already generated for #Config, so they follow the same
+// labels and merging rules. Lists and maps have no flattened form, so are left out.
+func (s *service) envKeysDefinition(definitions []ast.Decl) *ast.Field {
+	// Look up the definitions by name, so fields referencing a struct definition can be flattened
+	values := make(map[string]ast.Expr, len(definitions))
+	for _, decl := range definitions {
+		if field, ok := decl.(*ast.Field); ok {
+			if name, _, err := ast.LabelName(field.Label); err == nil {
+				values[name] = field.Value
+			}
+		}
+	}
+
+	var keys []ast.Decl
+	var flatten func(decls []ast.Decl, prefix string, optional bool, chain []string)
+	flatten = func(decls []ast.Decl, prefix string, optional bool, chain []string) {
+		for _, decl := range decls {
+			switch decl := decl.(type) {
+			case *ast.Comprehension:
+				// Fields which are only conditionally present may be left out
+				if stru, ok := decl.Value.(*ast.StructLit); ok {
+					flatten(stru.Elts, prefix, true, chain)
+				}
+
+			case *ast.Field:
+				label, _, err := ast.LabelName(decl.Label)
+				if err != nil {
+					continue
+				}
+				key := prefix + idents.Convert(label, idents.ScreamingSnakeCase)
+				isOptional := optional || decl.Optional != token.NoPos
+
+				// Structs are flattened into the keys of their fields, unless they're recursive
+				value := decl.Value
+				var definition string
+				if ident, ok := value.(*ast.Ident); ok {
+					if resolved, found := values[ident.Name]; found {
+						definition = ident.Name
+						value = resolved
+					}
+				}
+				if stru, ok := value.(*ast.StructLit); ok {
+					if definition == "" {
+						if !hasPatternConstraint(stru) {
+							flatten(stru.Elts, key+"__", isOptional, chain)
+						}
+					} else if !slices.Contains(chain, definition) && !hasPatternConstraint(stru) {
+						flatten(stru.Elts, key+"__", isOptional, append(slices.Clone(chain), definition))
+					}
+					continue
+				}
+				if _, isList := value.(*ast.ListLit); isList || spansMultipleLines(value) {
+					continue
+				}
+
+				field := &ast.Field{Label: ast.NewIdent(key), Value: decl.Value}
+				if !ast.IsValidIdent(key) {
+					field.Label = ast.NewString(key)
+				}
+				if isOptional {
+					field.Optional = token.Blank.Pos()
+				}
+				keys = append(keys, field)
+			}
+		}
+	}
+	flatten(s.topLevelFields, "", false, nil)
+
+	field := &ast.Field{
+		Label: ast.NewIdent("#EnvConfig"),
+		Value: newStruct(keys),
+	}
+	field.AddComment(&ast.CommentGroup{
+		List: []*ast.Comment{
+			{Slash: token.NewSection.Pos(), Text: "// #EnvConfig describes #Config when it is given as environment variables, with each"},
+			{Text: "// nested field given under the labels leading to it joined by double underscores."},
+		},
+	})
+	return field
+}
+
+// hasPatternConstraint reports whether the struct constrains its fields using a pattern
+// (i.e. `[string]: int`), which is the case for maps
+func hasPatternConstraint(stru *ast.StructLit) bool {
+	for _, elt := range stru.Elts {
+		if field, ok := elt.(*ast.Field); ok {
+			if _, isPattern := field.Label.(*ast.ListLit); isPattern {
+				return true
+			}
+		}
+	}
+	return false
+}
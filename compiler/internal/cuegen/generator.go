@@ -1,6 +1,13 @@
 package cuegen
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+
 	"cuelang.org/go/cue/ast"
 	"cuelang.org/go/cue/ast/astutil"
 	"cuelang.org/go/cue/format"
@@ -8,15 +15,283 @@ import (
 
 	"encr.dev/parser"
 	"encr.dev/parser/est"
+	"encr.dev/pkg/idents"
+	schema "encr.dev/proto/encore/parser/schema/v1"
+)
+
+// Options configures the CUE files produced by a Generator.
+//
+// The zero value produces the default output.
+type Options struct {
+	// AllowExtraKeys is a list of additional top level keys which are allowed
+	// to be present in the config file, even though no config type declares them.
+	//
+	// Each key is emitted as an optional field accepting any value, so the
+	// #Config definition remains closed to all other unknown keys.
+	AllowExtraKeys []string
+
+	// EmitEnumValues emits a list of all the values of an enum alongside
+	// the definition of that enum. The list is named after the definition
+	// with a "Values" suffix (i.e. `#LevelValues` for `#Level`), allowing
+	// tooling to enumerate the valid options.
+	EmitEnumValues bool
+
+	// CaseInsensitiveEnums matches the values of string enums regardless of their casing,
+	// using a case-insensitive regular expression instead of a disjunction of the values.
+	//
+	// The application is responsible for normalizing the casing of the values it receives.
+	CaseInsensitiveEnums bool
+
+	// InlineEnums inlines enums used up to this many times as a disjunction of their values
+	// at each use, rather than as a definition, with a comment listing the members of the
+	// enum (i.e. `// one of: debug, info, warn`).
+	//
+	// If zero, enums are only inlined when used once, without a comment.
+	InlineEnums int
+
+	// StringLengthInBytes changes the length constraints generated for strings from
+	// `validate` struct tags to count bytes instead of runes.
+	//
+	// By default lengths are counted in runes, matching go-playground's validator. This
+	// option should be set if the application validates strings by their length in bytes.
+	StringLengthInBytes bool
+
+	// StringContentRules converts the `startswith`, `endswith` and `contains` rules of
+	// `validate` struct tags on strings into CUE constraints, so that config which
+	// would fail those rules at runtime is rejected when the config is checked.
+	StringContentRules bool
+
+	// LengthAttributes mirrors the length constraints generated for strings and lists from
+	// `validate` struct tags as attributes named after the JSON Schema keywords
+	// (i.e. `@minLength(1)` on strings and `@maxItems(5)` on lists), so converters
+	// to JSON Schema can preserve them without interpreting the CUE constraints.
+	//
+	// The CUE constraints are still generated, and the attributes do not change how
+	// the config is validated.
+	LengthAttributes bool
+
+	// BoundAttributes mirrors the bounds of number fields as `@minimum(...)` and `@maximum(...)`
+	// attributes, for the same converters as LengthAttributes. Bounds come from the `min`, `max`
+	// and `len` rules of `validate` struct tags, or otherwise from the range of sized integer
+	// types (i.e. `@minimum(0) @maximum(65535)` for uint16).
+	//
+	// The CUE constraints are still generated, and the attributes do not change how
+	// the config is validated.
+	BoundAttributes bool
+
+	// ConstraintAttributes mirrors the constraints given by `cue` struct tags as attributes named
+	// after the equivalent JSON Schema keywords, as LengthAttributes does for `validate` tags.
+	// Regular expressions become `@pattern(...)` and bounds become `@minimum(...)`, `@maximum(...)`,
+	// `@exclusiveMinimum(...)` or `@exclusiveMaximum(...)`.
+	//
+	// Other constraints cannot be expressed this way, and are reported as warnings through
+	// DiagnosticsReport.
+	ConstraintAttributes bool
+
+	// EmitRequiredAttr annotates every field which is not optional with a `@required()`
+	// attribute, for converters to OpenAPI or JSON Schema which read the attribute rather
+	// than the optionality of the field.
+	//
+	// Fields remain required through their labels, so the attribute does not change how
+	// the config is validated.
+	EmitRequiredAttr bool
+
+	// NullablePointers allows pointer fields to be given as null, as when the config is given as JSON.
+	// NullDefault also makes null the default value (`*null | T`), while NullPermitted only allows it
+	// (`T | null`), so the config must still give a value unless the field has a default of its own.
+	//
+	// By default pointers are represented by the type they point to, and cannot be null.
+	NullablePointers Nullability
+
+	// CollapseSingleFieldStructs represents structs with a single field by the value of that field,
+	// including its constraints and default, so the field's label can be left out of the config
+	// (i.e. `Timeout: 5` rather than `Timeout: {Seconds: 5}`).
+	//
+	// Structs are not collapsed if their field is optional or has attributes, as those cannot be
+	// kept without the field. The top level config struct is never collapsed.
+	CollapseSingleFieldStructs bool
+
+	// PruneEmpty removes any fields whose type is a struct which has no fields left
+	// once excluded fields (i.e. `json:"-"`) have been removed. This cascades, such that a
+	// struct containing only empty structs is also removed.
+	//
+	// If a config type has no fields left, no CUE file is generated for it.
+	PruneEmpty bool
+
+	// DefineNamedTypes generates a definition for every named type used in config, rather than
+	// only those used more than once, so the CUE mirrors the structure of the Go types.
+	// The types passed to config.Load are still given by #Config, and enums are still
+	// inlined when used up to InlineEnums times.
+	DefineNamedTypes bool
+
+	// QualifiedDefinitionNames prefixes the names of definitions with the path of the package the
+	// type is declared in, relative to the app's module (i.e. `#SvcUtilsServer` for `svc/utils.Server`),
+	// so types with the same name from different packages are told apart by more than a number.
+	QualifiedDefinitionNames bool
+
+	// TrimPackagePrefix is removed from the start of package paths before they qualify the names
+	// of definitions, such as the directory vendored modules are kept in (i.e. `vendored/` names
+	// `vendored/foo.Backend` as `#FooBackend` rather than `#VendoredFooBackend`).
+	//
+	// It only applies when QualifiedDefinitionNames is set.
+	TrimPackagePrefix string
+
+	// ReferenceComments adds a comment pointing at the definition (i.e. `// see #ServerOptions`)
+	// to every field which references a definition, so readers don't need to search for it.
+	ReferenceComments bool
+
+	// DocTranslate is applied to the doc comments of Go types and fields before they are added to
+	// the generated file, so teams can run them through a translator or glossary. It is given the
+	// whole comment, which may span multiple lines, and the comment it returns is laid out as any
+	// other, such that a comment which now spans multiple lines is placed above its field.
+	//
+	// Notes generated from struct tags (i.e. `// readonly`) are added after the translated comment.
+	DocTranslate func(goDoc string) string
+
+	// OrderedMaps annotates every map field with an `@index()` attribute, indicating
+	// to tooling that the order of the map's entries should be preserved.
+	//
+	// CUE structs are unordered, so this is only metadata and does not change
+	// how the config is validated.
+	OrderedMaps bool
+
+	// SortByJSONName orders the fields of each struct by their json tag names, rather than
+	// the order they are declared in. Fields without a json tag name are placed after
+	// those with one, in the order they are declared.
+	SortByJSONName bool
+
+	// Environments is a list of environments to scaffold config for, following CUE's
+	// overlay pattern. Instead of the config being expected as fields at the package level,
+	// a field is generated for each environment (i.e. `dev: #Config`) which must satisfy
+	// the config definition, and under which the values for that environment can be given.
+	Environments []string
+
+	// FlattenedEnvKeys additionally generates an #EnvConfig definition, describing the config when
+	// it is given as environment variables. Each field is given under a single key, formed by joining
+	// the labels of the fields leading to it with double underscores (i.e. `DATABASE__HOST`).
+	//
+	// Lists and maps cannot be given as flattened keys, so are not included.
+	FlattenedEnvKeys bool
+
+	// OpenAPICompatible generates the config such that it can be exported with CUE's OpenAPI
+	// encoder (i.e. `cue def --out openapi`), which only supports definitions at the top level.
+	// #Config is not inlined at the package level, so the file describes the config schema
+	// without being used to validate config values, and cannot be combined with Environments.
+	//
+	// The encoder describes each field with its doc comment, and derives formats from the
+	// field types (i.e. date-time for time.Time). Fields which are conditionally present,
+	// such as those with an env tag, cannot be exported.
+	OpenAPICompatible bool
+
+	// FieldPolicies are constraints which are unified with the fields at the given paths,
+	// regardless of the field's tags (i.e. `"database.port": >=1024`).
+	//
+	// Paths are the dotted labels of the fields from the top level of the config, and may
+	// use glob patterns, in which `*` matches a single label (i.e. `*.port`). Fields within
+	// a definition have paths relative to that definition (i.e. `#Database.port`).
+	FieldPolicies map[string]ast.Expr
+
+	// CustomTypes gives the CUE representing Go types which are better described by hand than by
+	// their fields, keyed by the package path and name of the type (i.e. `encore.app/money.Amount`).
+	// Each is a reference to a value in another CUE package, given as in a `curef` struct tag
+	// (i.e. `acme.com/cue/types.#Money`), which is imported by the files using the type.
+	//
+	// The fields of custom types are not generated, so may be of types which cannot be represented.
+	CustomTypes map[string]string
+
+	// SharedPackage is the import path of a CUE package to generate the definitions of named types
+	// used by the config of more than one service into (i.e. `encore.gen/config`), rather than
+	// generating them within the file of each service. The files of those services import the
+	// package, and refer to the types by its definitions (i.e. `config.#Database`).
+	//
+	// The package is generated by Generator.SharedDefinitions, and named after the last element
+	// of its import path. The types passed to config.Load are still generated by each service, as
+	// their fields are given at the top level of its config, as are types with fields only present
+	// in some environments.
+	SharedPackage string
+
+	// EmitSchemaVersion adds a `$version` field to the config, holding the version of the
+	// config schema. Config data may then give the version it was written against, which
+	// fails to unify with the schema if the schema has since changed.
+	//
+	// The version is SchemaVersion if set, otherwise a hash of the generated schema.
+	EmitSchemaVersion bool
+
+	// SchemaVersion is the version given to the config schema when EmitSchemaVersion is set.
+	SchemaVersion string
+
+	// DiagnosticsReport receives a JSON report (see Report) of the errors and warnings found
+	// across all services by GenerateAllWithContext, for tooling such as CI to display.
+	//
+	// When set, a service failing to generate does not stop the other services from being
+	// generated, so that the report lists the errors of every service.
+	DiagnosticsReport io.Writer
+
+	// WarnCaseInsensitiveCollisions reports a warning for fields whose labels within a struct
+	// differ only by case (i.e. `Host` and `host`). CUE treats such labels as distinct, but
+	// case-insensitive consumers of the config, such as Go's encoding/json, cannot tell them apart.
+	//
+	// Warnings are only surfaced through DiagnosticsReport.
+	WarnCaseInsensitiveCollisions bool
+
+	// IndentWidth indents the generated files with this many spaces, rather than with tabs
+	// as `cue fmt` does, to match the style of the repository the files are written to.
+	//
+	// If zero, the files are indented with tabs.
+	IndentWidth int
+
+	// PackageName returns the name of the CUE package generated for the given service.
+	//
+	// If nil, the package is named after the service, with any characters which
+	// are not valid in a CUE identifier replaced by underscores.
+	PackageName func(svc *est.Service) string
+
+	// ServiceMetadata returns metadata about the given service, such as the team which owns it,
+	// which is recorded in the header of its file as a line for each entry (i.e. `// owner: payments`),
+	// ordered by key.
+	ServiceMetadata func(svc *est.Service) map[string]string
+
+	// EmitChecksum appends a checksum of the generated file to its footer, so that tooling can
+	// detect when the file has been edited by hand using Generator.VerifyChecksum.
+	EmitChecksum bool
+
+	// Version is the version of the Encore compiler generating the files. If set, it is
+	// recorded in the header of each file to help diagnose differences in the output
+	// between versions of the compiler.
+	Version string
+}
+
+// Nullability is whether pointers may be given as null in the config
+type Nullability int
+
+const (
+	// NotNullable represents pointers by the type they point to, so they cannot be null
+	NotNullable Nullability = iota
+
+	// NullPermitted allows pointers to be given as null (`T | null`)
+	NullPermitted
+
+	// NullDefault allows pointers to be given as null, and defaults them to null (`*null | T`)
+	NullDefault
 )
 
 type Generator struct {
-	res *parser.Result
+	res    *parser.Result
+	opts   *Options
+	shared *sharedTypes // the types generated into Options.SharedPackage, once found
 }
 
-func NewGenerator(res *parser.Result) *Generator {
+// NewGenerator creates a new Generator for the given parse result.
+//
+// If opts is nil the default options are used.
+func NewGenerator(res *parser.Result, opts *Options) *Generator {
+	if opts == nil {
+		opts = &Options{}
+	}
+
 	return &Generator{
-		res: res,
+		res:  res,
+		opts: opts,
 	}
 }
 
@@ -29,36 +304,179 @@ func (g *Generator) UserFacing(svc *est.Service) ([]byte, error) {
 		return nil, nil
 	}
 
-	// Create a base file
-	service := &service{
+	return g.newService(context.Background(), svc).generate()
+}
+
+// GenerateAllWithContext generates the CUE files for the given services, returning
+// them keyed by service name. Services which do not load any config are omitted.
+//
+// If the context is canceled, generation stops and the context's error is returned.
+//
+// If Options.DiagnosticsReport is set, every service is generated before the report is
+// written, and the error of the first service which failed to generate is returned.
+func (g *Generator) GenerateAllWithContext(ctx context.Context, services []*est.Service) (map[string][]byte, error) {
+	files := make(map[string][]byte, len(services))
+	report := Report{Diagnostics: []Diagnostic{}}
+	var firstErr error
+	for _, svc := range services {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if len(svc.ConfigLoads) == 0 {
+			continue
+		}
+
+		s := g.newService(ctx, svc)
+		f, err := s.generate()
+		report.Diagnostics = append(report.Diagnostics, s.diagnostics...)
+		if err != nil {
+			if g.opts.DiagnosticsReport == nil || ctx.Err() != nil {
+				return nil, err
+			}
+
+			// Record the error against the field being generated when it occurred
+			report.Diagnostics = append(report.Diagnostics, s.diagnostic(SeverityError, err.Error()))
+			if firstErr == nil {
+				firstErr = fmt.Errorf("service %s: %w", svc.Name, err)
+			}
+			continue
+		}
+		files[svc.Name] = f
+	}
+
+	if g.opts.DiagnosticsReport != nil {
+		enc := json.NewEncoder(g.opts.DiagnosticsReport)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return nil, fmt.Errorf("unable to write diagnostics report: %w", err)
+		}
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return files, nil
+}
+
+// GenerateForPackage generates the CUE files for the given services, scoped to the config of the
+// Go package with the given import path. The files are keyed by service name.
+//
+// Only the config loaded within the package, or of config types declared in the package, is
+// included. Services without any such config are omitted. Types from other packages used within
+// the config are still generated, as they are needed to describe it.
+func (g *Generator) GenerateForPackage(pkgPath string, services []*est.Service) (map[string][]byte, error) {
+	files := make(map[string][]byte, len(services))
+	for _, svc := range services {
+		scoped := *svc
+		scoped.ConfigLoads = nil
+		for _, load := range svc.ConfigLoads {
+			if g.configPackage(load) == pkgPath || load.DeclFile.Pkg.ImportPath == pkgPath {
+				scoped.ConfigLoads = append(scoped.ConfigLoads, load)
+			}
+		}
+		if len(scoped.ConfigLoads) == 0 {
+			continue
+		}
+
+		f, err := g.newService(context.Background(), &scoped).generate()
+		if err != nil {
+			return nil, err
+		}
+		files[svc.Name] = f
+	}
+	return files, nil
+}
+
+// configPackage returns the import path of the package the type of the config is declared in,
+// which for anonymous types is the package loading the config
+func (g *Generator) configPackage(load *est.Config) string {
+	typ := load.ConfigStruct.Type
+	if ptr := typ.GetPointer(); ptr != nil {
+		typ = ptr.Base
+	}
+	if named := typ.GetNamed(); named != nil {
+		if loc := g.res.Meta.Decls[named.Id].Loc; loc != nil {
+			return loc.PkgPath
+		}
+	}
+	return load.DeclFile.Pkg.ImportPath
+}
+
+// newService creates the state for generating the CUE file of the given service
+func (g *Generator) newService(ctx context.Context, svc *est.Service) *service {
+	return &service{
 		g:             g,
+		ctx:           ctx,
 		svc:           svc,
 		file:          &ast.File{},
 		neededImports: make(map[string]string),
 		fieldLookup:   make(map[string]*ast.Field),
-		typeUsage:     newDefinitionGenerator(g.res.Meta.Decls),
+		fieldOrigins:  make(map[string]fieldOrigin),
+		fieldComments: make(map[string]map[string]bool),
+		typeUsage:     g.newDefinitionGenerator(),
 	}
+}
+
+// newDefinitionGenerator creates the definitionGenerator naming the definitions of a service
+func (g *Generator) newDefinitionGenerator() *definitionGenerator {
+	typeUsage := newDefinitionGenerator(g.res.Meta.Decls)
+	if g.opts.QualifiedDefinitionNames {
+		typeUsage.qualifier = g.packageQualifier
+	}
+	return typeUsage
+}
 
-	// Count the number of times each named type is used
-	// this allows us to determine if we inline the named type
-	// or create and use a Definition
-	for _, configLoad := range svc.ConfigLoads {
-		if err := service.countNamedUsagesAndCollectImports(configLoad.ConfigStruct.Type); err != nil {
+// packageQualifier returns the prefix qualifying the definition name of the given decl with
+// its package, formed from the package's path within the app (i.e. `SvcUtils` for `svc/utils`)
+func (g *Generator) packageQualifier(decl *schema.Decl) string {
+	pkgPath := decl.Loc.PkgPath
+	if modulePath := g.res.Meta.ModulePath; pkgPath == modulePath || strings.HasPrefix(pkgPath, modulePath+"/") {
+		pkgPath = strings.TrimPrefix(pkgPath[len(modulePath):], "/")
+	}
+	pkgPath = strings.TrimPrefix(pkgPath, g.opts.TrimPackagePrefix)
+
+	var qualifier strings.Builder
+	for _, part := range strings.FieldsFunc(pkgPath, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+		qualifier.WriteString(idents.Convert(part, idents.PascalCase))
+	}
+	return qualifier.String()
+}
+
+// generate generates the CUE file for the service
+func (s *service) generate() ([]byte, error) {
+	// Find the types shared with other services first, as they aren't generated by the service
+	if _, err := s.g.sharedTypes(); err != nil {
+		return nil, err
+	}
+
+	// Count the number of times each named type is used and find any
+	// recursive types, this allows us to determine if we inline the
+	// named type or create and use a Definition
+	for _, configLoad := range s.svc.ConfigLoads {
+		if err := s.ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := s.countNamedUsages(configLoad.ConfigStruct.Type); err != nil {
+			return nil, err
+		}
+		if err := s.markRecursiveTypes(configLoad.ConfigStruct.Type, nil); err != nil {
 			return nil, err
 		}
 	}
 
 	// Add all the top level fields required by this service
-	for _, configLoad := range svc.ConfigLoads {
-		if err := service.registerTopLevelField(configLoad.ConfigStruct.Type); err != nil {
+	for _, configLoad := range s.svc.ConfigLoads {
+		if err := s.ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := s.registerTopLevelField(configLoad.ConfigStruct.Type); err != nil {
 			return nil, err
 		}
 	}
 
 	// For the first top level field in a service, if it's not go a comment above it, then we want to put it's label position
 	// as a new section. This forces a blank line between the type decelerations and the first field.
-	if len(service.topLevelFields) > 0 {
-		if field, ok := service.topLevelFields[0].(*ast.Field); ok {
+	if len(s.topLevelFields) > 0 {
+		if field, ok := s.topLevelFields[0].(*ast.Field); ok {
 			if !hasCommentInPosition(field, 0) {
 				if ident, ok := field.Label.(*ast.Ident); ok {
 					ident.NamePos = token.NewSection.Pos()
@@ -68,19 +486,33 @@ func (g *Generator) UserFacing(svc *est.Service) ([]byte, error) {
 	}
 
 	// Now generate the CUE
-	if err := service.generateCue(); err != nil {
+	if err := s.ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := s.generateCue(); err != nil {
 		return nil, err
 	}
 
 	// Cleanup the generated AST
-	if err := astutil.Sanitize(service.file); err != nil {
+	if err := astutil.Sanitize(s.file); err != nil {
 		return nil, err
 	}
 
-	// Format the AST into a set of bytes we can write
-	return format.Node(
-		service.file,
-		format.Simplify(),
-		format.UseSpaces(4),
-	)
+	return s.format()
+}
+
+// format formats the generated file into a set of bytes we can write
+func (s *service) format() ([]byte, error) {
+	opts := []format.Option{format.Simplify(), format.UseSpaces(4)}
+	if s.g.opts.IndentWidth > 0 {
+		opts = append(opts, format.UseSpaces(s.g.opts.IndentWidth), format.TabIndent(false))
+	}
+	f, err := format.Node(s.file, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if s.g.opts.EmitChecksum {
+		f = appendChecksum(f)
+	}
+	return f, nil
 }
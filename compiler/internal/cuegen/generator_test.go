@@ -1,17 +1,30 @@
 package cuegen
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"testing/fstest"
 
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/ast"
+	"cuelang.org/go/cue/cuecontext"
+	cueparser "cuelang.org/go/cue/parser"
+	"cuelang.org/go/encoding/openapi"
 	qt "github.com/frankban/quicktest"
 	"github.com/rogpeppe/go-internal/txtar"
 
 	"encr.dev/parser"
+	"encr.dev/parser/est"
+	"encr.dev/pkg/cueutil"
 	"encr.dev/pkg/golden"
+	schema "encr.dev/proto/encore/parser/schema/v1"
 )
 
 func TestMain(m *testing.M) {
@@ -26,32 +39,2211 @@ func TestCodeGen_TestMain(t *testing.T) {
 	}
 	c.Assert(err, qt.IsNil)
 
-	for i, test := range tests {
+	for _, test := range tests {
 		path := test
 		name := strings.TrimSuffix(filepath.Base(test), ".txt")
 		c.Run(name, func(c *qt.C) {
-			archiveData, err := os.ReadFile(path)
+			for svc, f := range generateFromArchive(c, path, nil) {
+				golden.TestAgainst(c.TB, fmt.Sprintf("%s_%s.cue", name, svc), string(f))
+			}
+		})
+	}
+}
+
+func TestCodeGen_Options(t *testing.T) {
+	c := qt.New(t)
+
+	tests := []struct {
+		name string
+		opts *Options
+	}{
+		{
+			name: "allow_extra_keys",
+			opts: &Options{AllowExtraKeys: []string{"metadata", "Name"}},
+		},
+		{
+			name: "environments",
+			opts: &Options{Environments: []string{"dev", "prod", "pr-preview"}},
+		},
+		{
+			name: "enum_values",
+			opts: &Options{EmitEnumValues: true},
+		},
+		{
+			name: "case_insensitive_enums",
+			opts: &Options{CaseInsensitiveEnums: true},
+		},
+		{
+			name: "inline_enums",
+			opts: &Options{InlineEnums: 2},
+		},
+		{
+			name: "string_length_in_bytes",
+			opts: &Options{StringLengthInBytes: true},
+		},
+		{
+			name: "string_content_rules",
+			opts: &Options{StringContentRules: true},
+		},
+		{
+			name: "length_attributes",
+			opts: &Options{LengthAttributes: true},
+		},
+		{
+			name: "collapse_single_field_structs",
+			opts: &Options{CollapseSingleFieldStructs: true},
+		},
+		{
+			name: "bound_attributes",
+			opts: &Options{BoundAttributes: true},
+		},
+		{
+			name: "constraint_attributes",
+			opts: &Options{ConstraintAttributes: true},
+		},
+		{
+			name: "custom_types",
+			opts: &Options{CustomTypes: map[string]string{"encore.app/money.Amount": "acme.com/cue/money.#Amount"}},
+		},
+		{
+			name: "define_named_types",
+			opts: &Options{DefineNamedTypes: true},
+		},
+		{
+			name: "doc_translate",
+			opts: &Options{DocTranslate: strings.NewReplacer("server", "serveur", "The ", "Le ").Replace},
+		},
+		{
+			name: "emit_required_attr",
+			opts: &Options{EmitRequiredAttr: true},
+		},
+		{
+			name: "null_default_pointers",
+			opts: &Options{NullablePointers: NullDefault},
+		},
+		{
+			name: "prune_empty",
+			opts: &Options{PruneEmpty: true},
+		},
+		{
+			name: "qualified_definition_names",
+			opts: &Options{QualifiedDefinitionNames: true, TrimPackagePrefix: "vendored/"},
+		},
+		{
+			name: "reference_comments",
+			opts: &Options{ReferenceComments: true},
+		},
+		{
+			name: "ordered_maps",
+			opts: &Options{OrderedMaps: true},
+		},
+		{
+			name: "sort_by_json_name",
+			opts: &Options{SortByJSONName: true},
+		},
+		{
+			name: "flattened_env_keys",
+			opts: &Options{FlattenedEnvKeys: true},
+		},
+		{
+			name: "openapi_compatible",
+			opts: &Options{OpenAPICompatible: true},
+		},
+		{
+			name: "schema_version",
+			opts: &Options{EmitSchemaVersion: true},
+		},
+		{
+			name: "field_policies",
+			opts: &Options{FieldPolicies: map[string]ast.Expr{
+				"database.port": mustParseExpr(c, ">=1024"),
+				"*.port":        mustParseExpr(c, "<65536"),
+				"#Endpoint.url": mustParseExpr(c, `=~"^https://"`),
+			}},
+		},
+		{
+			name: "version",
+			opts: &Options{Version: "v1.10.1"},
+		},
+		{
+			name: "shared_package",
+			opts: &Options{SharedPackage: "encore.app/config"},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		c.Run(test.name, func(c *qt.C) {
+			path := filepath.Join("testdata", "options", test.name+".txt")
+			for svc, f := range generateFromArchive(c, path, test.opts) {
+				golden.TestAgainst(c.TB, fmt.Sprintf("options/%s_%s.cue", test.name, svc), string(f))
+			}
+		})
+	}
+}
+
+func TestCodeGen_Deterministic(t *testing.T) {
+	c := qt.New(t)
+	tests, err := filepath.Glob("./testdata/*.txt")
+	c.Assert(err, qt.IsNil)
+
+	for _, test := range tests {
+		path := test
+		c.Run(strings.TrimSuffix(filepath.Base(path), ".txt"), func(c *qt.C) {
+			res := parseArchive(c, path)
+
+			// Generate with a fresh generator each time, so nothing is carried over between runs
+			want := make(map[string][]byte)
+			for i := 0; i < 20; i++ {
+				gen := NewGenerator(res, nil)
+				for _, svc := range res.App.Services {
+					f, err := gen.UserFacing(svc)
+					c.Assert(err, qt.IsNil)
+					if i == 0 {
+						want[svc.Name] = f
+					} else {
+						c.Assert(string(f), qt.Equals, string(want[svc.Name]), qt.Commentf("run %d of service %s", i, svc.Name))
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCodeGen_StableDefinitionNames(t *testing.T) {
+	c := qt.New(t)
+	res := parseArchive(c, "testdata/types_from_multiple_packages.txt")
+	svc := res.App.Services[0]
+	want, err := NewGenerator(res, nil).UserFacing(svc)
+	c.Assert(err, qt.IsNil)
+
+	// Reversing the fields changes which of the types with the same name is found first,
+	// but the definitions keep their names so only the order of the fields changes
+	fields := res.Meta.Decls[svc.ConfigLoads[0].ConfigStruct.Type.GetNamed().Id].Type.GetStruct().Fields
+	for i, j := 0, len(fields)-1; i < j; i, j = i+1, j-1 {
+		fields[i], fields[j] = fields[j], fields[i]
+	}
+	got, err := NewGenerator(res, nil).UserFacing(svc)
+	c.Assert(err, qt.IsNil)
+
+	_, wantDefs, _ := strings.Cut(string(want), "#Config\n")
+	_, gotDefs, _ := strings.Cut(string(got), "#Config\n")
+	c.Assert(gotDefs, qt.Equals, wantDefs)
+	c.Assert(string(got), qt.Contains, "D: #ExtraConfig_1\n")
+}
+
+func TestCodeGen_PackageName(t *testing.T) {
+	c := qt.New(t)
+
+	tests := []struct {
+		name    string
+		svcName string
+		opts    *Options
+		want    string
+	}{
+		{name: "default", svcName: "svc", want: "package svc"},
+		{name: "hyphenated", svcName: "my-svc", want: "package my_svc"},
+		{name: "leading_digit", svcName: "9lives", want: "package svc_9lives"},
+		{name: "keyword", svcName: "if", want: "package if_"},
+		{
+			name:    "override",
+			svcName: "my-svc",
+			opts:    &Options{PackageName: func(svc *est.Service) string { return "config_" + strings.ReplaceAll(svc.Name, "-", "") }},
+			want:    "package config_mysvc",
+		},
+	}
+	for _, test := range tests {
+		test := test
+		c.Run(test.name, func(c *qt.C) {
+			res := parseArchive(c, "testdata/basic_config.txt")
+			svc := res.App.Services[0]
+			svc.Name = test.svcName
+
+			f, err := NewGenerator(res, test.opts).UserFacing(svc)
+			c.Assert(err, qt.IsNil)
+			c.Assert(strings.Contains(string(f), "\n"+test.want+"\n"), qt.IsTrue, qt.Commentf("got:\n%s", f))
+
+			_, err = cuecontext.New().CompileBytes(f).Fields()
 			c.Assert(err, qt.IsNil)
-			a := txtar.Parse(archiveData)
-			base := c.TempDir()
-			err = txtar.Write(a, base)
-			c.Assert(err, qt.IsNil, qt.Commentf("test #%d", i))
-
-			res, err := parser.Parse(&parser.Config{
-				AppRoot:    base,
-				ModulePath: "encore.app",
-				WorkingDir: ".",
-			})
+		})
+	}
+
+	// Overrides must still be valid package names
+	res := parseArchive(c, "testdata/basic_config.txt")
+	_, err := NewGenerator(res, &Options{PackageName: func(*est.Service) string { return "my-svc" }}).UserFacing(res.App.Services[0])
+	c.Assert(err, qt.ErrorMatches, `invalid package name "my-svc" for service svc: must be a valid CUE identifier`)
+}
+
+func TestCodeGen_ServiceMetadata(t *testing.T) {
+	c := qt.New(t)
+	res := parseArchive(c, "testdata/basic_config.txt")
+	svc := res.App.Services[0]
+
+	opts := &Options{
+		Version: "v1.10.1",
+		ServiceMetadata: func(svc *est.Service) map[string]string {
+			return map[string]string{
+				"owner":   "payments-team",
+				"doc":     "https://wiki.example.com/" + svc.Name,
+				"channel": "#payments",
+			}
+		},
+	}
+
+	// The metadata follows the rest of the header, ordered by key
+	want := strings.Join([]string{
+		"// Generated by Encore v1.10.1",
+		"//",
+		"// channel: #payments",
+		"// doc: https://wiki.example.com/svc",
+		"// owner: payments-team",
+		"package svc",
+	}, "\n")
+	for i := 0; i < 10; i++ {
+		f, err := NewGenerator(res, opts).UserFacing(svc)
+		c.Assert(err, qt.IsNil)
+		c.Assert(string(f), qt.Contains, want)
+	}
+
+	// Metadata must fit on a single comment line
+	_, err := NewGenerator(res, &Options{ServiceMetadata: func(*est.Service) map[string]string {
+		return map[string]string{"owner": "payments\nteam"}
+	}}).UserFacing(svc)
+	c.Assert(err, qt.ErrorMatches, `invalid metadata "owner" for service svc: must be a single line`)
+}
+
+func TestCodeGen_IndentWidth(t *testing.T) {
+	c := qt.New(t)
+	res := parseArchive(c, "testdata/basic_named_struct_multiple_uses.txt")
+	svc := res.App.Services[0]
+
+	tabs, err := NewGenerator(res, nil).UserFacing(svc)
+	c.Assert(err, qt.IsNil)
+	c.Assert(string(tabs), qt.Contains, "\n\tEnabled:")
+
+	// The same file is generated, with each tab replaced by the given number of spaces
+	spaces, err := NewGenerator(res, &Options{IndentWidth: 2}).UserFacing(svc)
+	c.Assert(err, qt.IsNil)
+	c.Assert(string(spaces), qt.Not(qt.Contains), "\t")
+	c.Assert(string(spaces), qt.Equals, strings.ReplaceAll(string(tabs), "\t", "  "))
+
+	_, err = cuecontext.New().CompileBytes(spaces).Fields()
+	c.Assert(err, qt.IsNil)
+}
+
+func TestCodeGen_DefinitionOrder(t *testing.T) {
+	c := qt.New(t)
+
+	// Fixtures where no two definitions share a base name, as those are numbered in the order they're found
+	for _, name := range []string{"basic_named_struct_multiple_uses", "generic_named_types", "recursive_containers"} {
+		name := name
+		c.Run(name, func(c *qt.C) {
+			res := parseArchive(c, filepath.Join("testdata", name+".txt"))
+			gen := NewGenerator(res, nil)
+			svc := res.App.Services[0]
+
+			want, err := gen.UserFacing(svc)
 			c.Assert(err, qt.IsNil)
 
-			gen := NewGenerator(res)
+			var named []*schema.Named
+			for _, configLoad := range svc.ConfigLoads {
+				err := schema.Walk(res.Meta.Decls, configLoad.ConfigStruct.Type, func(node any) error {
+					if n, ok := node.(*schema.Named); ok {
+						named = append(named, n)
+					}
+					return nil
+				})
+				c.Assert(err, qt.IsNil)
+			}
+
+			// Find the named types in a different order before generating
+			for seed := int64(0); seed < 10; seed++ {
+				rand.New(rand.NewSource(seed)).Shuffle(len(named), func(i, j int) {
+					named[i], named[j] = named[j], named[i]
+				})
 
-			for _, svc := range res.App.Services {
-				f, err := gen.UserFacing(svc)
+				s := gen.newService(context.Background(), svc)
+				for _, n := range named {
+					s.typeUsage.ID(n)
+				}
+				got, err := s.generate()
 				c.Assert(err, qt.IsNil)
+				c.Assert(string(got), qt.Equals, string(want), qt.Commentf("seed %d", seed))
+			}
+		})
+	}
+}
+
+func TestCodeGen_AllowExtraKeysIsClosed(t *testing.T) {
+	c := qt.New(t)
+	files := generateFromArchive(c, "testdata/options/allow_extra_keys.txt", &Options{AllowExtraKeys: []string{"metadata"}})
+
+	ctx := cuecontext.New()
+	schema := ctx.CompileBytes(files["svc"])
+	c.Assert(schema.Err(), qt.IsNil)
+
+	valid := schema.Unify(ctx.CompileString(`{Name: "foo", Port: 8080, metadata: {region: "eu"}}`))
+	c.Assert(valid.Validate(), qt.IsNil)
+
+	invalid := schema.Unify(ctx.CompileString(`{Name: "foo", Port: 8080, other: true}`))
+	c.Assert(invalid.Validate(), qt.ErrorMatches, `.*field not allowed.*`)
+}
+
+func TestCodeGen_StringLengthModes(t *testing.T) {
+	c := qt.New(t)
+
+	// "héllo" is 5 runes, but 6 bytes long
+	const data = `{Name: "héllo", Code: "abc", Replicas: 1, Ratio: 0.1, Hosts: ["a"], Zones: ["a", "b"], Labels: {}}`
+
+	tests := []struct {
+		name  string
+		opts  *Options
+		valid bool
+	}{
+		{name: "runes", opts: nil, valid: true},
+		{name: "bytes", opts: &Options{StringLengthInBytes: true}, valid: false},
+	}
 
-				golden.TestAgainst(c.TB, fmt.Sprintf("%s_%s.cue", name, svc.Name), string(f))
+	for _, test := range tests {
+		test := test
+		c.Run(test.name, func(c *qt.C) {
+			files := generateFromArchive(c, "testdata/validate_lengths.txt", test.opts)
+
+			ctx := cuecontext.New()
+			schema := ctx.CompileBytes(files["svc"])
+
+			err := schema.Unify(ctx.CompileString(data)).Validate(cue.Concrete(true))
+			if test.valid {
+				c.Assert(err, qt.IsNil)
+			} else {
+				c.Assert(err, qt.IsNotNil)
 			}
 		})
 	}
 }
+
+func TestCodeGen_StringContentRules(t *testing.T) {
+	c := qt.New(t)
+	files := generateFromArchive(c, "testdata/options/string_content_rules.txt", &Options{StringContentRules: true})
+
+	ctx := cuecontext.New()
+	schema := ctx.CompileBytes(files["svc"])
+	c.Assert(schema.Err(), qt.IsNil)
+
+	tests := []struct {
+		name  string
+		data  string
+		valid bool
+	}{
+		{"valid", `{BaseURL: "https://example.com", Bucket: "logs.s3", Email: "a@b.c", Prefixed: "v1.api/"}`, true},
+		{"startswith", `{BaseURL: "http://example.com", Bucket: "logs.s3", Email: "a@b.c", Prefixed: "v1.api/"}`, false},
+		{"endswith", `{BaseURL: "https://example.com", Bucket: "logs", Email: "a@b.c", Prefixed: "v1.api/"}`, false},
+		{"contains", `{BaseURL: "https://example.com", Bucket: "logs.s3", Email: "ab.c", Prefixed: "v1.api/"}`, false},
+		{"startswith_quoted", `{BaseURL: "https://example.com", Bucket: "logs.s3", Email: "a@b.c", Prefixed: "v1xapi/"}`, false},
+	}
+	for _, test := range tests {
+		err := schema.Unify(ctx.CompileString(test.data)).Validate(cue.Concrete(true))
+		if test.valid {
+			c.Check(err, qt.IsNil, qt.Commentf(test.name))
+		} else {
+			c.Check(err, qt.IsNotNil, qt.Commentf(test.name))
+		}
+	}
+
+	// Without the option the rules are left to be checked at runtime
+	files = generateFromArchive(c, "testdata/options/string_content_rules.txt", nil)
+	c.Assert(strings.Contains(string(files["svc"]), "=~"), qt.IsFalse)
+}
+
+func TestCodeGen_SchemaVersion(t *testing.T) {
+	c := qt.New(t)
+	const path = "testdata/options/schema_version.txt"
+
+	version := func(files map[string][]byte) string {
+		ctx := cuecontext.New()
+		schema := ctx.CompileBytes(files["svc"])
+		c.Assert(schema.Err(), qt.IsNil)
+		version, err := schema.LookupPath(cue.MakePath(cue.Str("$version"))).String()
+		c.Assert(err, qt.IsNil)
+		return version
+	}
+
+	// The hash is stable for unchanged input
+	hash := version(generateFromArchive(c, path, &Options{EmitSchemaVersion: true}))
+	c.Assert(hash, qt.HasLen, 16)
+	c.Assert(version(generateFromArchive(c, path, &Options{EmitSchemaVersion: true})), qt.Equals, hash)
+
+	// But changes when the schema does
+	changed := version(generateFromArchive(c, path, &Options{EmitSchemaVersion: true, StringLengthInBytes: true, ReferenceComments: true}))
+	c.Assert(changed, qt.Not(qt.Equals), hash)
+
+	// An explicit version is used as is, and config for another version is rejected
+	files := generateFromArchive(c, path, &Options{EmitSchemaVersion: true, SchemaVersion: "v2"})
+	c.Assert(version(files), qt.Equals, "v2")
+
+	ctx := cuecontext.New()
+	schema := ctx.CompileBytes(files["svc"])
+	data := `{Primary: {Host: "a", Port: 1}, Secondary: {Host: "b", Port: 2}, Name: "svc", "$version": "%s"}`
+	c.Assert(schema.Unify(ctx.CompileString(fmt.Sprintf(data, "v2"))).Validate(cue.Concrete(true)), qt.IsNil)
+	c.Assert(schema.Unify(ctx.CompileString(fmt.Sprintf(data, "v1"))).Validate(cue.Concrete(true)), qt.IsNotNil)
+}
+
+func TestCodeGen_LengthAttributes(t *testing.T) {
+	c := qt.New(t)
+	files := generateFromArchive(c, "testdata/options/length_attributes.txt", &Options{LengthAttributes: true})
+	svc := string(files["svc"])
+
+	// The native constraints are generated alongside the attributes mirroring them
+	for _, want := range []string{
+		`string & strings.MinRunes(1) & strings.MaxRunes(5) @minLength(1) @maxLength(5)`,
+		`[_, ...] & list.MaxItems(3) @minItems(1) @maxItems(3)`,
+	} {
+		c.Assert(strings.Contains(svc, want), qt.IsTrue, qt.Commentf("missing %q in:\n%s", want, svc))
+	}
+}
+
+func TestCodeGen_CollapseSingleFieldStructs(t *testing.T) {
+	c := qt.New(t)
+	files := generateFromArchive(c, "testdata/options/collapse_single_field_structs.txt", &Options{CollapseSingleFieldStructs: true})
+
+	ctx := cuecontext.New()
+	cueSchema := ctx.CompileBytes(files["svc"])
+	c.Assert(cueSchema.Err(), qt.IsNil)
+
+	// Single field structs are given as the value of their field, which keeps its constraints and default,
+	// while structs with many fields or an optional field are unchanged
+	for data, valid := range map[string]bool{
+		`{Name: "a", Timeout: 5, Retries: 3, Server: {Host: "h", Port: 1}, Optional: {}}`:            true,
+		`{Name: "a", Retries: 3, Server: {Host: "h", Port: 1}, Optional: {Value: "v"}, Backup: 10}`:  true,
+		`{Name: "a", Timeout: 0, Retries: 3, Server: {Host: "h", Port: 1}, Optional: {}}`:            false,
+		`{Name: "a", Timeout: 5, Retries: 10, Server: {Host: "h", Port: 1}, Optional: {}}`:           false,
+		`{Name: "a", Timeout: {Seconds: 5}, Retries: 3, Server: {Host: "h", Port: 1}, Optional: {}}`: false,
+		`{Name: "a", Timeout: 5, Retries: {Max: 3}, Server: {Host: "h", Port: 1}, Optional: {}}`:     false,
+	} {
+		err := cueSchema.Unify(ctx.CompileString(data)).Validate(cue.Concrete(true))
+		c.Check(err == nil, qt.Equals, valid, qt.Commentf("data %s: %v", data, err))
+	}
+
+	// Without the option, no struct is collapsed
+	files = generateFromArchive(c, "testdata/options/collapse_single_field_structs.txt", nil)
+	c.Assert(string(files["svc"]), qt.Contains, "Seconds:")
+	c.Assert(string(files["svc"]), qt.Contains, "Max:")
+}
+
+func TestCodeGen_BoundAttributes(t *testing.T) {
+	c := qt.New(t)
+	files := generateFromArchive(c, "testdata/options/bound_attributes.txt", &Options{BoundAttributes: true})
+	svc := string(files["svc"])
+
+	// The native bounds are generated alongside the attributes mirroring them, which take
+	// the tighter of the validate rules and the range of the type
+	for _, want := range []string{
+		`Port:    uint16 & >=1         @minimum(1) @maximum(65535)`,
+		`Retries: int & >=0 & <=10     @minimum(0) @maximum(10)`,
+		`Ratio:   float64 & <=1.5      @maximum(1.5)`,
+		`Level:   int8                 @minimum(-128) @maximum(127)`,
+		`Offset:  uint8 & >=-5 & <=300 @minimum(0) @maximum(255)`,
+		"Count:   int\n",
+		"Name:    string & strings.MinRunes(1)\n",
+	} {
+		c.Check(strings.Contains(svc, want), qt.IsTrue, qt.Commentf("missing %q in:\n%s", want, svc))
+	}
+}
+
+func TestCodeGen_ConstraintAttributes(t *testing.T) {
+	c := qt.New(t)
+	res := parseArchive(c, "testdata/options/constraint_attributes.txt")
+
+	var report bytes.Buffer
+	opts := &Options{ConstraintAttributes: true, DiagnosticsReport: &report}
+	files, err := NewGenerator(res, opts).GenerateAllWithContext(context.Background(), res.App.Services)
+	c.Assert(err, qt.IsNil)
+
+	ctx := cuecontext.New()
+	cueSchema := ctx.CompileBytes(files["svc"]).LookupPath(cue.ParsePath("#Config"))
+	c.Assert(cueSchema.Err(), qt.IsNil)
+
+	// Regular expressions are mirrored as patterns, and bounds as minimums and maximums
+	for path, want := range map[string]map[string]string{
+		"Name":    {"pattern": "^[a-z]+$"},
+		"Slug":    {"pattern": `^[a-z\d-]+$`},
+		"Quoted":  {"pattern": `^"[a-z]+"$`},
+		"Percent": {"exclusiveMinimum": "0", "exclusiveMaximum": "100"},
+		"Ratio":   {"minimum": "0.0", "maximum": "1.0"},
+	} {
+		field := cueSchema.LookupPath(cue.ParsePath(path))
+		for keyword, value := range want {
+			attr := field.Attribute(keyword)
+			c.Assert(attr.Err(), qt.IsNil, qt.Commentf("field %s, keyword %s", path, keyword))
+			got, err := attr.String(0)
+			c.Assert(err, qt.IsNil)
+			c.Check(got, qt.Equals, value, qt.Commentf("field %s, keyword %s", path, keyword))
+		}
+	}
+
+	// Constraints without an equivalent keyword are reported
+	c.Assert(report.String(), qt.JSONEquals, map[string]any{
+		"diagnostics": []any{
+			map[string]any{
+				"service":  "svc",
+				"field":    "Name",
+				"severity": "warning",
+				"message":  `the cue constraint "!=\"admin\"" has no equivalent JSON Schema keyword`,
+			},
+		},
+	})
+}
+
+// generateFromArchive parses the app within the txtar archive at path and returns
+// the generated CUE file for each service, keyed by service name.
+func TestCodeGen_BoolDefaultsAndConsts(t *testing.T) {
+	c := qt.New(t)
+	files := generateFromArchive(c, "testdata/bool_defaults.txt", nil)
+
+	ctx := cuecontext.New()
+	schema := ctx.CompileBytes(files["svc"])
+	c.Assert(schema.Err(), qt.IsNil)
+
+	// Defaults are used when no value is given, but can be overridden
+	value := schema.Unify(ctx.CompileString(`{Verbose: true, Strict: true}`))
+	c.Assert(value.Validate(cue.Concrete(true)), qt.IsNil)
+	enabled, err := value.LookupPath(cue.ParsePath("Enabled")).Bool()
+	c.Assert(err, qt.IsNil)
+	c.Assert(enabled, qt.IsTrue)
+
+	// Consts can not be changed
+	invalid := schema.Unify(ctx.CompileString(`{Strict: false}`))
+	c.Assert(invalid.Validate(cue.Concrete(true)), qt.IsNotNil)
+}
+
+func TestCodeGen_DefaultTag(t *testing.T) {
+	c := qt.New(t)
+	files := generateFromArchive(c, "testdata/default_tag.txt", nil)
+
+	ctx := cuecontext.New()
+	cueSchema := ctx.CompileBytes(files["svc"])
+	c.Assert(cueSchema.Err(), qt.IsNil)
+
+	// Only fields without a default need to be given
+	c.Assert(cueSchema.Validate(cue.Concrete(true)), qt.IsNotNil)
+	value := cueSchema.Unify(ctx.CompileString(`{Replicas: 3}`))
+	c.Assert(value.Validate(cue.Concrete(true)), qt.IsNil)
+	port, err := value.LookupPath(cue.ParsePath("Port")).Int64()
+	c.Assert(err, qt.IsNil)
+	c.Assert(port, qt.Equals, int64(8080))
+	timeout, err := value.LookupPath(cue.ParsePath("Timeout")).String()
+	c.Assert(err, qt.IsNil)
+	c.Assert(timeout, qt.Equals, "30s")
+
+	// Defaults can be overridden
+	value = cueSchema.Unify(ctx.CompileString(`{Replicas: 3, Port: 9090}`))
+	port, err = value.LookupPath(cue.ParsePath("Port")).Int64()
+	c.Assert(err, qt.IsNil)
+	c.Assert(port, qt.Equals, int64(9090))
+
+	// Defaults must be valid values of the field type
+	tests := []struct {
+		field int
+		value string
+		err   string
+	}{
+		{0, "eighty", `field Port: default value "eighty" is not a valid number`},
+		{3, "30", `field Timeout: default value "30" is not a valid duration`},
+	}
+	for _, test := range tests {
+		res := parseArchive(c, "testdata/default_tag.txt")
+		svc := res.App.Services[0]
+		fields := res.Meta.Decls[svc.ConfigLoads[0].ConfigStruct.Type.GetNamed().Id].Type.GetStruct().Fields
+		fields[test.field].Tags[0].Name = test.value
+		_, err := NewGenerator(res, nil).UserFacing(svc)
+		c.Assert(err, qt.ErrorMatches, test.err)
+	}
+}
+
+func TestCodeGen_RecursivePointers(t *testing.T) {
+	c := qt.New(t)
+	files := generateFromArchive(c, "testdata/recursive_pointers.txt", nil)
+
+	ctx := cuecontext.New()
+	cueSchema := ctx.CompileBytes(files["svc"])
+	c.Assert(cueSchema.Err(), qt.IsNil)
+
+	// The recursion ends where a pointer is left out
+	value := cueSchema.Unify(ctx.CompileString(`{
+		Chain: {Name: "a", Next: {Name: "b", Next: {Name: "c"}}}
+		Ping: {Pong: {Ping: {}}}
+		Wrapped: {Inner: {Inner: {}}}
+		Branch: {Leaf: {Branch: {}}}
+	}`))
+	c.Assert(value.Validate(cue.Concrete(true)), qt.IsNil)
+
+	// But the types of the values within it are still checked
+	value = cueSchema.Unify(ctx.CompileString(`{Chain: {Name: "a", Next: {Name: 1}}, Ping: {}, Wrapped: {}, Branch: {}}`))
+	c.Assert(value.Validate(cue.Concrete(true)), qt.IsNotNil)
+}
+
+func TestCodeGen_MapKeys(t *testing.T) {
+	c := qt.New(t)
+	files := generateFromArchive(c, "testdata/map_keys.txt", nil)
+
+	ctx := cuecontext.New()
+	cueSchema := ctx.CompileBytes(files["svc"])
+	c.Assert(cueSchema.Err(), qt.IsNil)
+
+	valid := `ByID: {"-1": "a", "2": "b"}
+		Small: {"255": "a"}
+		Signed: {}
+		ByUUID: {"6ba7b810-9dad-11d1-80b4-00c04fd430c8": "a"}
+		ByTime: {"2022-10-20T12:00:00Z": "a"}
+		ByLevel: {"1": "high"}`
+	value := cueSchema.Unify(ctx.CompileString(valid))
+	c.Assert(value.Validate(cue.Concrete(true)), qt.IsNil)
+
+	// Keys which can't be converted to the key type are rejected
+	tests := []string{
+		`ByID: {"one": "a"}`,
+		`Small: {"-1": "a"}`,
+		`ByUUID: {"not-a-uuid": "a"}`,
+		`ByLevel: {"2": "a"}`,
+	}
+	for _, test := range tests {
+		value := cueSchema.Unify(ctx.CompileString(valid)).Unify(ctx.CompileString(test))
+		c.Assert(value.Validate(cue.Concrete(true)), qt.IsNotNil, qt.Commentf("%s", test))
+	}
+}
+
+func TestCodeGen_EnvVars(t *testing.T) {
+	c := qt.New(t)
+	files := generateFromArchive(c, "testdata/env_vars.txt", nil)
+
+	ctx := cuecontext.New()
+	cueSchema := ctx.CompileBytes(files["svc"])
+	c.Assert(cueSchema.Err(), qt.IsNil)
+
+	// Fields read from environment variables don't need to be given
+	value := cueSchema.Unify(ctx.CompileString(`{Hosts: []}`))
+	c.Assert(value.Validate(cue.Concrete(true)), qt.IsNil)
+
+	// But if they are, the value is used when the variable isn't set
+	value = cueSchema.Unify(ctx.CompileString(`{Hosts: [], DatabaseURL: "postgres://localhost", Workers: 4}`))
+	c.Assert(value.Validate(cue.Concrete(true)), qt.IsNil)
+	attr := value.LookupPath(cue.ParsePath("DatabaseURL")).Attribute("env")
+	c.Assert(attr.Err(), qt.IsNil)
+	name, err := attr.String(0)
+	c.Assert(err, qt.IsNil)
+	c.Assert(name, qt.Equals, "DATABASE_URL")
+
+	// Only scalar fields can be read from a valid environment variable name
+	tests := []struct {
+		field int
+		name  string
+		err   string
+	}{
+		{0, "DATABASE-URL", `field DatabaseURL: invalid environment variable name "DATABASE-URL"`},
+		{5, "HOSTS", `field Hosts: only string, bool, numeric and duration fields can be read from an environment variable`},
+	}
+	for _, test := range tests {
+		res := parseArchive(c, "testdata/env_vars.txt")
+		svc := res.App.Services[0]
+		fields := res.Meta.Decls[svc.ConfigLoads[0].ConfigStruct.Type.GetNamed().Id].Type.GetStruct().Fields
+		fields[test.field].Tags = []*schema.Tag{{Key: "envvar", Name: test.name}}
+		_, err := NewGenerator(res, nil).UserFacing(svc)
+		c.Assert(err, qt.ErrorMatches, test.err)
+	}
+}
+
+func TestCodeGen_UniqueListItems(t *testing.T) {
+	c := qt.New(t)
+	files := generateFromArchive(c, "testdata/validate_unique.txt", nil)
+
+	ctx := cuecontext.New()
+	schema := ctx.CompileBytes(files["svc"])
+	c.Assert(schema.Err(), qt.IsNil)
+
+	tests := []struct {
+		name  string
+		data  string
+		valid bool
+	}{
+		{"unique", `{Servers: [{name: "a", Host: "x"}, {name: "b", Host: "x"}], Regions: ["eu", "us"]}`, true},
+		{"duplicate_key", `{Servers: [{name: "a", Host: "x"}, {name: "a", Host: "y"}], Regions: []}`, false},
+		{"duplicate_item", `{Servers: [], Regions: ["eu", "eu"]}`, false},
+	}
+	for _, test := range tests {
+		err := schema.Unify(ctx.CompileString(test.data)).Validate(cue.Concrete(true))
+		if test.valid {
+			c.Check(err, qt.IsNil, qt.Commentf(test.name))
+		} else {
+			c.Check(err, qt.IsNotNil, qt.Commentf(test.name))
+		}
+	}
+}
+
+func TestCodeGen_ValidateRules(t *testing.T) {
+	c := qt.New(t)
+	files := generateFromArchive(c, "testdata/validate_rules.txt", nil)
+
+	ctx := cuecontext.New()
+	cueSchema := ctx.CompileBytes(files["svc"])
+	c.Assert(cueSchema.Err(), qt.IsNil)
+
+	valid := map[string]string{
+		"Port":     "8080",
+		"Ratio":    "0.5",
+		"Name":     `"abc"`,
+		"Tags":     `["a"]`,
+		"Region":   `"ap south"`,
+		"Priority": "2",
+		"Contact":  `"ops@example.com"`,
+		"Homepage": `"https://example.com/path"`,
+		"ID":       `"123e4567-e89b-12d3-a456-426614174000"`,
+		"Code":     `"ABC123"`,
+		"Address":  `"10.0.0.1"`,
+		"Version":  `"-1.5"`,
+	}
+	data := func(overrides map[string]string) string {
+		var fields []string
+		for label, value := range valid {
+			if override, found := overrides[label]; found {
+				value = override
+			}
+			fields = append(fields, label+": "+value)
+		}
+		return "{" + strings.Join(fields, ", ") + "}"
+	}
+	c.Assert(cueSchema.Unify(ctx.CompileString(data(nil))).Validate(cue.Concrete(true)), qt.IsNil)
+
+	// Each rule rejects the values the validator would reject at runtime
+	for label, invalid := range map[string][]string{
+		"Port":     {"1024", "65536"},
+		"Ratio":    {"-0.1", "1.0"},
+		"Name":     {`"ab"`, `"abcdefghij"`},
+		"Tags":     {"[]"},
+		"Region":   {`"ap"`, `"south"`},
+		"Priority": {"4"},
+		"Contact":  {`"ops"`, `"ops@example"`},
+		"Homepage": {`"example.com"`},
+		"ID":       {`"123E4567-E89B-12D3-A456-426614174000"`, `"123e4567"`},
+		"Code":     {`"abc123"`, `"ABC-123"`},
+		"Address":  {`"::1"`, `"10.0.0"`},
+		"Version":  {`"1.2.3"`, `"v1"`},
+	} {
+		for _, value := range invalid {
+			err := cueSchema.Unify(ctx.CompileString(data(map[string]string{label: value}))).Validate(cue.Concrete(true))
+			c.Check(err, qt.IsNotNil, qt.Commentf("%s: %s", label, value))
+		}
+	}
+
+	// Rules on types CUE can't check them on are left to the validator
+	res := parseArchive(c, "testdata/validate_rules.txt")
+	svc := res.App.Services[0]
+	fields := res.Meta.Decls[svc.ConfigLoads[0].ConfigStruct.Type.GetNamed().Id].Type.GetStruct().Fields
+	fields[6].Typ = &schema.Type{Typ: &schema.Type_Builtin{Builtin: schema.Builtin_INT}}
+	fields[5].Typ = &schema.Type{Typ: &schema.Type_Builtin{Builtin: schema.Builtin_FLOAT64}}
+	file, err := NewGenerator(res, nil).UserFacing(svc)
+	c.Assert(err, qt.IsNil)
+	c.Assert(string(file), qt.Matches, `(?s).*\tContact: +int\n.*`)
+	c.Assert(string(file), qt.Matches, `(?s).*\tPriority: +float64\n.*`)
+}
+
+func TestCodeGen_ValidateDive(t *testing.T) {
+	c := qt.New(t)
+	files := generateFromArchive(c, "testdata/validate_dive.txt", nil)
+
+	ctx := cuecontext.New()
+	cueSchema := ctx.CompileBytes(files["svc"])
+	c.Assert(cueSchema.Err(), qt.IsNil)
+
+	tests := []struct {
+		name  string
+		data  string
+		valid bool
+	}{
+		{"valid", `{Recipients: ["ops@example.com"], Hosts: ["db1"], Weights: {a: 1}, Nickname: "bob", Mirrors: ["a", "b"], Timeout: "1s"}`, true},
+		{"empty", `{Recipients: [], Hosts: ["db1"], Weights: {}, Nickname: "", Mirrors: [], Timeout: "1s"}`, true},
+		{"invalid_recipient", `{Recipients: ["ops"], Hosts: ["db1"], Weights: {}, Nickname: "", Mirrors: [], Timeout: "1s"}`, false},
+		{"no_hosts", `{Recipients: [], Hosts: [], Weights: {}, Nickname: "", Mirrors: [], Timeout: "1s"}`, false},
+		{"short_host", `{Recipients: [], Hosts: ["db1", "db"], Weights: {}, Nickname: "", Mirrors: [], Timeout: "1s"}`, false},
+		{"invalid_weight", `{Recipients: [], Hosts: ["db1"], Weights: {a: 0}, Nickname: "", Mirrors: [], Timeout: "1s"}`, false},
+		{"short_nickname", `{Recipients: [], Hosts: ["db1"], Weights: {}, Nickname: "bo", Mirrors: [], Timeout: "1s"}`, false},
+		{"one_mirror", `{Recipients: [], Hosts: ["db1"], Weights: {}, Nickname: "", Mirrors: ["a"], Timeout: "1s"}`, false},
+	}
+	for _, test := range tests {
+		err := cueSchema.Unify(ctx.CompileString(test.data)).Validate(cue.Concrete(true))
+		if test.valid {
+			c.Check(err, qt.IsNil, qt.Commentf(test.name))
+		} else {
+			c.Check(err, qt.IsNotNil, qt.Commentf(test.name))
+		}
+	}
+}
+
+func TestCodeGen_PathValidation(t *testing.T) {
+	c := qt.New(t)
+	files := generateFromArchive(c, "testdata/validate_paths.txt", nil)
+
+	ctx := cuecontext.New()
+	cueSchema := ctx.CompileBytes(files["svc"])
+	c.Assert(cueSchema.Err(), qt.IsNil)
+
+	// Paths are annotated with their format, while other strings are not
+	config := cueSchema.LookupPath(cue.ParsePath("#Config"))
+	for _, label := range []string{"DataDir", "ConfigFile", "CertFile"} {
+		attr := config.LookupPath(cue.ParsePath(label)).Attribute("format")
+		format, err := attr.String(0)
+		c.Assert(err, qt.IsNil, qt.Commentf("field %s", label))
+		c.Check(format, qt.Equals, "path")
+	}
+	attr := config.LookupPath(cue.ParsePath("Name")).Attribute("format")
+	c.Assert(attr.Err(), qt.IsNotNil)
+
+	tests := []struct {
+		name  string
+		data  string
+		valid bool
+	}{
+		{"paths", `{DataDir: "/var/data", ConfigFile: "config.yaml", CertFile: "C:\\certs\\a.pem", Name: ""}`, true},
+		{"empty_dir", `{DataDir: "", ConfigFile: "config.yaml", CertFile: "a.pem", Name: ""}`, false},
+		{"empty_filepath", `{DataDir: "/var/data", ConfigFile: "", CertFile: "a.pem", Name: ""}`, false},
+		{"null_byte", `{DataDir: "/var/data", ConfigFile: "a\u0000b", CertFile: "a.pem", Name: ""}`, false},
+	}
+	for _, test := range tests {
+		err := cueSchema.Unify(ctx.CompileString(test.data)).Validate(cue.Concrete(true))
+		if test.valid {
+			c.Check(err, qt.IsNil, qt.Commentf(test.name))
+		} else {
+			c.Check(err, qt.IsNotNil, qt.Commentf(test.name))
+		}
+	}
+
+	// Paths can only be held by strings, so the rule is left to the validator on other types
+	res := parseArchive(c, "testdata/validate_paths.txt")
+	svc := res.App.Services[0]
+	fields := res.Meta.Decls[svc.ConfigLoads[0].ConfigStruct.Type.GetNamed().Id].Type.GetStruct().Fields
+	fields[0].Typ = &schema.Type{Typ: &schema.Type_Builtin{Builtin: schema.Builtin_INT}}
+	file, err := NewGenerator(res, nil).UserFacing(svc)
+	c.Assert(err, qt.IsNil)
+	c.Assert(string(file), qt.Not(qt.Contains), "DataDir: int &")
+}
+
+func TestCodeGen_RequiredUnless(t *testing.T) {
+	c := qt.New(t)
+	files := generateFromArchive(c, "testdata/validate_required_unless.txt", nil)
+
+	// The conditions can't be evaluated until the config is given, so the schema is incomplete on its own
+	ctx := cuecontext.New()
+	schema := ctx.CompileBytes(files["svc"])
+	c.Assert(schema.Validate(), qt.IsNil)
+
+	tests := []struct {
+		name  string
+		data  string
+		valid bool
+	}{
+		{"manual", `{Mode: "manual", Region: "local"}`, true},
+		{"manual_other_region", `{Mode: "manual", Region: "eu", Token: "t"}`, false},
+		{"manual_other_region_with_bucket", `{Mode: "manual", Region: "eu", bucket: "b"}`, true},
+		{"auto", `{Mode: "auto", Region: "local", bucket: "b"}`, false},
+		{"auto_with_token", `{Mode: "auto", Region: "local", Token: "t", bucket: "b"}`, true},
+		{"mode_not_set", `{Region: "local", bucket: "b"}`, false},
+		{"mode_not_set_with_token", `{Region: "local", Token: "t", bucket: "b"}`, true},
+	}
+	for _, test := range tests {
+		err := schema.Unify(ctx.CompileString(test.data)).Validate(cue.Concrete(true))
+		if test.valid {
+			c.Check(err, qt.IsNil, qt.Commentf(test.name))
+		} else {
+			c.Check(err, qt.IsNotNil, qt.Commentf(test.name))
+		}
+	}
+}
+
+func TestCodeGen_SecretTagCollisions(t *testing.T) {
+	c := qt.New(t)
+	res := parseArchive(c, "testdata/sensitive_fields.txt")
+	svc := res.App.Services[0]
+	fields := res.Meta.Decls[svc.ConfigLoads[0].ConfigStruct.Type.GetNamed().Id].Type.GetStruct().Fields
+
+	// Secrets are named after the path to their field, which must be unique
+	fields[1].Name = "DatabasePassword"
+	_, err := NewGenerator(res, nil).UserFacing(svc)
+	c.Assert(err, qt.ErrorMatches, "field Database: field Password: the secret SECRET_DATABASE_PASSWORD is already injected into DatabasePassword")
+}
+
+func TestCodeGen_Durations(t *testing.T) {
+	c := qt.New(t)
+	files := generateFromArchive(c, "testdata/alias_duration.txt", nil)
+
+	ctx := cuecontext.New()
+	schema := ctx.CompileBytes(files["svc"])
+	c.Assert(schema.Err(), qt.IsNil)
+
+	valid := schema.Unify(ctx.CompileString(`{Request: "150ms", Shutdown: "1m30s"}`))
+	c.Assert(valid.Validate(cue.Concrete(true)), qt.IsNil)
+
+	invalid := schema.Unify(ctx.CompileString(`{Request: "soon", Shutdown: "1m"}`))
+	c.Assert(invalid.Validate(cue.Concrete(true)), qt.IsNotNil)
+}
+
+func TestCodeGen_UnitAttributes(t *testing.T) {
+	c := qt.New(t)
+	files := generateFromArchive(c, "testdata/units_tag.txt", nil)
+
+	ctx := cuecontext.New()
+	schema := ctx.CompileBytes(files["svc"])
+	c.Assert(schema.Err(), qt.IsNil)
+
+	for field, want := range map[string]string{"Timeout": "seconds", "MaxUpload": "bytes"} {
+		attr := schema.LookupPath(cue.ParsePath(field)).Attribute("unit")
+		unit, err := attr.String(0)
+		c.Assert(err, qt.IsNil, qt.Commentf(field))
+		c.Assert(unit, qt.Equals, want)
+	}
+
+	// Fields without a units tag have no attribute
+	attr := schema.LookupPath(cue.ParsePath("Workers")).Attribute("unit")
+	c.Assert(attr.Err(), qt.IsNotNil)
+}
+
+func TestCodeGen_Decimals(t *testing.T) {
+	c := qt.New(t)
+	files := generateFromArchive(c, "testdata/decimals.txt", nil)
+
+	ctx := cuecontext.New()
+	schema := ctx.CompileBytes(files["svc"])
+	c.Assert(schema.Err(), qt.IsNil)
+
+	tests := []struct {
+		discount string
+		valid    bool
+	}{
+		{`"0.25"`, true},
+		{`"-3"`, true},
+		{`"12345678901234567890.123456789"`, true},
+		{`"1e-3"`, false},
+		{`"1."`, false},
+		{`"3/2"`, false},
+		{`0.25`, false}, // decimals must be given as strings
+	}
+	for _, test := range tests {
+		data := fmt.Sprintf(`{Discount: %s, Rates: {}}`, test.discount)
+		err := schema.Unify(ctx.CompileString(data)).Validate(cue.Concrete(true))
+		if test.valid {
+			c.Check(err, qt.IsNil, qt.Commentf(test.discount))
+		} else {
+			c.Check(err, qt.IsNotNil, qt.Commentf(test.discount))
+		}
+	}
+}
+
+func TestCodeGen_StringBuiltins(t *testing.T) {
+	c := qt.New(t)
+	files := generateFromArchive(c, "testdata/string_builtins.txt", nil)
+
+	ctx := cuecontext.New()
+	schema := ctx.CompileBytes(files["svc"])
+	c.Assert(schema.Err(), qt.IsNil)
+
+	tests := []struct {
+		data  string
+		valid bool
+	}{
+		{`{Owners: ["6BA7B810-9DAD-11D1-80B4-00C04FD430C8"]}`, true},
+		{`{Owners: [], Payload: "[1, 2]"}`, true},
+		{`{Owners: ["6ba7b8109dad11d180b400c04fd430c8"]}`, false}, // UUIDs must be in their canonical form
+		{`{Owners: ["{6ba7b810-9dad-11d1-80b4-00c04fd430c8}"]}`, false},
+		{`{Owners: [], TenantID: "acme"}`, false},
+		{`{Owners: [], Payload: "{"}`, false},
+	}
+	for _, test := range tests {
+		err := schema.Unify(ctx.CompileString(test.data)).Validate(cue.Concrete(true))
+		if test.valid {
+			c.Check(err, qt.IsNil, qt.Commentf(test.data))
+		} else {
+			c.Check(err, qt.IsNotNil, qt.Commentf(test.data))
+		}
+	}
+
+	// Defaults must be valid values of the field type
+	for field, test := range map[int]struct{ value, err string }{
+		0: {"acme", `field TenantID: default value "acme" is not a valid UUID`},
+		1: {"{", `field Payload: default value "{" is not valid JSON`},
+	} {
+		res := parseArchive(c, "testdata/string_builtins.txt")
+		svc := res.App.Services[0]
+		fields := res.Meta.Decls[svc.ConfigLoads[0].ConfigStruct.Type.GetNamed().Id].Type.GetStruct().Fields
+		fields[field].Tags[0].Name = test.value
+		_, err := NewGenerator(res, nil).UserFacing(svc)
+		c.Assert(err, qt.ErrorMatches, test.err)
+	}
+}
+
+func TestCodeGen_Aliases(t *testing.T) {
+	c := qt.New(t)
+	files := generateFromArchive(c, "testdata/deprecated_alias.txt", nil)
+
+	ctx := cuecontext.New()
+	schema := ctx.CompileBytes(files["svc"])
+	c.Assert(schema.Err(), qt.IsNil)
+
+	// Values given under the alias are given to the original field
+	value := schema.Unify(ctx.CompileString(`{ListenAddress: ":8080", Replicas: 3, Name: "svc"}`))
+	c.Assert(value.Validate(cue.Concrete(true)), qt.IsNil)
+	addr, err := value.LookupPath(cue.ParsePath("Addr")).String()
+	c.Assert(err, qt.IsNil)
+	c.Assert(addr, qt.Equals, ":8080")
+	count, err := value.LookupPath(cue.ParsePath("Count")).Int64()
+	c.Assert(err, qt.IsNil)
+	c.Assert(count, qt.Equals, int64(3))
+
+	// The original name can still be used on its own
+	value = schema.Unify(ctx.CompileString(`{Addr: ":80", Name: "svc"}`))
+	c.Assert(value.Validate(cue.Concrete(true)), qt.IsNil)
+
+	// Conflicting values for both names are rejected
+	conflict := schema.Unify(ctx.CompileString(`{Addr: ":80", ListenAddress: ":8080", Name: "svc"}`))
+	c.Assert(conflict.Validate(cue.Concrete(true)), qt.IsNotNil)
+}
+
+func TestCodeGen_UnsupportedBuiltin(t *testing.T) {
+	c := qt.New(t)
+
+	tests := []struct {
+		name string
+		err  string
+	}{
+		{"unsupported_builtin", "field Pointer: uintptr, complex64 and complex128 values cannot be represented in config, .*"},
+		{"complex_field", "field Phase: uintptr, complex64 and complex128 values cannot be represented in config, .*"},
+	}
+	for _, test := range tests {
+		test := test
+		c.Run(test.name, func(c *qt.C) {
+			res := parseArchive(c, filepath.Join("testdata", "errors", test.name+".txt"))
+
+			_, err := NewGenerator(res, nil).UserFacing(res.App.Services[0])
+			c.Assert(err, qt.ErrorMatches, test.err)
+		})
+	}
+}
+
+func TestCodeGen_EmbeddedStructs(t *testing.T) {
+	c := qt.New(t)
+	files := generateFromArchive(c, "testdata/embedded_structs.txt", nil)
+
+	ctx := cuecontext.New()
+	cueSchema := ctx.CompileBytes(files["svc"])
+	c.Assert(cueSchema.Err(), qt.IsNil)
+
+	// Promoted fields are given at the top level, other than those of structs embedded with a JSON name
+	for data, valid := range map[string]bool{
+		`{Name: "app", Level: "info", verbose: true, database: {Username: "u", Password: "p", Name: "db"}}`: true,
+		`{Name: "app", Level: "warn", verbose: true, database: {Username: "u", Password: "p", Name: "db"}}`: false,
+		`{Name: "app", Level: "info", Verbose: true, database: {Username: "u", Password: "p", Name: "db"}}`: false,
+		`{Name: "app", Level: "info", verbose: true, Username: "u", Password: "p", database: {Name: "db"}}`: false,
+	} {
+		err := cueSchema.Unify(ctx.CompileString(data)).Validate(cue.Concrete(true))
+		c.Check(err == nil, qt.Equals, valid, qt.Commentf("data %s: %v", data, err))
+	}
+
+	// Fields promoted from two embedded structs are ambiguous
+	archiveData, err := os.ReadFile("testdata/errors/embedded_conflict.txt")
+	c.Assert(err, qt.IsNil)
+	base := c.TempDir()
+	c.Assert(txtar.Write(txtar.Parse(archiveData), base), qt.IsNil)
+	_, err = parser.Parse(&parser.Config{
+		AppRoot:    base,
+		ModulePath: "encore.app",
+		WorkingDir: ".",
+	})
+	c.Assert(err, qt.IsNotNil)
+	c.Assert(err.Error(), qt.Contains, "embedded field name Host conflicts with field promoted from another embedded struct")
+}
+
+func TestCodeGen_EmbeddedDefaults(t *testing.T) {
+	c := qt.New(t)
+	files := generateFromArchive(c, "testdata/embedded_defaults.txt", nil)
+
+	ctx := cuecontext.New()
+	cueSchema := ctx.CompileBytes(files["svc"])
+	c.Assert(cueSchema.Err(), qt.IsNil)
+
+	cfg := cueSchema.Unify(ctx.CompileString(`{Queue: "jobs"}`))
+	c.Assert(cfg.Validate(cue.Concrete(true)), qt.IsNil)
+
+	// Defaults of fields declared on a derived struct win over those of the structs it embeds
+	for field, want := range map[string]string{
+		"Host":    `"localhost"`,
+		"Timeout": `"30s"`,
+		"Port":    `9090`,
+		"Retries": `10`,
+	} {
+		got, _ := cfg.LookupPath(cue.ParsePath(field)).Default()
+		c.Check(fmt.Sprint(got), qt.Equals, want, qt.Commentf("field %s", field))
+	}
+}
+
+func TestCodeGen_FuncFields(t *testing.T) {
+	c := qt.New(t)
+
+	// Function types can't be given in config, so they are rejected when parsing the app
+	archiveData, err := os.ReadFile("testdata/errors/func_field.txt")
+	c.Assert(err, qt.IsNil)
+	base := c.TempDir()
+	c.Assert(txtar.Write(txtar.Parse(archiveData), base), qt.IsNil)
+	_, err = parser.Parse(&parser.Config{
+		AppRoot:    base,
+		ModulePath: "encore.app",
+		WorkingDir: ".",
+	})
+	c.Assert(err, qt.IsNotNil)
+	c.Assert(err.Error(), qt.Contains, "cannot use function types in Encore schema definitions")
+
+	// The schema has no function type, so a function field reaching the generator has no type
+	res := parseArchive(c, "testdata/basic_config.txt")
+	svc := res.App.Services[0]
+	stru := res.Meta.Decls[svc.ConfigLoads[0].ConfigStruct.Type.GetNamed().Id].Type.GetStruct()
+	stru.Fields = append(stru.Fields, &schema.Field{Name: "OnReload", Typ: &schema.Type{}})
+
+	_, err = NewGenerator(res, nil).UserFacing(svc)
+	c.Assert(err, qt.ErrorMatches, "field OnReload: function and channel types cannot be represented in config")
+}
+
+func TestCodeGen_CurefNameConflict(t *testing.T) {
+	c := qt.New(t)
+	res := parseArchive(c, "testdata/errors/curef_name_conflict.txt")
+
+	_, err := NewGenerator(res, nil).UserFacing(res.App.Services[0])
+	c.Assert(err, qt.ErrorMatches, `field Retries: curef "other.com/consts.#RetryLimits" imports a package named consts, which is already imported from acme.com/cue/consts`)
+}
+
+func TestCodeGen_InvalidCueTag(t *testing.T) {
+	c := qt.New(t)
+	res := parseArchive(c, "testdata/errors/invalid_cue_tag.txt")
+
+	_, err := NewGenerator(res, nil).UserFacing(res.App.Services[0])
+	c.Assert(err, qt.ErrorMatches, `field Percent: invalid cue expression "<": .*`)
+}
+
+func TestCodeGen_UnsupportedMapKeys(t *testing.T) {
+	c := qt.New(t)
+
+	tests := []struct {
+		name string
+		err  string
+	}{
+		{"map_float_key", "field Buckets: maps with float64 keys cannot be represented in config, .*"},
+		{"map_struct_key", "field Names: maps with Point keys cannot be represented in config, .*"},
+	}
+	for _, test := range tests {
+		test := test
+		c.Run(test.name, func(c *qt.C) {
+			res := parseArchive(c, filepath.Join("testdata", "errors", test.name+".txt"))
+
+			_, err := NewGenerator(res, nil).UserFacing(res.App.Services[0])
+			c.Assert(err, qt.ErrorMatches, test.err)
+		})
+	}
+}
+
+func TestCodeGen_MergeMismatchedKinds(t *testing.T) {
+	c := qt.New(t)
+	res := parseArchive(c, "testdata/errors/merge_mismatched_kinds.txt")
+
+	_, err := NewGenerator(res, nil).UserFacing(res.App.Services[0])
+	c.Assert(err, qt.ErrorMatches, "field Database is a struct in StorageConfig, but a scalar in Config, so cannot be merged")
+}
+
+func TestCodeGen_MergeEnumValues(t *testing.T) {
+	c := qt.New(t)
+	files := generateFromArchive(c, "testdata/merge_enum_values.txt", nil)
+
+	ctx := cuecontext.New()
+	schema := ctx.CompileBytes(files["svc"])
+	c.Assert(schema.Err(), qt.IsNil)
+
+	// Only the values allowed by both enums are allowed
+	for level, valid := range map[string]bool{"debug": false, "info": true, "warn": true, "error": false} {
+		err := schema.Unify(ctx.CompileString(fmt.Sprintf(`{Level: %q}`, level))).Validate(cue.Concrete(true))
+		c.Check(err == nil, qt.Equals, valid, qt.Commentf("level %s", level))
+	}
+
+	// Enums with no values in common can't be merged
+	res := parseArchive(c, "testdata/errors/merge_disjoint_enums.txt")
+	_, err := NewGenerator(res, nil).UserFacing(res.App.Services[0])
+	c.Assert(err, qt.ErrorMatches, "field Level is an enum in multiple config types, but the enums have no values in common")
+}
+
+func TestCodeGen_RecursiveTypes(t *testing.T) {
+	c := qt.New(t)
+	res := parseArchive(c, "testdata/recursive_containers.txt")
+
+	svc := res.App.Services[0]
+	s := &service{
+		g:         NewGenerator(res, nil),
+		svc:       svc,
+		typeUsage: newDefinitionGenerator(res.Meta.Decls),
+	}
+	for _, configLoad := range svc.ConfigLoads {
+		c.Assert(s.markRecursiveTypes(configLoad.ConfigStruct.Type, nil), qt.IsNil)
+	}
+
+	// Both recursion through a map value and through a list element must be found
+	var recursive []string
+	for _, named := range s.typeUsage.ids {
+		if s.typeUsage.IsRecursive(named) {
+			recursive = append(recursive, res.Meta.Decls[named.Id].Name)
+		}
+	}
+	c.Assert(recursive, qt.DeepEquals, []string{"Tree", "Node"})
+}
+
+func TestCodeGen_EnvTag(t *testing.T) {
+	c := qt.New(t)
+	files := generateFromArchive(c, "testdata/env_tag.txt", nil)
+
+	ctx := cuecontext.New()
+	schema := ctx.CompileBytes(files["svc"])
+	c.Assert(schema.Validate(), qt.IsNil)
+
+	tests := []struct {
+		env   string
+		data  string
+		valid bool
+	}{
+		{"prod", `{Name: "x", SentryDSN: "https://sentry.example.com"}`, true},
+		{"prod", `{Name: "x"}`, false}, // SentryDSN is required in prod
+		{"staging", `{Name: "x", SentryDSN: "https://sentry.example.com"}`, true},
+		{"local", `{Name: "x", Debug: true}`, true},
+		{"local", `{Name: "x", SentryDSN: "https://sentry.example.com"}`, false}, // SentryDSN is not present outside of prod and staging
+		{"prod", `{Name: "x", SentryDSN: "https://sentry.example.com", Debug: true}`, false},
+	}
+	for _, test := range tests {
+		env := ctx.CompileString(fmt.Sprintf(`#Meta: Environment: Name: %q`, test.env))
+		err := schema.Unify(env).Unify(ctx.CompileString(test.data)).Validate(cue.Concrete(true))
+		c.Check(err == nil, qt.Equals, test.valid, qt.Commentf("env %s: %s: %v", test.env, test.data, err))
+	}
+}
+
+func TestCodeGen_GenerateAllWithContext(t *testing.T) {
+	c := qt.New(t)
+	res := parseArchive(c, "testdata/multiple_services.txt")
+	c.Assert(res.App.Services, qt.HasLen, 3)
+
+	// All services are generated when not canceled
+	files, err := NewGenerator(res, nil).GenerateAllWithContext(context.Background(), res.App.Services)
+	c.Assert(err, qt.IsNil)
+	c.Assert(files, qt.HasLen, 3)
+
+	// Cancel the context while generating the first service
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var generated []string
+	gen := NewGenerator(res, &Options{
+		PackageName: func(svc *est.Service) string {
+			generated = append(generated, svc.Name)
+			cancel()
+			return svc.Name
+		},
+	})
+
+	files, err = gen.GenerateAllWithContext(ctx, res.App.Services)
+	c.Assert(err, qt.ErrorIs, context.Canceled)
+	c.Assert(files, qt.IsNil)
+	c.Assert(generated, qt.HasLen, 1)
+}
+
+func TestCodeGen_GenerateForPackage(t *testing.T) {
+	c := qt.New(t)
+	res := parseArchive(c, "testdata/packages.txt")
+	all := generateFromArchive(c, "testdata/packages.txt", nil)
+	gen := NewGenerator(res, nil)
+
+	// Only svcb's config is declared and loaded within svcb
+	files, err := gen.GenerateForPackage("encore.app/svcb", res.App.Services)
+	c.Assert(err, qt.IsNil)
+	c.Assert(files, qt.HasLen, 1)
+	c.Assert(string(files["svcb"]), qt.Equals, string(all["svcb"]))
+
+	// Everything svca loads is loaded within svca, including the types declared in lib
+	files, err = gen.GenerateForPackage("encore.app/svca", res.App.Services)
+	c.Assert(err, qt.IsNil)
+	c.Assert(files, qt.HasLen, 1)
+	c.Assert(string(files["svca"]), qt.Equals, string(all["svca"]))
+
+	// Only the config types declared in lib are generated
+	files, err = gen.GenerateForPackage("encore.app/lib", res.App.Services)
+	c.Assert(err, qt.IsNil)
+	c.Assert(files, qt.HasLen, 1)
+	c.Assert(string(files["svca"]), qt.Contains, "\tRegion: string\n")
+	c.Assert(string(files["svca"]), qt.Not(qt.Contains), "Primary:")
+	c.Assert(string(files["svca"]), qt.Not(qt.Contains), "#Endpoint")
+
+	files, err = gen.GenerateForPackage("encore.app/other", res.App.Services)
+	c.Assert(err, qt.IsNil)
+	c.Assert(files, qt.HasLen, 0)
+}
+
+func TestCodeGen_QualifiedDefinitionNames(t *testing.T) {
+	c := qt.New(t)
+
+	// Without qualified names, types of the same name are told apart by a number
+	files := generateFromArchive(c, "testdata/options/qualified_definition_names.txt", nil)
+	c.Assert(string(files["svc"]), qt.Contains, "#Backend: {")
+	c.Assert(string(files["svc"]), qt.Contains, "#Backend_1: {")
+
+	tests := []struct {
+		trim string
+		want []string
+	}{
+		{trim: "", want: []string{"#VendoredFooBackend", "#SvcUtilsBackend"}},
+		{trim: "vendored/", want: []string{"#FooBackend", "#SvcUtilsBackend"}},
+	}
+	for _, test := range tests {
+		files := generateFromArchive(c, "testdata/options/qualified_definition_names.txt", &Options{
+			QualifiedDefinitionNames: true,
+			TrimPackagePrefix:        test.trim,
+		})
+		cueFile := string(files["svc"])
+		for _, want := range test.want {
+			c.Check(strings.Count(cueFile, want+": {"), qt.Equals, 1, qt.Commentf("trim %q: missing %s in:\n%s", test.trim, want, cueFile))
+			c.Check(strings.Count(cueFile, " "+want+"\n"), qt.Equals, 2, qt.Commentf("trim %q: missing uses of %s", test.trim, want))
+		}
+	}
+}
+
+func TestCodeGen_CustomTypes(t *testing.T) {
+	c := qt.New(t)
+	opts := &Options{CustomTypes: map[string]string{"encore.app/money.Amount": "acme.com/cue/money.#Amount"}}
+	files := generateFromArchive(c, "testdata/options/custom_types.txt", opts)
+	cueFile := string(files["svc"])
+
+	// Custom types are referenced wherever they're used, with the package they're in imported
+	c.Assert(cueFile, qt.Contains, `import money "acme.com/cue/money"`)
+	c.Assert(strings.Count(cueFile, "money.#Amount"), qt.Equals, 3)
+	c.Assert(cueFile, qt.Contains, "[...money.#Amount]")
+
+	// Their fields are not generated, nor are types only used by those fields counted towards definitions
+	c.Assert(cueFile, qt.Not(qt.Contains), "Units")
+	c.Assert(cueFile, qt.Not(qt.Contains), "#Amount:")
+	c.Assert(cueFile, qt.Not(qt.Contains), "#Currency")
+	c.Assert(strings.Count(cueFile, "Code: string"), qt.Equals, 1)
+
+	// Invalid references are reported against the type
+	opts.CustomTypes["encore.app/money.Amount"] = "money"
+	res := parseArchive(c, "testdata/options/custom_types.txt")
+	_, err := NewGenerator(res, opts).UserFacing(res.App.Services[0])
+	c.Assert(err, qt.ErrorMatches, `field Price: custom type Amount: reference "money" must be an import path followed by the path to a value .*`)
+}
+
+func TestCodeGen_SharedPackage(t *testing.T) {
+	c := qt.New(t)
+	res := parseArchive(c, "testdata/options/shared_package.txt")
+	gen := NewGenerator(res, &Options{SharedPackage: "encore.app/config"})
+
+	// Types used by both services are generated once, while those with fields only
+	// present in some environments or used by a single service are not
+	shared, err := gen.SharedDefinitions()
+	c.Assert(err, qt.IsNil)
+	golden.TestAgainst(c.TB, "options/shared_package.cue", string(shared))
+	c.Assert(string(shared), qt.Not(qt.Contains), "#Server")
+	c.Assert(string(shared), qt.Not(qt.Contains), "#Cache")
+
+	// The services' files import the shared package, so it's resolved from cue.mod/gen
+	fsys := fstest.MapFS{
+		"cue.mod/gen/encore.app/config/encore.gen.cue": {Data: shared},
+	}
+	for _, svc := range res.App.Services {
+		f, err := gen.UserFacing(svc)
+		c.Assert(err, qt.IsNil)
+		fsys[svc.Name+"/encore.gen.cue"] = &fstest.MapFile{Data: f}
+	}
+	fsys["svcb/config.cue"] = &fstest.MapFile{Data: []byte(`package svcb
+
+Database: {Host: "db", Port: 5432}
+Log: "info"
+Server: Addr: ":8080"
+`)}
+	meta := &cueutil.Meta{APIBaseURL: "http://localhost:4000", EnvName: "local", EnvType: cueutil.EnvType_Development, CloudType: cueutil.CloudType_Local}
+	value, err := cueutil.LoadFromFS(fsys, "svcb", meta)
+	c.Assert(err, qt.IsNil)
+	got, err := value.MarshalJSON()
+	c.Assert(err, qt.IsNil)
+	c.Assert(string(got), qt.Equals, `{"Database":{"Host":"db","Port":5432,"Pool":{"MaxConns":10}},"Log":"info","Server":{"Addr":":8080"}}`)
+
+	// The shared definitions are closed and constrained as they would be within the service
+	fsys["svcb/config.cue"].Data = bytes.Replace(fsys["svcb/config.cue"].Data, []byte("Port: 5432"), []byte("Port: 0, User: \"root\""), 1)
+	_, err = cueutil.LoadFromFS(fsys, "svcb", meta)
+	c.Assert(err, qt.ErrorMatches, `(?s).*Port.*User.*`)
+
+	// Without the option, nothing is shared
+	shared, err = NewGenerator(res, nil).SharedDefinitions()
+	c.Assert(err, qt.IsNil)
+	c.Assert(shared, qt.IsNil)
+
+	// The package is named after the last element of its import path
+	_, err = NewGenerator(res, &Options{SharedPackage: "encore.app/shared-config"}).UserFacing(res.App.Services[0])
+	c.Assert(err, qt.ErrorMatches, `invalid shared package "encore.app/shared-config": the last element of its import path must be a valid CUE identifier`)
+}
+
+func TestCodeGen_DocTranslate(t *testing.T) {
+	c := qt.New(t)
+
+	// The translator is given each doc comment in full, and may change how many lines it spans
+	var docs []string
+	opts := &Options{DocTranslate: func(goDoc string) string {
+		docs = append(docs, goDoc)
+		if goDoc == "The port of the server" {
+			return "Le port\ndu serveur"
+		}
+		return strings.ToUpper(goDoc)
+	}}
+	files := generateFromArchive(c, "testdata/options/doc_translate.txt", opts)
+	cueFile := string(files["svc"])
+
+	c.Assert(docs, qt.Contains, "The servers to connect to.\nThe first server is tried first.")
+	for _, want := range []string{
+		"// SERVER IS A SERVER TO CONNECT TO\n#Server: {",
+		"Host: string // THE HOST OF THE SERVER",
+		"// Le port\n\t// du serveur\n\tPort: int",
+		"// THE SERVERS TO CONNECT TO.\n\t// THE FIRST SERVER IS TRIED FIRST.\n\tServers: [...#Server]",
+		"// THE REGION OF THE SERVER\n\t// readonly\n",
+	} {
+		c.Check(strings.Contains(cueFile, want), qt.IsTrue, qt.Commentf("missing %q in:\n%s", want, cueFile))
+	}
+	c.Assert(cueFile, qt.Not(qt.Contains), "The host")
+}
+
+func TestCodeGen_EmitChecksum(t *testing.T) {
+	c := qt.New(t)
+	res := parseArchive(c, "testdata/basic_config.txt")
+	gen := NewGenerator(res, &Options{EmitChecksum: true})
+
+	f, err := gen.UserFacing(res.App.Services[0])
+	c.Assert(err, qt.IsNil)
+	c.Assert(string(f), qt.Matches, `(?s).*\n\n// Checksum: sha256:[0-9a-f]{64}\n`)
+	c.Assert(gen.VerifyChecksum(f), qt.IsTrue)
+
+	// The file is still valid CUE
+	_, err = cuecontext.New().CompileBytes(f).Fields()
+	c.Assert(err, qt.IsNil)
+
+	// Generating the same config gives the same checksum, regardless of line endings
+	again, err := gen.UserFacing(res.App.Services[0])
+	c.Assert(err, qt.IsNil)
+	c.Assert(string(again), qt.Equals, string(f))
+	c.Assert(gen.VerifyChecksum(bytes.ReplaceAll(f, []byte("\n"), []byte("\r\n"))), qt.IsTrue)
+
+	// Any edit to the content is detected
+	edited := bytes.Replace(f, []byte("#Config"), []byte("#Cfg"), 1)
+	c.Assert(gen.VerifyChecksum(edited), qt.IsFalse)
+	c.Assert(gen.VerifyChecksum(append(append([]byte{}, f[:len(f)-1]...), '0', '\n')), qt.IsFalse)
+
+	// Files without a checksum are never verified
+	plain, err := NewGenerator(res, nil).UserFacing(res.App.Services[0])
+	c.Assert(err, qt.IsNil)
+	c.Assert(string(plain), qt.Not(qt.Contains), "Checksum")
+	c.Assert(gen.VerifyChecksum(plain), qt.IsFalse)
+}
+
+func TestCodeGen_PreserveUserSection(t *testing.T) {
+	c := qt.New(t)
+	res := parseArchive(c, "testdata/basic_config.txt")
+	gen := NewGenerator(res, &Options{EmitChecksum: true})
+
+	f, err := gen.UserFacing(res.App.Services[0])
+	c.Assert(err, qt.IsNil)
+
+	// Files without a user section are regenerated as is
+	c.Assert(string(gen.PreserveUserSection(f, f)), qt.Equals, string(f))
+	c.Assert(string(gen.PreserveUserSection(f, nil)), qt.Equals, string(f))
+
+	// The user section of the previous file is kept after the regenerated content
+	user := "// encore:user-section\n\n// Only listen on unprivileged ports\nPort: >=1024"
+	previous := append(bytes.Replace(f, []byte("ReadOnly"), []byte("OldField"), 1), []byte("\n"+user)...)
+	regenerated := gen.PreserveUserSection(f, previous)
+	c.Assert(string(regenerated), qt.Equals, string(f)+"\n"+user+"\n")
+	c.Assert(string(gen.PreserveUserSection(f, regenerated)), qt.Equals, string(regenerated))
+
+	// The user section is unified with the generated fields, and isn't part of the checksum
+	c.Assert(gen.VerifyChecksum(regenerated), qt.IsTrue)
+	value := cuecontext.New().CompileBytes(regenerated)
+	c.Assert(value.Err(), qt.IsNil)
+	c.Assert(value.FillPath(cue.ParsePath("Port"), 8080).Err(), qt.IsNil)
+	c.Assert(value.FillPath(cue.ParsePath("Port"), 80).Err(), qt.ErrorMatches, `Port: invalid value 80 \(out of bound >=1024\)`)
+}
+
+func TestCodeGen_DiagnosticsReport(t *testing.T) {
+	c := qt.New(t)
+	res := parseArchive(c, "testdata/errors/diagnostics.txt")
+
+	var report bytes.Buffer
+	gen := NewGenerator(res, &Options{Environments: []string{"dev", "prod"}, DiagnosticsReport: &report})
+	files, err := gen.GenerateAllWithContext(context.Background(), res.App.Services)
+	c.Assert(err, qt.ErrorMatches, "service svcb: field Region: cannot have both a const and a default value")
+	c.Assert(files, qt.IsNil)
+
+	// Both services are reported on, even though svcb failed to generate
+	var got map[string]any
+	c.Assert(json.Unmarshal(report.Bytes(), &got), qt.IsNil)
+	c.Assert(got, qt.DeepEquals, map[string]any{
+		"diagnostics": []any{
+			map[string]any{
+				"service":  "svca",
+				"field":    "Server.Debug",
+				"severity": "warning",
+				"message":  `the env tag names the environment "staging", which is not one of the environments being scaffolded`,
+			},
+			map[string]any{
+				"service":  "svcb",
+				"field":    "Region",
+				"severity": "error",
+				"message":  "field Region: cannot have both a const and a default value",
+			},
+		},
+	})
+
+	// Without errors or warnings the report is empty
+	report.Reset()
+	res = parseArchive(c, "testdata/multiple_services.txt")
+	_, err = NewGenerator(res, &Options{DiagnosticsReport: &report}).GenerateAllWithContext(context.Background(), res.App.Services)
+	c.Assert(err, qt.IsNil)
+	c.Assert(report.String(), qt.JSONEquals, map[string]any{"diagnostics": []any{}})
+}
+
+func TestCodeGen_WarnCaseInsensitiveCollisions(t *testing.T) {
+	c := qt.New(t)
+	res := parseArchive(c, "testdata/errors/case_collisions.txt")
+
+	var report bytes.Buffer
+	opts := &Options{WarnCaseInsensitiveCollisions: true, DiagnosticsReport: &report}
+	files, err := NewGenerator(res, opts).GenerateAllWithContext(context.Background(), res.App.Services)
+	c.Assert(err, qt.IsNil)
+
+	// Both fields are still generated, as CUE treats the labels as distinct
+	cueFile := string(files["svc"])
+	c.Assert(cueFile, qt.Contains, "Host: string")
+	c.Assert(cueFile, qt.Contains, "host: string")
+
+	c.Assert(report.String(), qt.JSONEquals, map[string]any{
+		"diagnostics": []any{
+			map[string]any{
+				"service":  "svc",
+				"field":    "Server.host",
+				"severity": "warning",
+				"message":  `the label "host" differs only by case from the label "Host", so the fields cannot be told apart by case-insensitive consumers`,
+			},
+		},
+	})
+
+	// Without the option no warning is given
+	report.Reset()
+	_, err = NewGenerator(res, &Options{DiagnosticsReport: &report}).GenerateAllWithContext(context.Background(), res.App.Services)
+	c.Assert(err, qt.IsNil)
+	c.Assert(report.String(), qt.JSONEquals, map[string]any{"diagnostics": []any{}})
+}
+
+func TestCodeGen_MapValueDefinitions(t *testing.T) {
+	c := qt.New(t)
+	files := generateFromArchive(c, "testdata/map_value_definitions.txt", nil)
+	cueFile := string(files["svc"])
+
+	// Maps with the same value shape reference a single shared definition
+	c.Assert(strings.Count(cueFile, "#Entry: {"), qt.Equals, 1)
+	c.Assert(strings.Count(cueFile, "#MapValue: {"), qt.Equals, 1)
+	c.Assert(strings.Count(cueFile, "[string]: #MapValue"), qt.Equals, 2)
+	c.Assert(strings.Count(cueFile, "Host: string"), qt.Equals, 1)
+}
+
+func TestCodeGen_ListElementDefinitions(t *testing.T) {
+	c := qt.New(t)
+	files := generateFromArchive(c, "testdata/list_of_named_structs.txt", nil)
+	cueFile := string(files["svc"])
+
+	// Lists of a struct used elsewhere reference its definition, while single uses are inlined
+	c.Assert(strings.Count(cueFile, "#Backend: {"), qt.Equals, 1)
+	c.Assert(strings.Count(cueFile, "[...#Backend]"), qt.Equals, 2)
+	c.Assert(strings.Count(cueFile, "Host:"), qt.Equals, 1)
+	c.Assert(cueFile, qt.Not(qt.Contains), "#Route")
+}
+
+func TestCodeGen_FlattenedEnvKeys(t *testing.T) {
+	c := qt.New(t)
+	files := generateFromArchive(c, "testdata/options/flattened_env_keys.txt", &Options{FlattenedEnvKeys: true})
+
+	ctx := cuecontext.New()
+	schema := ctx.CompileBytes(files["svc"])
+	c.Assert(schema.Err(), qt.IsNil)
+	envConfig := schema.LookupPath(cue.ParsePath("#EnvConfig"))
+	c.Assert(envConfig.Err(), qt.IsNil)
+
+	for data, valid := range map[string]bool{
+		`{NAME: "svc", DATABASE__HOST: "db", DATABASE__POOL__MAX_CONNS: 10}`:                     true,
+		`{NAME: "svc", DATABASE__HOST: "db", DATABASE__POOL__MAX_CONNS: 10, REPLICA__HOST: "r"}`: true,
+		`{NAME: "svc", DATABASE__HOST: "db"}`:                                                    false,
+		`{NAME: "svc", DATABASE__HOST: 5, DATABASE__POOL__MAX_CONNS: 10}`:                        false,
+		`{NAME: "svc", DATABASE__HOST: "db", DATABASE__POOL__MAX_CONNS: 10, DATABASE: "db"}`:     false,
+		`{NAME: "svc", DATABASE__HOST: "db", DATABASE__POOL__MAX_CONNS: 10, TAGS: "a,b"}`:        false,
+	} {
+		err := envConfig.Unify(ctx.CompileString(data)).Validate(cue.Concrete(true))
+		c.Check(err == nil, qt.Equals, valid, qt.Commentf("data %s: %v", data, err))
+	}
+
+	// The port is defaulted just as it is in #Config
+	v := envConfig.Unify(ctx.CompileString(`{NAME: "svc", DATABASE__HOST: "db", DATABASE__POOL__MAX_CONNS: 10}`))
+	port, err := v.LookupPath(cue.ParsePath("DATABASE__PORT")).Int64()
+	c.Assert(err, qt.IsNil)
+	c.Assert(port, qt.Equals, int64(5432))
+}
+
+func TestCodeGen_EnumConstReferences(t *testing.T) {
+	c := qt.New(t)
+	files := generateFromArchive(c, "testdata/enum_const_references.txt", nil)
+
+	ctx := cuecontext.New()
+	cueSchema := ctx.CompileBytes(files["svc"])
+	c.Assert(cueSchema.Err(), qt.IsNil)
+
+	// Constants referring to other constants are evaluated, so the enums are still generated,
+	// with any aliases of the same value only listed once
+	c.Assert(string(files["svc"]), qt.Contains, `"mode-fast" | "mode-safe"`)
+	c.Assert(string(files["svc"]), qt.Contains, "1 | 2 | 3")
+	c.Assert(string(files["svc"]), qt.Contains, "10 | 20")
+	for data, valid := range map[string]bool{
+		`{Mode: "mode-fast", Level: 2, Verbosity: 20}`: true,
+		`{Mode: "fast", Level: 2, Verbosity: 20}`:      false,
+		`{Mode: "mode-safe", Level: 4, Verbosity: 10}`: false,
+		`{Mode: "mode-safe", Level: 1, Verbosity: 15}`: false,
+	} {
+		err := cueSchema.Unify(ctx.CompileString(data)).Validate(cue.Concrete(true))
+		c.Check(err == nil, qt.Equals, valid, qt.Commentf("data %s: %v", data, err))
+	}
+}
+
+func TestCodeGen_DirectAndNestedUsages(t *testing.T) {
+	c := qt.New(t)
+	files := generateFromArchive(c, "testdata/direct_and_list_usage.txt", nil)
+	cueFile := string(files["svc"])
+
+	// A use within a list or map counts towards the uses of a type, so a type used once
+	// directly and once as an element is referenced by a definition in both places
+	for _, want := range []string{"#Backend: {", "Primary: #Backend", "Replicas: [...#Backend]", "#Pool:", "Default: #Pool", "[string]: #Pool"} {
+		c.Check(strings.Count(cueFile, want), qt.Equals, 1, qt.Commentf("missing %q in:\n%s", want, cueFile))
+	}
+	c.Assert(strings.Count(cueFile, "Host:"), qt.Equals, 1)
+	c.Assert(strings.Count(cueFile, "Size:"), qt.Equals, 1)
+}
+
+func TestCodeGen_NamedMapAndListDefinitions(t *testing.T) {
+	c := qt.New(t)
+	files := generateFromArchive(c, "testdata/named_map_and_list_reuse.txt", nil)
+
+	ctx := cuecontext.New()
+	schema := ctx.CompileBytes(files["svc"])
+	c.Assert(schema.Err(), qt.IsNil)
+
+	// The definitions hold the map and list themselves, rather than a struct wrapping them
+	for path, tests := range map[string]map[string]bool{
+		"#Headers": {
+			`{"X-Api-Key": "secret", Accept: "application/json"}`: true,
+			`{}`:                   true,
+			`{"X-Retries": 3}`:     false,
+			`["application/json"]`: false,
+		},
+		"#Hosts": {
+			`["a.example.com", "b.example.com"]`: true,
+			`[]`:                                 true,
+			`[1]`:                                false,
+			`{Hosts: ["a.example.com"]}`:         false,
+		},
+	} {
+		def := schema.LookupPath(cue.ParsePath(path))
+		c.Assert(def.Err(), qt.IsNil)
+		for data, valid := range tests {
+			err := def.Unify(ctx.CompileString(data)).Validate(cue.Concrete(true))
+			c.Check(err == nil, qt.Equals, valid, qt.Commentf("%s with data %s: %v", path, data, err))
+		}
+	}
+}
+
+func TestCodeGen_NormalizeTag(t *testing.T) {
+	c := qt.New(t)
+	files := generateFromArchive(c, "testdata/normalize_tag.txt", nil)
+
+	ctx := cuecontext.New()
+	cueSchema := ctx.CompileBytes(files["svc"])
+	c.Assert(cueSchema.Err(), qt.IsNil)
+
+	// Only values already in their normalized form are accepted
+	for data, valid := range map[string]bool{
+		`{Region: "eu-west-1", Currency: "EUR", Name: "Acme"}`:  true,
+		`{Region: "europe (west)", Currency: "EUR", Name: "A"}`: true,
+		`{Region: "EU-WEST-1", Currency: "EUR", Name: "Acme"}`:  false,
+		`{Region: "eu-West-1", Currency: "EUR", Name: "Acme"}`:  false,
+		`{Region: "éu", Currency: "EUR", Name: "Acme"}`:         true,
+		`{Region: "Éu", Currency: "EUR", Name: "Acme"}`:         false,
+		`{Region: "eu-west-1", Currency: "eur", Name: "Acme"}`:  false,
+	} {
+		err := cueSchema.Unify(ctx.CompileString(data)).Validate(cue.Concrete(true))
+		c.Check(err == nil, qt.Equals, valid, qt.Commentf("data %s: %v", data, err))
+	}
+
+	// Only known normalizations of strings are supported
+	res := parseArchive(c, "testdata/normalize_tag.txt")
+	svc := res.App.Services[0]
+	fields := res.Meta.Decls[svc.ConfigLoads[0].ConfigStruct.Type.GetNamed().Id].Type.GetStruct().Fields
+	fields[0].Tags[0].Name = "title"
+	_, err := NewGenerator(res, nil).UserFacing(svc)
+	c.Assert(err, qt.ErrorMatches, `field Region: unknown normalization "title", expected lower or upper`)
+
+	fields[0].Tags[0].Name = "lower"
+	fields[0].Typ = &schema.Type{Typ: &schema.Type_Builtin{Builtin: schema.Builtin_INT}}
+	_, err = NewGenerator(res, nil).UserFacing(svc)
+	c.Assert(err, qt.ErrorMatches, "field Region: the normalize tag can only be used on string fields")
+}
+
+func TestCodeGen_NullablePointers(t *testing.T) {
+	c := qt.New(t)
+	ctx := cuecontext.New()
+
+	tests := []struct {
+		nullability Nullability
+		defaults    bool // whether a missing pointer field defaults to null
+	}{
+		{nullability: NullPermitted, defaults: false},
+		{nullability: NullDefault, defaults: true},
+	}
+	for _, test := range tests {
+		files := generateFromArchive(c, "testdata/options/null_default_pointers.txt", &Options{NullablePointers: test.nullability})
+		cueSchema := ctx.CompileBytes(files["svc"])
+		c.Assert(cueSchema.Err(), qt.IsNil)
+
+		// Null is accepted by every pointer field, other than those pinned to a const value
+		for data, valid := range map[string]bool{
+			`{Name: "a", Timeout: 5, Region: "us", Mode: "strict", Limits: {MaxConns: 1}, Replicas: [1]}`: true,
+			`{Name: "a", Timeout: null, Region: null, Mode: "strict", Limits: null, Replicas: [null, 1]}`: true,
+			`{Name: "a", Timeout: 0, Region: "us", Mode: "strict", Limits: null, Replicas: []}`:           false,
+			`{Name: "a", Timeout: null, Region: "us", Mode: null, Limits: null, Replicas: []}`:            false,
+			`{Name: null, Timeout: null, Region: "us", Mode: "strict", Limits: null, Replicas: []}`:       false,
+		} {
+			err := cueSchema.Unify(ctx.CompileString(data)).Validate(cue.Concrete(true))
+			c.Check(err == nil, qt.Equals, valid, qt.Commentf("nullability %d, data %s: %v", test.nullability, data, err))
+		}
+
+		// Missing pointer fields default to null only when null is the default, while a default
+		// value of the field's own takes precedence over null
+		config := cueSchema.Unify(ctx.CompileString(`{Name: "a", Mode: "strict", Replicas: []}`))
+		err := config.Validate(cue.Concrete(true))
+		c.Check(err == nil, qt.Equals, test.defaults, qt.Commentf("nullability %d: %v", test.nullability, err))
+		if test.defaults {
+			timeout, _ := config.LookupPath(cue.ParsePath("Timeout")).Default()
+			c.Check(timeout.Null(), qt.IsNil)
+			region, _ := config.LookupPath(cue.ParsePath("Region")).Default()
+			c.Check(fmt.Sprint(region), qt.Equals, `"eu"`)
+		}
+	}
+
+	// By default pointers cannot be null
+	files := generateFromArchive(c, "testdata/options/null_default_pointers.txt", nil)
+	c.Assert(string(files["svc"]), qt.Not(qt.Contains), "null")
+}
+
+func TestCodeGen_OpenAPICompatible(t *testing.T) {
+	c := qt.New(t)
+	files := generateFromArchive(c, "testdata/options/openapi_compatible.txt", &Options{OpenAPICompatible: true})
+
+	var r cue.Runtime
+	inst, err := r.Compile("svc.cue", files["svc"])
+	c.Assert(err, qt.IsNil)
+	out, err := openapi.Gen(inst, &openapi.Config{
+		Info: ast.NewStruct("title", ast.NewString("svc"), "version", ast.NewString("v1")),
+	})
+	c.Assert(err, qt.IsNil)
+
+	var spec struct {
+		Components struct {
+			Schemas map[string]struct {
+				Description string `json:"description"`
+				Properties  map[string]struct {
+					Ref         string `json:"$ref"`
+					Type        string `json:"type"`
+					Format      string `json:"format"`
+					Description string `json:"description"`
+				} `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	c.Assert(json.Unmarshal(out, &spec), qt.IsNil)
+
+	config := spec.Components.Schemas["Config"]
+	c.Assert(config.Properties["Primary"].Ref, qt.Equals, "#/components/schemas/Server")
+	c.Assert(config.Properties["LaunchedAt"].Description, qt.Equals, "LaunchedAt is when the service was launched")
+	c.Assert(config.Properties["LaunchedAt"].Format, qt.Equals, "date-time")
+	c.Assert(config.Properties["Weight"].Format, qt.Equals, "double")
+
+	server := spec.Components.Schemas["Server"]
+	c.Assert(server.Description, qt.Equals, "Server is a server the service connects to")
+	c.Assert(server.Properties["Host"].Description, qt.Equals, "Host is the hostname of the server")
+	c.Assert(server.Properties["Port"].Type, qt.Equals, "integer")
+
+	// Environments are scaffolded as fields outside of the definitions, which can't be exported
+	res := parseArchive(c, "testdata/options/openapi_compatible.txt")
+	_, err = NewGenerator(res, &Options{OpenAPICompatible: true, Environments: []string{"dev"}}).UserFacing(res.App.Services[0])
+	c.Assert(err, qt.ErrorMatches, "the OpenAPICompatible and Environments options cannot be used together")
+}
+
+func TestJSONSchema(t *testing.T) {
+	c := qt.New(t)
+	res := parseArchive(c, "testdata/options/openapi_compatible.txt")
+	out, err := NewGenerator(res, nil).JSONSchema(res.App.Services[0])
+	c.Assert(err, qt.IsNil)
+
+	type property struct {
+		Ref         string `json:"$ref"`
+		Type        any    `json:"type"`
+		Format      string `json:"format"`
+		Description string `json:"description"`
+		Minimum     *int   `json:"minimum"`
+	}
+	type definition struct {
+		Description string              `json:"description"`
+		Properties  map[string]property `json:"properties"`
+		Required    []string            `json:"required"`
+	}
+	var doc struct {
+		Schema string                `json:"$schema"`
+		Ref    string                `json:"$ref"`
+		Defs   map[string]definition `json:"$defs"`
+	}
+	c.Assert(json.Unmarshal(out, &doc), qt.IsNil)
+	c.Assert(doc.Schema, qt.Equals, "https://json-schema.org/draft/2020-12/schema")
+	c.Assert(doc.Ref, qt.Equals, "#/$defs/Config")
+
+	// The config refers to other definitions within the document, and has no description of the CUE file
+	config := doc.Defs["Config"]
+	c.Assert(config.Description, qt.Equals, "")
+	c.Assert(config.Properties["Primary"].Ref, qt.Equals, "#/$defs/Server")
+	c.Assert(config.Properties["LaunchedAt"].Format, qt.Equals, "date-time")
+	c.Assert(config.Required, qt.Contains, "Weight")
+	c.Assert(doc.Defs["Server"].Properties["Host"].Description, qt.Equals, "Host is the hostname of the server")
+	_, hasMeta := doc.Defs["Meta"]
+	c.Assert(hasMeta, qt.IsFalse)
+
+	// Nullable pointers are given a null type
+	res = parseArchive(c, "testdata/options/null_default_pointers.txt")
+	out, err = NewGenerator(res, &Options{NullablePointers: NullPermitted}).JSONSchema(res.App.Services[0])
+	c.Assert(err, qt.IsNil)
+	c.Assert(json.Unmarshal(out, &doc), qt.IsNil)
+	c.Assert(doc.Defs["Config"].Properties["Name"].Type, qt.Equals, "string")
+	c.Assert(doc.Defs["Config"].Properties["Timeout"].Type, qt.DeepEquals, []any{"integer", "null"})
+	c.Assert(string(out), qt.Not(qt.Contains), "nullable")
+}
+
+func TestCodeGen_TopLevelMap(t *testing.T) {
+	c := qt.New(t)
+	res := parseArchive(c, "testdata/top_level_map.txt")
+
+	// Load the map within Tenants as the config, rather than Tenants itself
+	svc := res.App.Services[0]
+	decl := res.Meta.Decls[svc.ConfigLoads[0].ConfigStruct.Type.GetNamed().Id]
+	decl.Type = decl.Type.GetStruct().Fields[0].Typ
+
+	f, err := NewGenerator(res, nil).UserFacing(svc)
+	c.Assert(err, qt.IsNil)
+	golden.TestAgainst(c.TB, "top_level_map_root_svc.cue", string(f))
+
+	// Each top level field is a tenant
+	ctx := cuecontext.New()
+	schema := ctx.CompileBytes(f)
+	c.Assert(schema.Err(), qt.IsNil)
+	for data, valid := range map[string]bool{
+		`{acme: {Name: "Acme", Quota: 10}, globex: {Name: "Globex", Quota: 5}}`: true,
+		`{acme: {Name: "Acme"}}`: false,
+		`{acme: "Acme"}`:         false,
+	} {
+		err := schema.Unify(ctx.CompileString(data)).Validate(cue.Concrete(true))
+		c.Check(err == nil, qt.Equals, valid, qt.Commentf("data %s: %v", data, err))
+	}
+}
+
+func TestCodeGen_EmitRequiredAttr(t *testing.T) {
+	c := qt.New(t)
+	files := generateFromArchive(c, "testdata/options/emit_required_attr.txt", &Options{EmitRequiredAttr: true})
+
+	ctx := cuecontext.New()
+	schema := ctx.CompileBytes(files["svc"])
+	c.Assert(schema.Err(), qt.IsNil)
+
+	// Collect which fields carry the attribute, including optional fields
+	got := make(map[string]bool)
+	var collect func(prefix string, v cue.Value)
+	collect = func(prefix string, v cue.Value) {
+		iter, err := v.Fields(cue.Optional(true))
+		c.Assert(err, qt.IsNil)
+		for iter.Next() {
+			path := prefix + iter.Selector().String()
+			attr := iter.Value().Attribute("required")
+			if iter.IsOptional() {
+				got[path+"?"] = attr.Err() == nil
+			} else {
+				got[path] = attr.Err() == nil
+			}
+			if iter.Value().IncompleteKind() == cue.StructKind {
+				collect(path+".", iter.Value())
+			}
+		}
+	}
+	collect("", schema.LookupPath(cue.ParsePath("#Config")))
+
+	// region is optional in Config, but required by OtherConfig, so is required once merged
+	c.Assert(got, qt.DeepEquals, map[string]bool{
+		"Name":         true,
+		"Server":       true,
+		"Server.Host":  true,
+		"Server.Port?": false,
+		"Tags?":        false,
+		"replicas?":    false,
+		"region":       true,
+	})
+}
+
+func TestCodeGen_AnonymousConfigType(t *testing.T) {
+	c := qt.New(t)
+	named := generateFromArchive(c, "testdata/multiple_configs_in_service.txt", nil)
+
+	// Load ThisConfig's struct directly, rather than through its named type
+	res := parseArchive(c, "testdata/multiple_configs_in_service.txt")
+	svc := res.App.Services[0]
+	anonymized := false
+	for _, load := range svc.ConfigLoads {
+		if n := load.ConfigStruct.Type.GetNamed(); n != nil && res.Meta.Decls[n.Id].Name == "ThisConfig" {
+			load.ConfigStruct.Type = res.Meta.Decls[n.Id].Type
+			anonymized = true
+		}
+	}
+	c.Assert(anonymized, qt.IsTrue)
+
+	// The fields shared with the named config types are merged just the same
+	f, err := NewGenerator(res, nil).UserFacing(svc)
+	c.Assert(err, qt.IsNil)
+	c.Assert(string(f), qt.Equals, string(named[svc.Name]))
+
+	// Conflicts with anonymous config types are still reported
+	res = parseArchive(c, "testdata/errors/merge_mismatched_kinds.txt")
+	svc = res.App.Services[0]
+	for _, load := range svc.ConfigLoads {
+		if n := load.ConfigStruct.Type.GetNamed(); n != nil && res.Meta.Decls[n.Id].Name == "StorageConfig" {
+			load.ConfigStruct.Type = res.Meta.Decls[n.Id].Type
+		}
+	}
+	_, err = NewGenerator(res, nil).UserFacing(svc)
+	c.Assert(err, qt.ErrorMatches, "field Database is a struct in an anonymous struct, but a scalar in Config, so cannot be merged")
+}
+
+func TestCodeGen_DiscriminatedUnion(t *testing.T) {
+	c := qt.New(t)
+	files := generateFromArchive(c, "testdata/discriminated_union.txt", nil)
+
+	ctx := cuecontext.New()
+	schema := ctx.CompileBytes(files["svc"])
+	c.Assert(schema.Err(), qt.IsNil)
+
+	// Each union is annotated with its discriminator
+	attr := schema.LookupPath(cue.ParsePath("Uploads")).Attribute("discriminator")
+	c.Assert(attr.Err(), qt.IsNil)
+	c.Assert(attr.Contents(), qt.Equals, `"kind"`)
+
+	// Only the fields of the variant picked by the discriminator are allowed
+	valid := `Backups: {kind: "gcs", bucket: "b", project: "p"}, Cache: {type: "memory", size: 10}`
+	tests := []struct {
+		uploads string
+		valid   bool
+	}{
+		{`{kind: "s3", bucket: "b", region: "eu"}`, true},
+		{`{kind: "gcs", bucket: "b", project: "p"}`, true},
+		{`{kind: "s3", bucket: "b", project: "p"}`, false},
+		{`{kind: "azure", bucket: "b"}`, false},
+	}
+	for _, test := range tests {
+		err := schema.Unify(ctx.CompileString(fmt.Sprintf("Uploads: %s, %s", test.uploads, valid))).Validate(cue.Concrete(true))
+		c.Check(err == nil, qt.Equals, test.valid, qt.Commentf("uploads %s: %v", test.uploads, err))
+	}
+}
+
+func TestCodeGen_MergeRepeatedComments(t *testing.T) {
+	c := qt.New(t)
+	files := generateFromArchive(c, "testdata/merge_repeated_comments.txt", nil)
+
+	// Comments repeated across the config types, or already contained within
+	// another comment on the field, are only included once
+	for _, line := range []string{
+		"// Name is the name of the service.",
+		"// It is shown in the dashboard.",
+		"// It must not be empty.",
+	} {
+		c.Check(strings.Count(string(files["svc"]), line), qt.Equals, 1, qt.Commentf("comment %q", line))
+	}
+}
+
+// BenchmarkMergeWideStructs generates the config for a service which loads many
+// wide config types sharing the same field names, so every field is merged
+// across all of the loads along with its comments.
+func BenchmarkMergeWideStructs(b *testing.B) {
+	const loads, fields = 400, 20
+
+	var archive strings.Builder
+	archive.WriteString("-- svc/svc.go --\npackage svc\n\nimport \"context\"\n\n//encore:api\nfunc MyAPI(ctx context.Context) error { return nil }\n")
+	for i := 0; i < loads; i++ {
+		fmt.Fprintf(&archive, "-- svc/config%d.go --\npackage svc\n\nimport \"encore.dev/config\"\n\ntype Config%d struct {\n", i, i)
+		for j := 0; j < fields; j++ {
+			// Each comment is used by two of the loads, so half of them are duplicates
+			fmt.Fprintf(&archive, "    // Field%d is set by Config%d\n    Field%d string\n", j, i%(loads/2), j)
+		}
+		fmt.Fprintf(&archive, "}\n\nvar _ = config.Load[*Config%d]()\n", i)
+	}
+
+	c := qt.New(b)
+	path := c.TempDir() + "/wide.txt"
+	c.Assert(os.WriteFile(path, []byte(archive.String()), 0644), qt.IsNil)
+	res := parseArchive(c, path)
+	gen := NewGenerator(res, nil)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := gen.UserFacing(res.App.Services[0]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func mustParseExpr(c *qt.C, expr string) ast.Expr {
+	e, err := cueparser.ParseExpr("test", expr)
+	c.Assert(err, qt.IsNil)
+	return e
+}
+
+func TestEnvironmentScaffolds(t *testing.T) {
+	c := qt.New(t)
+	res := parseArchive(c, "testdata/default_tag.txt")
+	gen := NewGenerator(res, nil)
+	svc := res.App.Services[0]
+
+	generated, err := gen.UserFacing(svc)
+	c.Assert(err, qt.IsNil)
+	files, err := gen.EnvironmentScaffolds(svc)
+	c.Assert(err, qt.IsNil)
+	c.Assert(files, qt.HasLen, 3)
+
+	// Only the field without a default is stubbed out
+	local := string(files["local.cue"])
+	c.Assert(local, qt.Contains, "if #Meta.Environment.Cloud == \"local\" {\n\tReplicas: uint8\n}")
+	c.Assert(local, qt.Not(qt.Contains), "Port")
+
+	// Once filled in, the values are used only in the matching environment
+	ctx := cuecontext.New()
+	filled := strings.Replace(strings.Replace(local, "package svc", "", 1), "Replicas: uint8", "Replicas: 3", 1)
+	for env, valid := range map[string]bool{
+		`{Name: "local", Type: "development", Cloud: "local"}`:  true,
+		`{Name: "staging", Type: "development", Cloud: "gcp"}`:  false,
+		`{Name: "prod", Type: "production", Cloud: "encore"}`:   false,
+		`{Name: "preview", Type: "ephemeral", Cloud: "encore"}`: false,
+	} {
+		value := ctx.CompileString(string(generated) + filled + "\n#Meta: Environment: " + env)
+		err := value.Validate(cue.Concrete(true))
+		c.Check(err == nil, qt.Equals, valid, qt.Commentf("environment %s: %v", env, err))
+	}
+
+	// Services whose config is entirely defaulted need no scaffolds
+	res = parseArchive(c, "testdata/config_value_defaults.txt")
+	svc = res.App.Services[0]
+	config := res.Meta.Decls[svc.ConfigLoads[0].ConfigStruct.Type.GetNamed().Id].Type.GetStruct()
+	config.Fields = config.Fields[:3]
+	files, err = NewGenerator(res, nil).EnvironmentScaffolds(svc)
+	c.Assert(err, qt.IsNil)
+	c.Assert(files, qt.IsNil)
+}
+
+func TestScaffoldedFiles(t *testing.T) {
+	c := qt.New(t)
+	res := parseArchive(c, "testdata/default_tag.txt")
+	svc := res.App.Services[0]
+
+	generated, err := NewGenerator(res, nil).UserFacing(svc)
+	c.Assert(err, qt.IsNil)
+	c.Assert(ScaffoldedFiles(generated), qt.Equals, "")
+
+	// The scaffolded files are recorded in the header, and not read from elsewhere in the file
+	gen := NewGenerator(res, &Options{ServiceMetadata: func(*est.Service) map[string]string {
+		return map[string]string{ScaffoldedMetadata: "local.cue, production.cue", "owner": "payments"}
+	}})
+	generated, err = gen.UserFacing(svc)
+	c.Assert(err, qt.IsNil)
+	c.Assert(ScaffoldedFiles(generated), qt.Equals, "local.cue, production.cue")
+
+	user := []byte(UserSectionMarker + "\n// scaffolded: development.cue\n")
+	generated, err = NewGenerator(res, nil).UserFacing(svc)
+	c.Assert(err, qt.IsNil)
+	c.Assert(ScaffoldedFiles(gen.PreserveUserSection(generated, user)), qt.Equals, "")
+}
+
+func generateFromArchive(c *qt.C, path string, opts *Options) map[string][]byte {
+	res := parseArchive(c, path)
+	gen := NewGenerator(res, opts)
+
+	files := make(map[string][]byte)
+	for _, svc := range res.App.Services {
+		f, err := gen.UserFacing(svc)
+		c.Assert(err, qt.IsNil)
+		files[svc.Name] = f
+	}
+	return files
+}
+
+func parseArchive(c *qt.C, path string) *parser.Result {
+	archiveData, err := os.ReadFile(path)
+	c.Assert(err, qt.IsNil)
+	a := txtar.Parse(archiveData)
+	base := c.TempDir()
+	err = txtar.Write(a, base)
+	c.Assert(err, qt.IsNil, qt.Commentf("archive %s", path))
+
+	res, err := parser.Parse(&parser.Config{
+		AppRoot:    base,
+		ModulePath: "encore.app",
+		WorkingDir: ".",
+	})
+	c.Assert(err, qt.IsNil)
+	return res
+}
+
+func TestMarkdownDocs(t *testing.T) {
+	c := qt.New(t)
+	res := parseArchive(c, "testdata/default_tag.txt")
+	out, err := NewGenerator(res, nil).MarkdownDocs(res.App.Services[0])
+	c.Assert(err, qt.IsNil)
+
+	// Fields are listed with their defaults separately from their types
+	doc := string(out)
+	c.Assert(doc, qt.Contains, "# svc config\n\n## #Config\n")
+	c.Assert(doc, qt.Contains, "| `Port` | `int` | no | `8080` | The port to listen on |\n")
+	c.Assert(doc, qt.Contains, "| `Timeout` | `string & time.Duration` | no | `\"30s\"` |  |\n")
+	c.Assert(doc, qt.Contains, "| `Replicas` | `uint8` | yes |  |  |\n")
+
+	// Definitions are documented after the config which refers to them
+	res = parseArchive(c, "testdata/basic_named_struct_multiple_uses.txt")
+	out, err = NewGenerator(res, nil).MarkdownDocs(res.App.Services[0])
+	c.Assert(err, qt.IsNil)
+	doc = string(out)
+	c.Assert(doc, qt.Contains, "| `HTTP` | `#ServerOptions` | yes |  | The options for the HTTP server |\n")
+	c.Assert(doc, qt.Contains, "## #ServerOptions\n\nServerOptions represent options for a server\n")
+	c.Assert(strings.Index(doc, "## #Config") < strings.Index(doc, "## #ServerOptions"), qt.IsTrue)
+
+	// Fields of inline structs are listed by their path, and pipes are escaped within the table
+	res = parseArchive(c, "testdata/enums.txt")
+	out, err = NewGenerator(res, nil).MarkdownDocs(res.App.Services[0])
+	c.Assert(err, qt.IsNil)
+	c.Assert(string(out), qt.Contains, "| `Priority` | `1 \\| 2 \\| 3` | yes |  | The priority of the service |\n")
+	res = parseArchive(c, "testdata/basic_inline_struct.txt")
+	out, err = NewGenerator(res, nil).MarkdownDocs(res.App.Services[0])
+	c.Assert(err, qt.IsNil)
+	c.Assert(string(out), qt.Contains, "| `HTTP.Port` | `uint32` | yes |  | What port should we run on? |\n")
+}
@@ -0,0 +1,107 @@
+package cuegen
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/encoding/openapi"
+
+	"encr.dev/parser/est"
+)
+
+// jsonSchemaDialect is the JSON Schema draft the generated schemas conform to. It's the
+// draft OpenAPI 3.1 schemas are based on, so the output of CUE's OpenAPI encoder needs
+// only its references and nullable types rewritten.
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// JSONSchema generates a JSON Schema document describing the config of the given service,
+// for tools which validate or autocomplete config given as JSON or YAML rather than CUE.
+//
+// The schema is exported from the CUE which UserFacing generates with the OpenAPICompatible
+// option, so it carries the same constraints and documentation. The config is described at
+// the root of the document, with any definitions it refers to under `$defs`, including any
+// which would otherwise be generated into Options.SharedPackage. As with the OpenAPICompatible
+// option, fields which are conditionally present cannot be exported, nor can constraints with
+// no equivalent in JSON Schema, such as those between fields or on the length of tuples, in
+// which case an error is returned.
+func (g *Generator) JSONSchema(svc *est.Service) ([]byte, error) {
+	opts := *g.opts
+	opts.OpenAPICompatible = true
+	opts.Environments = nil
+	opts.SharedPackage = ""
+	src, err := NewGenerator(g.res, &opts).UserFacing(svc)
+	if err != nil || len(src) == 0 {
+		return nil, err
+	}
+
+	var r cue.Runtime
+	inst, err := r.Compile(svc.Name+".cue", src)
+	if err != nil {
+		return nil, fmt.Errorf("service %s: %w", svc.Name, err)
+	}
+	schemas, err := (&openapi.Config{Version: "3.1.0"}).Schemas(inst)
+	if err != nil {
+		return nil, fmt.Errorf("service %s: unable to export the config schema: %w", svc.Name, err)
+	}
+
+	data, err := json.Marshal(schemas)
+	if err != nil {
+		return nil, fmt.Errorf("service %s: unable to export the config schema: %w", svc.Name, err)
+	}
+	var defs map[string]any
+	if err := json.Unmarshal(data, &defs); err != nil {
+		return nil, err
+	}
+	for name, def := range defs {
+		defs[name] = toJSONSchema(def)
+	}
+
+	// The metadata of the environment is given by Encore, rather than in config,
+	// and the description of #Config only concerns the CUE file
+	delete(defs, "Meta")
+	if config, ok := defs["Config"].(map[string]any); ok {
+		delete(config, "description")
+	}
+
+	doc := map[string]any{
+		"$schema": jsonSchemaDialect,
+		"title":   svc.Name,
+		"$ref":    "#/$defs/Config",
+		"$defs":   defs,
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// toJSONSchema rewrites a schema exported by CUE's OpenAPI encoder into JSON Schema, by
+// pointing references at `$defs` rather than the components of an OpenAPI document, and
+// replacing the nullable keyword with a null type.
+func toJSONSchema(schema any) any {
+	switch schema := schema.(type) {
+	case map[string]any:
+		for key, value := range schema {
+			if ref, ok := value.(string); ok && key == "$ref" {
+				schema[key] = strings.Replace(ref, "#/components/schemas/", "#/$defs/", 1)
+			} else {
+				schema[key] = toJSONSchema(value)
+			}
+		}
+		if nullable, _ := schema["nullable"].(bool); nullable {
+			delete(schema, "nullable")
+			if typ, ok := schema["type"].(string); ok {
+				schema["type"] = []any{typ, "null"}
+			} else {
+				schema = map[string]any{"anyOf": []any{schema, map[string]any{"type": "null"}}}
+			}
+		}
+		return schema
+	case []any:
+		for i, value := range schema {
+			schema[i] = toJSONSchema(value)
+		}
+		return schema
+	default:
+		return schema
+	}
+}
@@ -0,0 +1,176 @@
+package cuegen
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/ast"
+	"cuelang.org/go/cue/cuecontext"
+	"cuelang.org/go/cue/format"
+	"cuelang.org/go/cue/parser"
+	"cuelang.org/go/cue/token"
+
+	"encr.dev/parser/est"
+)
+
+// MarkdownDocs generates a markdown reference of the config of the given service, for
+// publishing alongside the service without needing to read the generated CUE.
+//
+// The reference is rendered from the CUE which UserFacing generates, so it documents the
+// fields as they must be given in config. Each field of #Config, and of each definition it
+// refers to, is listed in a table with its type, whether it must be given, its default and
+// its documentation. Fields of inline structs are listed by their path (i.e. `Database.Host`).
+// No document is returned if the service doesn't load any config.
+func (g *Generator) MarkdownDocs(svc *est.Service) ([]byte, error) {
+	generated, err := g.standalone().UserFacing(svc)
+	if err != nil || len(generated) == 0 {
+		return nil, err
+	}
+
+	file, err := parser.ParseFile("encore.gen.cue", generated, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("service %s: %w", svc.Name, err)
+	}
+	// The value is only used to find which fields have defaults, so it's not an error for it to be incomplete,
+	// such as when fields are only present in some environments
+	value := cuecontext.New().BuildFile(file)
+
+	// #Config is documented first, followed by the definitions it refers to in the order they're generated
+	var config *ast.Field
+	var definitions []*ast.Field
+	for _, decl := range file.Decls {
+		field, ok := decl.(*ast.Field)
+		if !ok {
+			continue
+		}
+		switch name, _, _ := ast.LabelName(field.Label); {
+		case name == "#Config":
+			config = field
+		case name == "#Meta", !strings.HasPrefix(name, "#"):
+			// The metadata is given by Encore rather than in config
+		default:
+			definitions = append(definitions, field)
+		}
+	}
+	if config == nil {
+		return nil, fmt.Errorf("service %s: no #Config definition was generated", svc.Name)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# %s config\n", svc.Name)
+	for _, def := range append([]*ast.Field{config}, definitions...) {
+		name, _, _ := ast.LabelName(def.Label)
+		fmt.Fprintf(&buf, "\n## %s\n\n", name)
+		if doc := docText(def, true); doc != "" && def != config {
+			fmt.Fprintf(&buf, "%s\n\n", doc)
+		}
+
+		defValue := value.LookupPath(cue.MakePath(cue.Def(strings.TrimPrefix(name, "#"))))
+		struc, ok := def.Value.(*ast.StructLit)
+		if !ok {
+			// Definitions of other types, such as enums, are documented by their type alone
+			fmt.Fprintf(&buf, "`%s`\n", exprSource(def.Value))
+			continue
+		}
+
+		buf.WriteString("| Field | Type | Required | Default | Description |\n")
+		buf.WriteString("| ----- | ---- | -------- | ------- | ----------- |\n")
+		writeFieldRows(&buf, defValue, struc, "")
+	}
+	return buf.Bytes(), nil
+}
+
+// writeFieldRows writes a table row for each field of the struct, recursing into the fields of
+// inline structs with their path prefixed by the given prefix.
+func writeFieldRows(buf *bytes.Buffer, parent cue.Value, struc *ast.StructLit, prefix string) {
+	for _, decl := range struc.Elts {
+		// Fields given in conditions, such as those only present in some environments,
+		// are documented where they are declared within the condition
+		if comp, ok := decl.(*ast.Comprehension); ok {
+			if inner, ok := comp.Value.(*ast.StructLit); ok {
+				writeFieldRows(buf, parent, inner, prefix)
+			}
+			continue
+		}
+		field, ok := decl.(*ast.Field)
+		if !ok {
+			continue
+		}
+		name, _, err := ast.LabelName(field.Label)
+		if err != nil || strings.HasPrefix(name, "_") || strings.HasPrefix(name, "#") {
+			continue
+		}
+		path := prefix + name
+		fieldValue := parent.LookupPath(cue.MakePath(cue.Str(name)))
+
+		if inner, ok := field.Value.(*ast.StructLit); ok {
+			writeFieldRows(buf, fieldValue, inner, path+".")
+			continue
+		}
+
+		required := "yes"
+		if field.Optional != token.NoPos || fieldValue.Validate(cue.Concrete(true)) == nil {
+			required = "no"
+		}
+		var defaultValue string
+		if def, ok := fieldValue.Default(); ok && def.IsConcrete() {
+			if syntax, ok := def.Syntax(cue.Final()).(ast.Expr); ok {
+				defaultValue = "`" + exprSource(syntax) + "`"
+			}
+		}
+
+		fmt.Fprintf(buf, "| `%s` | `%s` | %s | %s | %s |\n",
+			path,
+			exprSource(withoutDefault(field.Value)),
+			required,
+			defaultValue,
+			docText(field, false),
+		)
+	}
+}
+
+// withoutDefault returns the expression with any default removed from its disjunctions,
+// as the default is documented separately from the type.
+func withoutDefault(expr ast.Expr) ast.Expr {
+	bin, ok := expr.(*ast.BinaryExpr)
+	if !ok || bin.Op != token.OR {
+		return expr
+	}
+	if unary, ok := bin.Y.(*ast.UnaryExpr); ok && unary.Op == token.MUL {
+		return withoutDefault(bin.X)
+	}
+	if unary, ok := bin.X.(*ast.UnaryExpr); ok && unary.Op == token.MUL {
+		return withoutDefault(bin.Y)
+	}
+	return &ast.BinaryExpr{X: withoutDefault(bin.X), Op: bin.Op, Y: withoutDefault(bin.Y)}
+}
+
+// exprSource formats the expression on a single line, escaped to be placed within a table cell
+func exprSource(expr ast.Expr) string {
+	src, err := format.Node(expr, format.Simplify())
+	if err != nil {
+		return ""
+	}
+	return markdownCell(string(src))
+}
+
+// docText returns the text of the comments attached to the node, either those above
+// it or all of them, escaped to be placed within a table cell.
+func docText(node ast.Node, docOnly bool) string {
+	var lines []string
+	for _, group := range ast.Comments(node) {
+		if docOnly && !group.Doc {
+			continue
+		}
+		lines = append(lines, group.Text())
+	}
+	return markdownCell(strings.Join(lines, " "))
+}
+
+// markdownCell collapses the text onto a single line and escapes any pipes,
+// so it doesn't break the table it's placed in
+func markdownCell(text string) string {
+	return strings.ReplaceAll(strings.Join(strings.Fields(text), " "), "|", `\|`)
+}
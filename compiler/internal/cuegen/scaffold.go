@@ -0,0 +1,154 @@
+package cuegen
+
+import (
+	"bytes"
+	"fmt"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/ast"
+	"cuelang.org/go/cue/cuecontext"
+	"cuelang.org/go/cue/format"
+	"cuelang.org/go/cue/parser"
+	"cuelang.org/go/cue/token"
+
+	"encr.dev/parser/est"
+)
+
+// environmentScaffolds are the config files scaffolded for a service, along with the
+// condition on the #Meta.Environment tags under which the config within each is used.
+var environmentScaffolds = []struct {
+	file      string
+	desc      string
+	condition string
+}{
+	{"local.cue", "when running the app locally", `#Meta.Environment.Cloud == "local"`},
+	{"development.cue", "in development environments", `#Meta.Environment.Type == "development" && #Meta.Environment.Cloud != "local"`},
+	{"production.cue", "in production environments", `#Meta.Environment.Type == "production"`},
+}
+
+// EnvironmentScaffolds generates skeleton config files for the service, keyed by file name,
+// for its local, development and production environments. Each holds the fields of #Config
+// which must be given, stubbed out with their types, within a condition on the #Meta.Environment
+// tags, so the values for each environment can be filled in by hand.
+//
+// Unlike the generated CUE file the scaffolds are written once and then owned by the user,
+// so they should never overwrite an existing file. No files are returned if the service
+// doesn't load any config, or if every field of its config has a default.
+func (g *Generator) EnvironmentScaffolds(svc *est.Service) (map[string][]byte, error) {
+	generated, err := g.standalone().UserFacing(svc)
+	if err != nil || len(generated) == 0 {
+		return nil, err
+	}
+
+	stubs, pkgName, err := requiredConfigFields(generated)
+	if err != nil {
+		return nil, fmt.Errorf("service %s: %w", svc.Name, err)
+	}
+	if len(stubs) == 0 {
+		return nil, nil
+	}
+
+	files := make(map[string][]byte, len(environmentScaffolds))
+	for _, env := range environmentScaffolds {
+		condition, err := parser.ParseExpr(env.file, env.condition)
+		if err != nil {
+			return nil, err
+		}
+
+		pkg := &ast.Package{Name: ast.NewIdent(pkgName)}
+		ast.AddComment(pkg, &ast.CommentGroup{
+			Doc: true,
+			List: []*ast.Comment{
+				{Text: fmt.Sprintf("// The config of the %s service used %s.", svc.Name, env.desc)},
+				{Text: "//"},
+				{Text: "// This file was scaffolded by Encore and is yours to edit. Replace the type of each"},
+				{Text: "// field with the value to use, and remove any fields which are given elsewhere."},
+			},
+		})
+		values := &ast.Comprehension{
+			Clauses: []ast.Clause{&ast.IfClause{Condition: condition}},
+			Value:   ast.NewStruct(),
+		}
+		ast.SetRelPos(values, token.NewSection)
+		values.Value.(*ast.StructLit).Elts = stubs
+
+		content, err := format.Node(&ast.File{Decls: []ast.Decl{pkg, values}}, format.Simplify())
+		if err != nil {
+			return nil, fmt.Errorf("service %s: unable to format %s: %w", svc.Name, env.file, err)
+		}
+		files[env.file] = content
+	}
+	return files, nil
+}
+
+// ScaffoldedMetadata is the key of the service metadata (see Options.ServiceMetadata) recording
+// the config files scaffolded for a service, so the record is kept in its generated file and the
+// files aren't scaffolded again once the user has deleted them.
+const ScaffoldedMetadata = "scaffolded"
+
+// ScaffoldedFiles returns the config files recorded in the header of a previously generated
+// file as having been scaffolded for its service (i.e. "local.cue, production.cue"), or empty
+// if none were.
+func ScaffoldedFiles(content []byte) string {
+	generated, _ := splitUserSection(content)
+	prefix := []byte("// " + ScaffoldedMetadata + ": ")
+	for _, line := range bytes.Split(generated, []byte("\n")) {
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		if bytes.HasPrefix(line, prefix) {
+			return string(line[len(prefix):])
+		} else if len(line) > 0 && !bytes.HasPrefix(line, []byte("//")) {
+			// The metadata is only recorded in the header
+			break
+		}
+	}
+	return ""
+}
+
+// requiredConfigFields returns stubs for the fields of #Config within the generated file which
+// must be given, as they are neither optional nor have a default or constant value, along with
+// the name of the package the file is in.
+func requiredConfigFields(generated []byte) (stubs []ast.Decl, pkgName string, err error) {
+	file, err := parser.ParseFile("encore.gen.cue", generated)
+	if err != nil {
+		return nil, "", err
+	}
+	value := cuecontext.New().BuildFile(file)
+	if err := value.Err(); err != nil {
+		return nil, "", err
+	}
+
+	var config *ast.StructLit
+	for _, decl := range file.Decls {
+		if field, ok := decl.(*ast.Field); ok {
+			if name, _, _ := ast.LabelName(field.Label); name == "#Config" {
+				config, _ = field.Value.(*ast.StructLit)
+			}
+		}
+	}
+	if config == nil {
+		return nil, "", fmt.Errorf("no #Config definition was generated")
+	}
+
+	for _, decl := range config.Elts {
+		field, ok := decl.(*ast.Field)
+		if !ok || field.Optional != token.NoPos {
+			continue
+		}
+		name, _, err := ast.LabelName(field.Label)
+		if err != nil {
+			continue
+		}
+
+		// Fields with a default or constant value can be left out
+		fieldValue := value.LookupPath(cue.MakePath(cue.Def("Config"), cue.Str(name)))
+		if fieldValue.Validate(cue.Concrete(true)) == nil {
+			continue
+		}
+		var label ast.Label = ast.NewString(name)
+		if ast.IsValidIdent(name) {
+			label = ast.NewIdent(name)
+		}
+		stubs = append(stubs, &ast.Field{Label: label, Value: field.Value})
+	}
+	return stubs, file.PackageName(), nil
+}
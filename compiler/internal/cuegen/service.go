@@ -1,16 +1,32 @@
 package cuegen
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"go/constant"
+	"path"
 	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"cuelang.org/go/cue/ast"
+	"cuelang.org/go/cue/format"
 	"cuelang.org/go/cue/parser"
 	"cuelang.org/go/cue/token"
+	"golang.org/x/exp/maps"
 	"golang.org/x/exp/slices"
 
 	"encr.dev/parser/encoding"
 	"encr.dev/parser/est"
+	"encr.dev/pkg/cueutil"
+	"encr.dev/pkg/idents"
 	schema "encr.dev/proto/encore/parser/schema/v1"
 )
 
@@ -18,43 +34,179 @@ import (
 // from all of it's config.Load calls
 type service struct {
 	g              *Generator
+	ctx            context.Context
 	svc            *est.Service
 	file           *ast.File
 	neededImports  map[string]string // map of package path to name
-	topLevelFields []any
+	topLevelFields []ast.Decl
 	fieldLookup    map[string]*ast.Field
+	fieldOrigins   map[string]fieldOrigin     // map of top level field name to where it was first declared
+	fieldComments  map[string]map[string]bool // map of top level field name to the comments it already has
+	usesEnv        bool                       // whether any fields are only present in some environments
+	shared         bool                       // whether the file is of Options.SharedPackage, rather than a service
+	fieldPath      []string                   // the labels of the fields currently being generated
+	secretTags     map[string]string          // the path of the field each secret tag is injected into, by tag name
+	diagnostics    []Diagnostic               // warnings found while generating the file
 
 	typeUsage *definitionGenerator
 }
 
-// countNamedUsagesAndCollectImports counts the number of times a named type is used in the service
-func (s *service) countNamedUsagesAndCollectImports(typ *schema.Type) error {
+// fieldOrigin records the config type a top level field was first declared in,
+// along with the kind of value the field holds
+type fieldOrigin struct {
+	typeName string
+	kind     string
+}
+
+// errUnrepresentableType is returned for types which have no representation in the schema, such as
+// functions and channels, as those types can't be given in config, so are left without a type
+var errUnrepresentableType = errors.New("function and channel types cannot be represented in config")
+
+// countNamedUsages counts the number of times a named type is used in the service
+func (s *service) countNamedUsages(typ *schema.Type) error {
 	return schema.Walk(s.g.res.Meta.Decls, typ, func(node any) error {
-		switch typ := node.(type) {
+		switch node := node.(type) {
+		case *schema.Struct:
+			// Check the fields before they are walked, as the walk can't descend into fields without a type
+			for _, f := range node.Fields {
+				if f.Typ.GetTyp() == nil {
+					return fmt.Errorf("field %s: %w", f.Name, errUnrepresentableType)
+				}
+			}
 		case *schema.Named:
-			s.typeUsage.Inc(typ)
-
-		case schema.Builtin:
-			if typ == schema.Builtin_TIME {
-				s.neededImports["time"] = "time"
+			// The fields of custom types are never generated, so aren't walked,
+			// nor are those of shared types as they're generated by the shared package
+			if _, isCustom := s.customType(node); isCustom {
+				return schema.SkipChildren
+			}
+			if _, isShared := s.sharedType(node); isShared {
+				return schema.SkipChildren
+			}
+			s.typeUsage.Inc(node)
+		case *schema.Map:
+			// Count the shapes of anonymous structs used as map values, so they can be shared.
+			// Structs using type parameters only have a shape once the type is instantiated
+			if stru := node.Value.GetStruct(); stru != nil && !hasTypeParameters(node.Value) {
+				s.typeUsage.IncShape(stru)
 			}
 		}
 		return nil
 	})
 }
 
+// markRecursiveTypes marks any named types which refer back to themselves, either
+// directly or through struct fields, map values, list elements, pointers or other named types.
+//
+// Recursive types cannot be inlined, so they are always generated as definitions
+// regardless of how many times they are used. Pointers to them are optional, as
+// a nil pointer is where the recursion ends.
+func (s *service) markRecursiveTypes(typ *schema.Type, chain []*schema.Named) error {
+	switch t := typ.Typ.(type) {
+	case *schema.Type_Named:
+		if _, isCustom := s.customType(t.Named); isCustom {
+			return nil
+		}
+		if _, isShared := s.sharedType(t.Named); isShared {
+			return nil
+		}
+		// Every type on the cycle is recursive, not just the one which closes it,
+		// otherwise the others could be inlined into a structure which never ends
+		id := s.typeUsage.ID(t.Named)
+		for i, named := range chain {
+			if s.typeUsage.ID(named) == id {
+				for _, cyclic := range chain[i:] {
+					s.typeUsage.MarkRecursive(cyclic)
+				}
+				return nil
+			}
+		}
+
+		concrete, err := encoding.GetConcreteType(s.g.res.Meta.Decls, typ, nil)
+		if err != nil {
+			return err
+		}
+		return s.markRecursiveTypes(concrete, append(chain, t.Named))
+	case *schema.Type_Struct:
+		for _, f := range t.Struct.Fields {
+			if err := s.markRecursiveTypes(f.Typ, chain); err != nil {
+				return err
+			}
+		}
+	case *schema.Type_Map:
+		if err := s.markRecursiveTypes(t.Map.Key, chain); err != nil {
+			return err
+		}
+		return s.markRecursiveTypes(t.Map.Value, chain)
+	case *schema.Type_List:
+		return s.markRecursiveTypes(t.List.Elem, chain)
+	case *schema.Type_Pointer:
+		return s.markRecursiveTypes(t.Pointer.Base, chain)
+	case *schema.Type_Config:
+		return s.markRecursiveTypes(t.Config.Elem, chain)
+	}
+	return nil
+}
+
+// isRecursivePointer reports whether the type is a pointer to a recursive type, which may be
+// within a config wrapper. Such pointers must be optional, as otherwise the config would have
+// to be infinitely deep.
+func (s *service) isRecursivePointer(typ *schema.Type) bool {
+	for typ.GetConfig() != nil {
+		typ = typ.GetConfig().Elem
+	}
+	named := typ.GetPointer().GetBase().GetNamed()
+	return named != nil && s.isRecursive(named)
+}
+
 func (s *service) registerTopLevelField(typ *schema.Type) error {
-	concrete, err := encoding.GetConcreteStructType(s.g.res.Meta.Decls, typ, nil)
+	concreteType, err := s.concreteType(typ)
 	if err != nil {
 		return err
 	}
 
-	fields, err := s.structToFields(concrete)
+	// A map holds every field at the top level of the config, so rather than fields,
+	// its values are given by a pattern constraint on all the top level fields
+	if concreteType.GetMap() != nil {
+		value, err := s.toCueType(concreteType)
+		if err != nil {
+			return err
+		}
+		s.topLevelFields = append(s.topLevelFields, value.(*ast.StructLit).Elts...)
+		return nil
+	}
+
+	concrete := concreteType.GetStruct()
+	if concrete == nil {
+		return fmt.Errorf("config type %s must be a struct or a map, as its fields are given at the top level of the config", s.typeName(typ))
+	}
+	if discriminatorField(concrete) != nil {
+		return fmt.Errorf("config type %s cannot be a discriminated union, as its fields are given at the top level of the config", s.typeName(typ))
+	}
+
+	decls, err := s.structToFields(concrete)
 	if err != nil {
 		return err
 	}
 
-	for _, field := range fields {
+	// Work out the kind of value each field holds, so fields which can't be merged are caught
+	typeName := s.typeName(typ)
+	kinds := make(map[string]string, len(concrete.Fields))
+	for _, f := range concrete.Fields {
+		kind, err := s.valueKind(f.Typ)
+		if err != nil {
+			return err
+		}
+		kinds[fieldLabel(f)] = kind
+	}
+
+	for _, decl := range decls {
+		// Declarations other than fields (such as the guards of aliases) can't be merged
+		field, isField := decl.(*ast.Field)
+		if !isField {
+			s.topLevelFields = append(s.topLevelFields, decl)
+			continue
+		}
+
 		name, _, err := ast.LabelName(field.Label)
 		if err != nil {
 			return err
@@ -65,13 +217,23 @@ func (s *service) registerTopLevelField(typ *schema.Type) error {
 		// the same service to either the same or different struct types
 		// with both have the same field name
 		if existing, found := s.fieldLookup[name]; found {
+			// Values of different kinds would unify into a field no config could satisfy
+			if origin, found := s.fieldOrigins[name]; found && origin.kind != "" && kinds[name] != "" && origin.kind != kinds[name] {
+				return fmt.Errorf("field %s is a %s in %s, but a %s in %s, so cannot be merged", name, origin.kind, origin.typeName, kinds[name], typeName)
+			}
+
 			if len(field.Comments()) > 0 {
+				seen := s.fieldComments[name]
 				if len(existing.Comments()) == 0 {
 					existing.SetComments(field.Comments())
+					for _, comment := range field.Comments() {
+						addCommentTexts(seen, comment)
+					}
 				} else {
 					existingCommentGrp := existing.Comments()[0]
 					for _, comment := range field.Comments() {
-						if !commentAlreadyPresent(existing, comment) {
+						if !seen[commentText(comment.List)] {
+							addCommentTexts(seen, comment)
 							existingCommentGrp.List = append(existingCommentGrp.List, comment.List...)
 						}
 					}
@@ -87,11 +249,26 @@ func (s *service) registerTopLevelField(typ *schema.Type) error {
 
 			// Merge the values if they are different
 			if !reflect.DeepEqual(existing.Value, field.Value) {
-				existing.Value = ast.NewBinExpr(token.AND, existing.Value, field.Value)
+				merged, err := mergeValues(name, existing.Value, field.Value)
+				if err != nil {
+					return err
+				}
+				existing.Value = merged
+			}
+
+			// The field is only optional if every config.Load call treats it as optional
+			if field.Optional == token.NoPos {
+				existing.Optional = token.NoPos
+				s.addRequiredAttribute(existing)
 			}
 		} else {
 			// otherwise add this field
 			s.fieldLookup[name] = field
+			s.fieldOrigins[name] = fieldOrigin{typeName: typeName, kind: kinds[name]}
+			s.fieldComments[name] = make(map[string]bool)
+			for _, comment := range field.Comments() {
+				addCommentTexts(s.fieldComments[name], comment)
+			}
 			s.topLevelFields = append(s.topLevelFields, field)
 		}
 	}
@@ -99,6 +276,92 @@ func (s *service) registerTopLevelField(typ *schema.Type) error {
 	return nil
 }
 
+// mergeValues merges the values of a field declared by multiple config types.
+//
+// The value of the field must satisfy all of the types, so the values are unified. If both
+// values are enums, the values allowed by both are computed up front rather than leaving CUE
+// to intersect the disjunctions, so the result is readable and enums which have no values in
+// common are reported rather than generating a field no config could satisfy.
+func mergeValues(name string, a, b ast.Expr) (ast.Expr, error) {
+	aValues, aIsEnum := enumValues(a)
+	bValues, bIsEnum := enumValues(b)
+	if !aIsEnum || !bIsEnum {
+		return ast.NewBinExpr(token.AND, a, b), nil
+	}
+
+	var common []ast.Expr
+	for _, aValue := range aValues {
+		for _, bValue := range bValues {
+			if aValue.Kind == bValue.Kind && aValue.Value == bValue.Value {
+				common = append(common, aValue)
+				break
+			}
+		}
+	}
+	if len(common) == 0 {
+		return nil, fmt.Errorf("field %s is an enum in multiple config types, but the enums have no values in common", name)
+	}
+	return ast.NewBinExpr(token.OR, common...), nil
+}
+
+// enumValues returns the values of an enum, if the expression is a disjunction of literals
+func enumValues(expr ast.Expr) ([]*ast.BasicLit, bool) {
+	switch expr := expr.(type) {
+	case *ast.BasicLit:
+		return []*ast.BasicLit{expr}, true
+	case *ast.BinaryExpr:
+		if expr.Op != token.OR {
+			return nil, false
+		}
+		x, ok := enumValues(expr.X)
+		if !ok {
+			return nil, false
+		}
+		y, ok := enumValues(expr.Y)
+		if !ok {
+			return nil, false
+		}
+		return append(x, y...), true
+	default:
+		return nil, false
+	}
+}
+
+// typeName returns the name of a config type for use in error messages
+func (s *service) typeName(typ *schema.Type) string {
+	switch t := typ.Typ.(type) {
+	case *schema.Type_Named:
+		return s.g.res.Meta.Decls[t.Named.Id].Name
+	case *schema.Type_Pointer:
+		return s.typeName(t.Pointer.Base)
+	default:
+		return "an anonymous struct"
+	}
+}
+
+// valueKind returns the kind of value a type is represented by in config (a struct, list or scalar),
+// or an empty string if the kind is not known
+func (s *service) valueKind(typ *schema.Type) (string, error) {
+	concrete, err := s.concreteType(typ)
+	if err != nil {
+		return "", err
+	}
+
+	switch concrete.Typ.(type) {
+	case *schema.Type_Struct, *schema.Type_Map:
+		return "struct", nil
+	case *schema.Type_List:
+		return "list", nil
+	case *schema.Type_Builtin:
+		if concrete.GetBuiltin() == schema.Builtin_ANY || concrete.GetBuiltin() == schema.Builtin_JSON {
+			return "", nil
+		}
+		return "scalar", nil
+	default:
+		return "", nil
+	}
+}
+
 func (s *service) generateCue() error {
 	// If there are no top level fields, we've got nothing to do here
 	if len(s.topLevelFields) == 0 {
@@ -106,9 +369,16 @@ func (s *service) generateCue() error {
 	}
 
 	// Add the package name and decription comment
-	pkg := &ast.Package{Name: ast.NewIdent(s.svc.Name)}
+	pkgName := packageName(s.svc.Name)
+	if s.g.opts.PackageName != nil {
+		pkgName = s.g.opts.PackageName(s.svc)
+		if !ast.IsValidIdent(pkgName) || token.Lookup(pkgName) != token.IDENT {
+			return fmt.Errorf("invalid package name %q for service %s: must be a valid CUE identifier", pkgName, s.svc.Name)
+		}
+	}
+	pkg := &ast.Package{Name: ast.NewIdent(pkgName)}
 	s.file.Decls = append(s.file.Decls, pkg)
-	s.file.AddComment(&ast.CommentGroup{
+	header := &ast.CommentGroup{
 		List: []*ast.Comment{
 			{Text: "// Code generated by encore. DO NOT EDIT."},
 			{Text: "//"},
@@ -120,40 +390,78 @@ func (s *service) generateCue() error {
 			{Text: "// For more information about this file, see:"},
 			{Text: "// https://encore.dev/docs/develop/config"},
 		},
-	})
+	}
+	if s.g.opts.Version != "" {
+		header.List = append(header.List,
+			&ast.Comment{Text: "//"},
+			&ast.Comment{Text: "// Generated by Encore " + s.g.opts.Version},
+		)
+	}
+	if s.g.opts.ServiceMetadata != nil {
+		metadata := s.g.opts.ServiceMetadata(s.svc)
+		keys := maps.Keys(metadata)
+		slices.Sort(keys)
+		for i, key := range keys {
+			line := key + ": " + metadata[key]
+			if strings.ContainsAny(line, "\r\n") {
+				return fmt.Errorf("invalid metadata %q for service %s: must be a single line", key, s.svc.Name)
+			}
+			if i == 0 {
+				header.List = append(header.List, &ast.Comment{Text: "//"})
+			}
+			header.List = append(header.List, &ast.Comment{Text: "// " + line})
+		}
+	}
+	s.file.AddComment(header)
+
+	// Generate the definitions before writing the imports, as the types
+	// within them may require further imports
+	definitions, err := s.generateDefinitions()
+	if err != nil {
+		return err
+	}
 
+	s.addImports()
 	s.generateEnvironmentalDefinitions()
 
-	// Add any missing imports
-	if len(s.neededImports) > 0 {
-		// Get an ordered list of the imports
-		imports := make([]string, 0, len(s.neededImports))
-		for pkg := range s.neededImports {
-			imports = append(imports, pkg)
+	// Allow any extra keys the deployment is known to inject, while keeping
+	// #Config closed to everything else
+	for _, key := range s.g.opts.AllowExtraKeys {
+		if _, found := s.fieldLookup[key]; found {
+			continue
 		}
-		slices.Sort(imports)
 
-		// Create all the import specs
-		for _, importPath := range imports {
-			var ident *ast.Ident = nil
-			if s.neededImports[importPath] != importPath {
-				ident = ast.NewIdent(s.neededImports[importPath])
-			}
+		field := &ast.Field{
+			Label:    ast.NewString(key),
+			Optional: token.Blank.Pos(),
+			Value:    ast.NewIdent("_"),
+		}
+		s.fieldLookup[key] = field
+		s.topLevelFields = append(s.topLevelFields, field)
+	}
 
-			spec := ast.NewImport(ident, importPath)
-			s.file.Imports = append(s.file.Imports, spec)
+	// Record the version of the schema, so config data can be checked against it
+	if s.g.opts.EmitSchemaVersion {
+		version := s.g.opts.SchemaVersion
+		if version == "" {
+			version, err = s.schemaHash(definitions)
+			if err != nil {
+				return err
+			}
 		}
 
-		// Now add the import statement
-		s.file.Decls = append(s.file.Decls, &ast.ImportDecl{
-			Specs: s.file.Imports,
-		})
+		field := &ast.Field{
+			Label: ast.NewIdent("$version"),
+			Value: ast.NewString(version),
+		}
+		addCommentToField(field, "The version of the config schema")
+		s.topLevelFields = append(s.topLevelFields, field)
 	}
 
 	// Now write the top level fields required in the config
 	appConfigStruct := &ast.Field{
 		Label: ast.NewIdent("#Config"),
-		Value: ast.NewStruct(s.topLevelFields...),
+		Value: newStruct(s.topLevelFields),
 	}
 	appConfigStruct.AddComment(&ast.CommentGroup{
 		List: []*ast.Comment{
@@ -164,205 +472,1332 @@ func (s *service) generateCue() error {
 			{Text: "// as fields at the package level."},
 		},
 	})
-	s.file.Decls = append(s.file.Decls, appConfigStruct, ast.NewIdent("#Config"))
+	s.file.Decls = append(s.file.Decls, appConfigStruct)
+
+	if s.g.opts.OpenAPICompatible {
+		// The OpenAPI encoder only supports definitions, so #Config is only defined
+		if len(s.g.opts.Environments) > 0 {
+			return errors.New("the OpenAPICompatible and Environments options cannot be used together")
+		}
+	} else if len(s.g.opts.Environments) == 0 {
+		s.file.Decls = append(s.file.Decls, ast.NewIdent("#Config"))
+	} else {
+		// Rather than inlining #Config, scaffold a field for each environment
+		// which must satisfy it, for the config values of that environment
+		for i, env := range s.g.opts.Environments {
+			var label ast.Label = ast.NewString(env)
+			if ast.IsValidIdent(env) {
+				label = ast.NewIdent(env)
+			}
+			field := &ast.Field{Label: label, Value: ast.NewIdent("#Config")}
+			if i == 0 {
+				ast.SetRelPos(field, token.NewSection)
+			}
+			addCommentToField(field, fmt.Sprintf("Config for the %s environment", env))
+			s.file.Decls = append(s.file.Decls, field)
+		}
+	}
+
+	// Fields limited to some environments are guarded on the name of the environment,
+	// which Encore injects into #Meta upon deployment
+	if s.usesEnv {
+		field := &ast.Field{
+			Label: ast.NewIdent("_env"),
+			Value: ast.NewSel(ast.NewIdent("#Meta"), "Environment", "Name"),
+		}
+		addCommentToField(field, "The name of the environment, used to select the fields present within it")
+		ast.SetRelPos(field, token.NewSection)
+		s.file.Decls = append(s.file.Decls, field)
+	}
+
+	// Describe the config when given as flattened environment variables
+	if s.g.opts.FlattenedEnvKeys {
+		s.file.Decls = append(s.file.Decls, s.envKeysDefinition(definitions))
+	}
 
 	// Write any declarations we've used multiple times to the file
-	for _, named := range s.typeUsage.NamesWithCountsOver(1) {
+	s.file.Decls = append(s.file.Decls, definitions...)
+
+	return nil
+}
+
+// addImports adds an import for each package the generated declarations require
+func (s *service) addImports() {
+	if len(s.neededImports) == 0 {
+		return
+	}
+
+	// Get an ordered list of the imports
+	imports := make([]string, 0, len(s.neededImports))
+	for pkg := range s.neededImports {
+		imports = append(imports, pkg)
+	}
+	slices.Sort(imports)
+
+	// Create all the import specs
+	for _, importPath := range imports {
+		// Packages of the CUE standard library (i.e. "encoding/json") are referred to by the last element
+		// of their path, while other packages are given their name explicitly, as it may differ from their path
+		var ident *ast.Ident = nil
+		name := s.neededImports[importPath]
+		isStdlib := !strings.Contains(strings.Split(importPath, "/")[0], ".")
+		if name != importPath && !(isStdlib && name == path.Base(importPath)) {
+			ident = ast.NewIdent(name)
+		}
+
+		spec := ast.NewImport(ident, importPath)
+		s.file.Imports = append(s.file.Imports, spec)
+	}
+
+	// Now add the import statement
+	s.file.Decls = append(s.file.Decls, &ast.ImportDecl{
+		Specs: s.file.Imports,
+	})
+}
+
+// schemaHash returns a hash of the config fields and definitions generated for the service,
+// which changes whenever the generated schema does.
+func (s *service) schemaHash(definitions []ast.Decl) (string, error) {
+	nodes := []ast.Node{newStruct(s.topLevelFields)}
+	for _, decl := range definitions {
+		nodes = append(nodes, decl)
+	}
+
+	hash := sha256.New()
+	for _, node := range nodes {
+		src, err := format.Node(node)
+		if err != nil {
+			return "", err
+		}
+		hash.Write(src)
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16], nil
+}
+
+// generateDefinitions creates a definition for each named type used multiple times
+// within the service, as well as for any recursive types.
+func (s *service) generateDefinitions() ([]ast.Decl, error) {
+	// Each definition is grouped with any declarations listed alongside it
+	type definition struct {
+		name  string
+		decls []ast.Decl
+	}
+	var definitions []definition
+
+	usedOnce := 1
+	if s.g.opts.DefineNamedTypes || s.shared {
+		usedOnce = 0
+	}
+	for _, named := range s.typeUsage.NamesWithCountsOver(usedOnce) {
+		if s.isInlined(named) {
+			continue
+		}
 		namedType := &schema.Type{Typ: &schema.Type_Named{Named: named}}
 		decl := s.g.res.Meta.Decls[named.Id]
-		concrete, err := encoding.GetConcreteType(s.g.res.Meta.Decls, namedType, nil)
-		if err != nil {
-			return err
+
+		// Any uses of empty structs will have been pruned, so we don't need the definition either
+		if s.g.opts.PruneEmpty && s.isEmptyStruct(namedType, nil) {
+			continue
 		}
 
+		// Fields within a definition are relative to it, as it may be used by many fields
 		defIdent := s.typeUsage.CueIdent(named)
-		fieldType, err := s.toCueType(concrete)
+		s.fieldPath = []string{defIdent.Name}
+		fieldType, err := s.namedTypeToCue(namedType)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		s.fieldPath = nil
 
 		field := &ast.Field{
 			Label: defIdent,
 			Value: fieldType,
 		}
-		if decl.Doc != "" {
-			addCommentToField(field, decl.Doc)
+		attr, err := s.discriminatorAttribute(namedType)
+		if err != nil {
+			return nil, err
+		}
+		if attr != nil {
+			field.Attrs = append(field.Attrs, attr)
+		}
+		if doc := s.goDoc(decl.Doc); doc != "" {
+			addCommentToField(field, doc)
 		} else {
 			// If there isn't a doc, we want to force a new section
 			// above the name (empty line above).
 			// The doc block will add this for us
 			defIdent.NamePos = token.NewSection.Pos()
 		}
-		s.file.Decls = append(s.file.Decls, field)
+		decls := []ast.Decl{field}
+
+		// If requested, list all the values of an enum alongside its definition
+		if values, isEnum := s.g.res.App.Enums[named.Id]; isEnum && s.g.opts.EmitEnumValues {
+			list := make([]ast.Expr, len(values))
+			for i, value := range values {
+				list[i] = enumValueToCue(value)
+			}
+
+			decls = append(decls, &ast.Field{
+				Label: ast.NewIdent(defIdent.Name + "Values"),
+				Value: ast.NewList(list...),
+			})
+		}
+		definitions = append(definitions, definition{name: defIdent.Name, decls: decls})
 	}
 
-	return nil
+	for _, stru := range s.typeUsage.ShapesWithCountsOver(1) {
+		defIdent := s.typeUsage.ShapeCueIdent(stru)
+		s.fieldPath = []string{defIdent.Name}
+		fields, err := s.structToFields(stru)
+		if err != nil {
+			return nil, err
+		}
+		s.fieldPath = nil
+
+		defIdent.NamePos = token.NewSection.Pos()
+		field := &ast.Field{
+			Label: defIdent,
+			Value: newStruct(fields),
+		}
+		definitions = append(definitions, definition{name: defIdent.Name, decls: []ast.Decl{field}})
+	}
+
+	// Order the definitions by their names, so the output doesn't depend on the order the types were found in
+	sort.Slice(definitions, func(i, j int) bool {
+		return definitions[i].name < definitions[j].name
+	})
+
+	var decls []ast.Decl
+	for _, def := range definitions {
+		decls = append(decls, def.decls...)
+	}
+	return decls, nil
 }
 
-// structToFields converts a struct to a list of fields which can then be
-// either included in a definition, a line struct or the file level declarations
-func (s *service) structToFields(stru *schema.Struct) ([]*ast.Field, error) {
-	var fields []*ast.Field
+// structToFields converts a struct to a list of fields (and any declarations they require)
+// which can then be either included in a definition, a line struct or the file level declarations
+func (s *service) structToFields(stru *schema.Struct) ([]ast.Decl, error) {
+	// Each field is grouped with any hidden sibling fields it requires,
+	// so they stay together if the fields are reordered
+	type fieldGroup struct {
+		jsonName string
+		decls    []ast.Decl
+	}
+	var groups []fieldGroup
+	foldedLabels := make(map[string]string) // lowercased labels to the label of the first field with them
 
 	for _, f := range stru.Fields {
-		isOptional := false
+		// Stop early if generation has been canceled, as structs may be large
+		if err := s.ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// Skip fields which will never be present in the config
+		if isExcluded(f) || (s.g.opts.PruneEmpty && s.isEmptyStruct(f.Typ, nil)) {
+			continue
+		}
+
+		s.fieldPath = append(s.fieldPath, fieldLabel(f))
+
+		if s.g.opts.WarnCaseInsensitiveCollisions {
+			label := fieldLabel(f)
+			folded := strings.ToLower(label)
+			if other, found := foldedLabels[folded]; found && other != label {
+				s.warn(fmt.Sprintf("the label %q differs only by case from the label %q, so the fields cannot be told apart by case-insensitive consumers", label, other))
+			} else if !found {
+				foldedLabels[folded] = label
+			}
+		}
+
+		isOptional := isOptionalField(f) || s.isRecursivePointer(f.Typ)
+		var docNotes []string // additional lines to document the field with
 
 		// Convert the type to CUE
-		fieldType, err := s.toCueType(f.Typ)
+		fieldType, err := s.fieldTypeToCue(f)
 		if err != nil {
 			return nil, err
 		}
 		field := &ast.Field{
-			Label: ast.NewIdent(f.Name),
+			Label: ast.NewIdent(fieldLabel(f)),
 			Value: fieldType,
 		}
 
+		// Unions are annotated with the field which discriminates between their variants
+		attr, err := s.discriminatorAttribute(f.Typ)
+		if err != nil {
+			return nil, err
+		}
+		if attr != nil {
+			field.Attrs = append(field.Attrs, attr)
+		}
+		if fieldTag(f, "variant") != nil && discriminatorField(stru) == nil {
+			return nil, fmt.Errorf("field %s: the variant tag can only be used in structs with a discriminator field", f.Name)
+		}
+
+		// List the members of enums inlined into the field, as they are not named by a definition
+		if members := s.inlinedEnumMembers(f.Typ); len(members) > 0 {
+			docNotes = append(docNotes, "one of: "+strings.Join(members, ", "))
+		}
+
+		// Point readers at the definition the field references
+		if ident, ok := fieldType.(*ast.Ident); ok && s.g.opts.ReferenceComments && strings.HasPrefix(ident.Name, "#") {
+			docNotes = append(docNotes, "see "+ident.Name)
+		}
+
+		// Deprecated fields are annotated with their notice, so config still setting them can be reported
+		if notice, deprecated := deprecationNotice(f.Doc); deprecated {
+			field.Attrs = append(field.Attrs, &ast.Attribute{Text: fmt.Sprintf("@deprecated(%s)", strconv.Quote(notice))})
+		}
+
 		for _, tag := range f.Tags {
-			if tag.Key == "json" {
-				if tag.Name != "" {
-					field.Label = ast.NewIdent(tag.Name)
-				}
-				for _, option := range tag.Options {
-					if option == "omitempty" {
-						isOptional = true
-					}
+			if tag.Key == "readonly" && tag.Name != "false" {
+				// Readonly fields are set once and must not change afterwards. CUE has no
+				// way to express this, so we annotate the field for the deployment tooling
+				field.Attrs = append(field.Attrs, &ast.Attribute{Text: "@readonly()"})
+				docNotes = append(docNotes, "readonly")
+			}
+
+			if tag.Key == "example" {
+				// Example values are documented, and exposed as an attribute for tooling which reads them
+				example := tagValue(tag)
+				lit, err := s.scalarLiteral(f, tag.Key, example)
+				if err != nil {
+					return nil, err
 				}
+				field.Attrs = append(field.Attrs, &ast.Attribute{Text: fmt.Sprintf("@example(%s)", lit.Value)})
+				docNotes = append(docNotes, "example: "+example)
+			}
+
+			if tag.Key == "units" && tag.Name != "" {
+				// Units are metadata for tooling, they do not change how the value is validated
+				field.Attrs = append(field.Attrs, &ast.Attribute{Text: fmt.Sprintf("@unit(%s)", strconv.Quote(tag.Name))})
 			}
 
 			if tag.Key == "cue" {
-				if tag.Name != "" {
-					expr, err := parser.ParseExpr("encore struct", tag.Name)
+				// Multiple expressions can be given separated by semicolons (i.e. `cue:">0; <100"`),
+				// each of which is unified with the field's value
+				for _, segment := range strings.Split(tag.Name, ";") {
+					if segment = strings.TrimSpace(segment); segment == "" {
+						continue
+					}
+					expr, err := parser.ParseExpr("encore struct", segment)
 					if err != nil {
-						return nil, err
+						return nil, fmt.Errorf("field %s: invalid cue expression %q: %v", f.Name, segment, err)
 					}
 					field.Value = ast.NewBinExpr(token.AND, field.Value, expr)
-				}
-				for _, option := range tag.Options {
-					if option == "opt" {
-						isOptional = true
+
+					if s.g.opts.ConstraintAttributes {
+						if attrs := constraintAttributes(expr); attrs != nil {
+							field.Attrs = append(field.Attrs, attrs...)
+						} else {
+							s.warn(fmt.Sprintf("the cue constraint %q has no equivalent JSON Schema keyword", segment))
+						}
 					}
 				}
 			}
 		}
 
-		// Mark the field as optional if it is
-		if isOptional {
-			field.Optional = token.Blank.Pos()
+		// Mark maps as ordered so tooling preserves the order of their entries
+		if s.g.opts.OrderedMaps && s.isMapType(f.Typ) {
+			field.Attrs = append(field.Attrs, &ast.Attribute{Text: "@index()"})
 		}
 
-		// Add the documentation to the field
-		if f.Doc != "" {
-			addCommentToField(field, f.Doc)
+		// Sensitive values are injected at runtime through a CUE tag, so they are never stored in config files
+		if isSensitive(f) {
+			attrs, err := s.secretAttributes(f)
+			if err != nil {
+				return nil, err
+			}
+			field.Attrs = append(field.Attrs, attrs...)
 		}
 
-		fields = append(fields, field)
-	}
-
-	return fields, nil
-}
-
-// Convert a schema type into a cue type
-func (s *service) toCueType(unknownType *schema.Type) (ast.Expr, error) {
-	switch typ := unknownType.Typ.(type) {
-	case *schema.Type_Named:
-		usageCount := s.typeUsage.Count(typ.Named)
-		if usageCount <= 1 {
-			// inline the type if it's only used once
-			concrete, err := encoding.GetConcreteType(s.g.res.Meta.Decls, unknownType, nil)
+		// Fields read from an environment variable when the config is loaded don't need to be given,
+		// as any value given is only used if the variable isn't set
+		if tag := fieldTag(f, "envvar"); tag != nil {
+			attr, err := s.envVarAttribute(f, tag.Name)
 			if err != nil {
 				return nil, err
 			}
-			return s.toCueType(concrete)
-		} else {
-			return s.typeUsage.CueIdent(typ.Named), nil
+			field.Attrs = append(field.Attrs, attr)
+			docNotes = append(docNotes, "read from the "+tag.Name+" environment variable if it is set")
+			isOptional = true
 		}
-	case *schema.Type_Struct:
-		fields, err := s.structToFields(typ.Struct)
+
+		// Add any constraints from the validation rules
+		constraints, siblings, err := s.validateConstraints(f, field.Label)
 		if err != nil {
 			return nil, err
 		}
+		if len(constraints) > 0 {
+			field.Value = ast.NewBinExpr(token.AND, append([]ast.Expr{field.Value}, constraints...)...)
+		}
 
-		fieldsInterface := make([]interface{}, len(fields))
-		for i, field := range fields {
-			fieldsInterface[i] = field
+		// Paths are annotated so tooling knows to treat their values as paths
+		if isPathField(f) {
+			field.Attrs = append(field.Attrs, &ast.Attribute{Text: `@format("path")`})
 		}
 
-		return ast.NewStruct(fieldsInterface...), nil
-	case *schema.Type_Map:
-		keyType, err := s.toCueType(typ.Map.Key)
-		if err != nil {
-			return nil, err
+		// Values the application normalizes must be given in their normalized form
+		if tag := fieldTag(f, "normalize"); tag != nil {
+			constraint, note, err := s.normalizeConstraint(f, tag.Name)
+			if err != nil {
+				return nil, err
+			}
+			field.Value = ast.NewBinExpr(token.AND, field.Value, constraint)
+			docNotes = append(docNotes, note)
 		}
-		valueType, err := s.toCueType(typ.Map.Value)
+
+		// Add any constraints which the policies require of the field
+		policies, err := s.fieldPolicies()
 		if err != nil {
 			return nil, err
 		}
-		return ast.NewStruct(ast.NewList(keyType), valueType), nil
-	case *schema.Type_List:
-		listType, err := s.toCueType(typ.List.Elem)
-		if err != nil {
-			return nil, err
+		if len(policies) > 0 {
+			field.Value = ast.NewBinExpr(token.AND, append([]ast.Expr{field.Value}, policies...)...)
 		}
-		return ast.NewList(&ast.Ellipsis{Type: listType}), nil
-	case *schema.Type_Builtin:
-		return s.builtinToCue(typ.Builtin), nil
-	case *schema.Type_Pointer:
-		// Pointers are not supported in CUE, so we just convert the
-		// underlying type
-		return s.toCueType(typ.Pointer.Base)
-	case *schema.Type_Config:
-		// The config.Value type is a simple wrapper another type
-		// and from the point of the CUE files, the wrapper is invisible
-		return s.toCueType(typ.Config.Elem)
-	default:
-		panic(fmt.Sprintf("unexpected type: %T", typ))
-	}
-}
+		if s.g.opts.LengthAttributes {
+			attrs, err := s.lengthAttributes(f)
+			if err != nil {
+				return nil, err
+			}
+			field.Attrs = append(field.Attrs, attrs...)
+		}
+		if s.g.opts.BoundAttributes {
+			attrs, err := s.boundAttributes(f)
+			if err != nil {
+				return nil, err
+			}
+			field.Attrs = append(field.Attrs, attrs...)
+		}
+
+		// Pointers may be null, which isn't subject to the constraints on the value they point to.
+		// A default value of the field takes precedence over null, and a const value excludes it
+		if f.Typ.GetPointer() != nil && fieldTag(f, "const") == nil {
+			nullability := s.g.opts.NullablePointers
+			curef := fieldTag(f, "curef")
+			hasDefault := fieldTag(f, "default") != nil || (curef != nil && slices.Contains(curef.Options, "default"))
+			if hasDefault && nullability == NullDefault {
+				nullability = NullPermitted
+			}
+			field.Value = nullable(field.Value, nullability)
+		}
+
+		// Pin the field to a constant value, or give it a default which can be overridden
+		if constTag, defaultTag := fieldTag(f, "const"), fieldTag(f, "default"); constTag != nil && defaultTag != nil {
+			return nil, fmt.Errorf("field %s: cannot have both a const and a default value", f.Name)
+		} else if constTag != nil {
+			lit, err := s.scalarLiteral(f, constTag.Key, tagValue(constTag))
+			if err != nil {
+				return nil, err
+			}
+			field.Value = ast.NewBinExpr(token.AND, field.Value, lit)
+		} else if defaultTag != nil {
+			lit, err := s.scalarLiteral(f, defaultTag.Key, tagValue(defaultTag))
+			if err != nil {
+				return nil, err
+			}
+			field.Value = ast.NewBinExpr(token.OR, field.Value, &ast.UnaryExpr{Op: token.MUL, X: lit})
+		}
+
+		// Reference a value from another CUE package, which the field either defaults to or must satisfy
+		if tag := fieldTag(f, "curef"); tag != nil {
+			ref, err := s.cueReference(tag.Name)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: curef %w", f.Name, err)
+			}
+			if slices.Contains(tag.Options, "default") {
+				if fieldTag(f, "const") != nil || fieldTag(f, "default") != nil {
+					return nil, fmt.Errorf("field %s: cannot default to a curef reference as well as a const or default value", f.Name)
+				}
+				field.Value = ast.NewBinExpr(token.OR, field.Value, &ast.UnaryExpr{Op: token.MUL, X: ref})
+			} else {
+				field.Value = ast.NewBinExpr(token.AND, field.Value, ref)
+			}
+		}
+
+		// A field which is only conditionally required is optional, and required by the conditions instead
+		conditions, note, err := s.requiredUnless(f, stru, field.Label)
+		if err != nil {
+			return nil, err
+		}
+		if len(conditions) > 0 {
+			isOptional = true
+			docNotes = append(docNotes, note)
+		}
+
+		// An alias allows the field to be given under another name, which is unified with the field
+		var alias *ast.Field
+		var aliasGuard ast.Decl
+		if tag := fieldTag(f, "alias"); tag != nil && tag.Name != "" {
+			alias, aliasGuard, err = s.aliasField(f, field.Label, tag.Name)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// A field can be limited to only be present in some environments
+		envs, err := fieldEnvironments(f)
+		if err != nil {
+			return nil, err
+		}
+		if len(s.g.opts.Environments) > 0 {
+			for _, env := range envs {
+				if !slices.Contains(s.g.opts.Environments, env) {
+					s.warn(fmt.Sprintf("the env tag names the environment %q, which is not one of the environments being scaffolded", env))
+				}
+			}
+		}
+		if len(envs) == 1 {
+			docNotes = append(docNotes, "only present in the "+envs[0]+" environment")
+		} else if len(envs) > 1 {
+			docNotes = append(docNotes, "only present in the "+strings.Join(envs[:len(envs)-1], ", ")+" and "+envs[len(envs)-1]+" environments")
+		}
+
+		// Mark the field as optional if it is
+		if isOptional {
+			field.Optional = token.Blank.Pos()
+		} else {
+			s.addRequiredAttribute(field)
+		}
+
+		// Add the documentation to the field
+		doc := strings.Join(append([]string{s.goDoc(f.Doc)}, docNotes...), "\n")
+		if doc = strings.TrimSpace(doc); doc != "" {
+			if s.g.opts.OpenAPICompatible {
+				// The OpenAPI encoder only describes fields using the comments above them
+				addLeadingCommentToField(field, doc)
+			} else {
+				addCommentToField(field, doc)
+			}
+		}
+
+		group := fieldGroup{decls: []ast.Decl{field}}
+		if alias != nil {
+			// The alias replaces the field, so any deprecation of the field doesn't apply to it
+			if doc := s.goDoc(withoutDeprecation(f.Doc)); doc != "" {
+				addCommentToField(alias, doc)
+			}
+			group.decls = append(group.decls, alias, aliasGuard)
+		}
+		for _, sibling := range siblings {
+			group.decls = append(group.decls, sibling)
+		}
+		group.decls = append(group.decls, conditions...)
+		if len(envs) > 0 {
+			group.decls = []ast.Decl{s.environmentGuard(envs, group.decls)}
+		}
+		if tag := fieldTag(f, "json"); tag != nil {
+			group.jsonName = tag.Name
+		}
+		groups = append(groups, group)
+
+		s.fieldPath = s.fieldPath[:len(s.fieldPath)-1]
+	}
+
+	// If requested, order fields with json names by those names, followed by all other fields in source order
+	if s.g.opts.SortByJSONName {
+		sort.SliceStable(groups, func(i, j int) bool {
+			a, b := groups[i].jsonName, groups[j].jsonName
+			if a == "" || b == "" {
+				return a != "" && b == ""
+			}
+			return a < b
+		})
+	}
+
+	var decls []ast.Decl
+	for _, group := range groups {
+		decls = append(decls, group.decls...)
+	}
+	return decls, nil
+}
+
+// fieldTypeToCue converts the type of a struct field into a CUE type, taking into
+// account any struct tags which change the representation of the type.
+func (s *service) fieldTypeToCue(f *schema.Field) (ast.Expr, error) {
+	if tag := fieldTag(f, "timeformat"); tag != nil {
+		if !s.isTimeType(f.Typ) {
+			return nil, fmt.Errorf("field %s: the timeformat tag can only be used on time.Time fields", f.Name)
+		}
+		if tag.Name == "" {
+			return nil, fmt.Errorf("field %s: the timeformat tag requires a layout (i.e. `timeformat:\"2006-01-02\"`)", f.Name)
+		}
+
+		// Times with a specific layout are represented as strings
+		// matching that layout, rather than RFC3339 times
+		return ast.NewBinExpr(
+			token.AND,
+			ast.NewIdent("string"),
+			&ast.UnaryExpr{Op: token.MAT, X: ast.NewString(timeLayoutToRegex(tag.Name))},
+		), nil
+	}
+
+	if tag := fieldTag(f, "cue"); tag != nil {
+		for _, option := range tag.Options {
+			if name, param, _ := strings.Cut(option, "="); name == "tuple" {
+				return s.tupleToCue(f, param)
+			}
+		}
+	}
+
+	// A pointer field is made nullable once its constraints have been added, so only the
+	// type it points to is converted here
+	typ := f.Typ
+	if ptr := typ.GetPointer(); ptr != nil {
+		typ = ptr.Base
+	}
+	expr, err := s.toCueType(typ)
+	if err != nil {
+		return nil, fmt.Errorf("field %s: %w", f.Name, err)
+	}
+	return expr, nil
+}
+
+// tupleToCue converts a list field tagged with `cue:",tuple=N"` into a closed list
+// of exactly N elements, rather than an open list of any length.
+func (s *service) tupleToCue(f *schema.Field, length string) (ast.Expr, error) {
+	typ, err := s.concreteType(f.Typ)
+	if err != nil {
+		return nil, err
+	}
+	list := typ.GetList()
+	if list == nil {
+		return nil, fmt.Errorf("field %s: the tuple option can only be used on slice fields", f.Name)
+	}
+	n, err := strconv.Atoi(length)
+	if err != nil || n <= 0 {
+		return nil, fmt.Errorf("field %s: the tuple option requires a positive length (i.e. `cue:\",tuple=3\"`)", f.Name)
+	}
+
+	elems := make([]ast.Expr, n)
+	for i := range elems {
+		if elems[i], err = s.toCueType(list.Elem); err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.Name, err)
+		}
+	}
+	return ast.NewList(elems...), nil
+}
+
+// secretAttributes returns the attributes for a sensitive field, which
+// allows the value to be injected as the CUE tag `SECRET_<FIELD_NAME>`.
+//
+// Tags can only hold scalar values, so sensitive structs, lists and maps are
+// only marked as secret, and must be given in the config as before.
+func (s *service) secretAttributes(f *schema.Field) ([]*ast.Attribute, error) {
+	typ, err := s.concreteType(f.Typ)
+	if err != nil {
+		return nil, err
+	}
+
+	var tagType string
+	switch typ.GetBuiltin() {
+	case schema.Builtin_STRING, schema.Builtin_UUID, schema.Builtin_USER_ID, schema.Builtin_DURATION,
+		schema.Builtin_DECIMAL, schema.Builtin_RAT:
+		tagType = "string"
+	case schema.Builtin_BOOL:
+		tagType = "bool"
+	case schema.Builtin_INT, schema.Builtin_INT8, schema.Builtin_INT16, schema.Builtin_INT32, schema.Builtin_INT64,
+		schema.Builtin_UINT, schema.Builtin_UINT8, schema.Builtin_UINT16, schema.Builtin_UINT32, schema.Builtin_UINT64:
+		tagType = "int"
+	case schema.Builtin_FLOAT32, schema.Builtin_FLOAT64, schema.Builtin_NUMBER:
+		tagType = "number"
+	}
+	if _, isBuiltin := typ.Typ.(*schema.Type_Builtin); !isBuiltin || tagType == "" {
+		return []*ast.Attribute{{Text: "@secret()"}}, nil
+	}
+
+	// The tag is named after the path to the field, so fields of the same name in different structs
+	// are given different secrets. Fields within a definition are named after the definition.
+	name := secretTagName(s.fieldPath)
+	path := strings.Join(s.fieldPath, ".")
+	if other, found := s.secretTags[name]; found && other != path {
+		return nil, fmt.Errorf("field %s: the secret %s is already injected into %s", f.Name, name, other)
+	}
+	if s.secretTags == nil {
+		s.secretTags = make(map[string]string)
+	}
+	s.secretTags[name] = path
+
+	return []*ast.Attribute{
+		{Text: fmt.Sprintf("@tag(%s,type=%s)", name, tagType)},
+		{Text: "@secret()"},
+	}, nil
+}
+
+// secretTagName returns the name of the tag through which the secret held by the field at the
+// given path is injected (i.e. `SECRET_DATABASE_PASSWORD` for `Database.Password`)
+func secretTagName(fieldPath []string) string {
+	parts := make([]string, len(fieldPath))
+	for i, label := range fieldPath {
+		part := idents.Convert(strings.TrimPrefix(label, "#"), idents.ScreamingSnakeCase)
+		parts[i] = strings.Map(func(r rune) rune {
+			if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+				return r
+			}
+			return '_'
+		}, part)
+	}
+	return cueutil.SecretTagPrefix + strings.Join(parts, "_")
+}
+
+// envVarName is the pattern environment variable names given by the envvar tag must match
+var envVarName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// envVarAttribute returns the attribute for a field tagged with the environment variable it is read
+// from (i.e. `envvar:"DATABASE_URL"`). The variable is read by the config unmarshalers when the config
+// is loaded, so it can only be given for fields of types which can be parsed from a single value.
+func (s *service) envVarAttribute(f *schema.Field, name string) (*ast.Attribute, error) {
+	if !envVarName.MatchString(name) {
+		return nil, fmt.Errorf("field %s: invalid environment variable name %q", f.Name, name)
+	}
+	switch f.Typ.Typ.(type) {
+	case *schema.Type_Pointer, *schema.Type_Config:
+		return nil, fmt.Errorf("field %s: pointers and config wrappers cannot be read from an environment variable", f.Name)
+	}
+
+	typ, err := s.concreteType(f.Typ)
+	if err != nil {
+		return nil, err
+	}
+	switch typ.GetBuiltin() {
+	case schema.Builtin_STRING, schema.Builtin_BOOL, schema.Builtin_DURATION,
+		schema.Builtin_INT, schema.Builtin_INT8, schema.Builtin_INT16, schema.Builtin_INT32, schema.Builtin_INT64,
+		schema.Builtin_UINT, schema.Builtin_UINT8, schema.Builtin_UINT16, schema.Builtin_UINT32, schema.Builtin_UINT64,
+		schema.Builtin_FLOAT32, schema.Builtin_FLOAT64:
+		if _, isBuiltin := typ.Typ.(*schema.Type_Builtin); isBuiltin {
+			return &ast.Attribute{Text: fmt.Sprintf("@env(%s)", name)}, nil
+		}
+	}
+	return nil, fmt.Errorf("field %s: only string, bool, numeric and duration fields can be read from an environment variable", f.Name)
+}
+
+// normalizeConstraint returns the constraint for a string field tagged with the normalization the
+// application applies to it (i.e. `normalize:"lower"`), which rejects values not already in that form,
+// along with a note documenting the normalization.
+func (s *service) normalizeConstraint(f *schema.Field, normalization string) (ast.Expr, string, error) {
+	typ, err := s.concreteType(f.Typ)
+	if err != nil {
+		return nil, "", err
+	}
+	if typ.GetBuiltin() != schema.Builtin_STRING {
+		return nil, "", fmt.Errorf("field %s: the normalize tag can only be used on string fields", f.Name)
+	}
+
+	switch normalization {
+	case "lower":
+		return &ast.UnaryExpr{Op: token.NMAT, X: ast.NewString(uppercaseLetters)}, "must be given in lowercase", nil
+	case "upper":
+		return &ast.UnaryExpr{Op: token.NMAT, X: ast.NewString(lowercaseLetters)}, "must be given in uppercase", nil
+	default:
+		return nil, "", fmt.Errorf("field %s: unknown normalization %q, expected lower or upper", f.Name, normalization)
+	}
+}
+
+// goDoc returns the doc comment of a Go type or field as it should be given in the generated
+// file, applying the DocTranslate option if set
+func (s *service) goDoc(doc string) string {
+	doc = strings.TrimSpace(doc)
+	if doc == "" || s.g.opts.DocTranslate == nil {
+		return doc
+	}
+	return strings.TrimSpace(s.g.opts.DocTranslate(doc))
+}
+
+// addRequiredAttribute annotates a required field with `@required()` if the EmitRequiredAttr
+// option is set, unless the field is already annotated.
+func (s *service) addRequiredAttribute(field *ast.Field) {
+	if !s.g.opts.EmitRequiredAttr {
+		return
+	}
+	for _, attr := range field.Attrs {
+		if attr.Text == "@required()" {
+			return
+		}
+	}
+	field.Attrs = append(field.Attrs, &ast.Attribute{Text: "@required()"})
+}
+
+// scalarLiteral parses a value given within a struct tag into a CUE literal of the
+// field's type. The tag name is used to describe the value within any errors.
+func (s *service) scalarLiteral(f *schema.Field, tagName string, value string) (*ast.BasicLit, error) {
+	typ, err := s.concreteType(f.Typ)
+	if err != nil {
+		return nil, err
+	}
+
+	switch typ.GetBuiltin() {
+	case schema.Builtin_STRING, schema.Builtin_BYTES, schema.Builtin_TIME, schema.Builtin_USER_ID:
+		return ast.NewString(value), nil
+	case schema.Builtin_UUID:
+		if !regexp.MustCompile(uuidPattern).MatchString(value) {
+			return nil, fmt.Errorf("field %s: %s value %q is not a valid UUID", f.Name, tagName, value)
+		}
+		return ast.NewString(value), nil
+	case schema.Builtin_JSON:
+		if !json.Valid([]byte(value)) {
+			return nil, fmt.Errorf("field %s: %s value %q is not valid JSON", f.Name, tagName, value)
+		}
+		return ast.NewString(value), nil
+	case schema.Builtin_DURATION:
+		if _, err := time.ParseDuration(value); err != nil {
+			return nil, fmt.Errorf("field %s: %s value %q is not a valid duration", f.Name, tagName, value)
+		}
+		return ast.NewString(value), nil
+	case schema.Builtin_DECIMAL, schema.Builtin_RAT:
+		if !regexp.MustCompile(decimalPattern).MatchString(value) {
+			return nil, fmt.Errorf("field %s: %s value %q is not a valid decimal", f.Name, tagName, value)
+		}
+		return ast.NewString(value), nil
+	case schema.Builtin_BOOL:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %s value %q is not a valid bool", f.Name, tagName, value)
+		}
+		return ast.NewBool(b), nil
+	case schema.Builtin_INT, schema.Builtin_INT8, schema.Builtin_INT16, schema.Builtin_INT32, schema.Builtin_INT64,
+		schema.Builtin_UINT, schema.Builtin_UINT8, schema.Builtin_UINT16, schema.Builtin_UINT32, schema.Builtin_UINT64,
+		schema.Builtin_FLOAT32, schema.Builtin_FLOAT64, schema.Builtin_NUMBER:
+		lit, err := numberLit(value)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %s value %q is not a valid number", f.Name, tagName, value)
+		}
+		return lit, nil
+	default:
+		return nil, fmt.Errorf("field %s: %s values can only be given for string, bool and numeric fields", f.Name, tagName)
+	}
+}
+
+// isEmptyStruct reports whether the given type is a struct which has no fields
+// once excluded fields, and fields which are themselves empty structs, are removed.
+//
+// seen tracks the named types already being checked, such that recursive types
+// are treated as not being empty.
+func (s *service) isEmptyStruct(typ *schema.Type, seen map[uint32]bool) bool {
+	switch t := typ.Typ.(type) {
+	case *schema.Type_Named:
+		if _, isCustom := s.customType(t.Named); isCustom || seen[t.Named.Id] {
+			return false
+		}
+		if seen == nil {
+			seen = make(map[uint32]bool)
+		}
+		seen[t.Named.Id] = true
+		defer delete(seen, t.Named.Id)
+
+		concrete, err := encoding.GetConcreteType(s.g.res.Meta.Decls, typ, nil)
+		return err == nil && s.isEmptyStruct(concrete, seen)
+	case *schema.Type_Pointer:
+		return s.isEmptyStruct(t.Pointer.Base, seen)
+	case *schema.Type_Config:
+		return s.isEmptyStruct(t.Config.Elem, seen)
+	case *schema.Type_Struct:
+		for _, f := range t.Struct.Fields {
+			if !isExcluded(f) && !s.isEmptyStruct(f.Typ, seen) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// isMapType reports whether the given type is a map, after
+// resolving any named types, pointers or config value wrappers.
+func (s *service) isMapType(typ *schema.Type) bool {
+	concrete, err := s.concreteType(typ)
+	return err == nil && concrete.GetMap() != nil
+}
+
+// isTimeType reports whether the given type is a time.Time, after
+// resolving any named types, pointers or config value wrappers.
+func (s *service) isTimeType(typ *schema.Type) bool {
+	concrete, err := s.concreteType(typ)
+	return err == nil && concrete.GetBuiltin() == schema.Builtin_TIME
+}
+
+// concreteType resolves the given type into the concrete type a value will
+// take in config, by resolving named types, pointers and config value wrappers.
+func (s *service) concreteType(typ *schema.Type) (*schema.Type, error) {
+	switch t := typ.Typ.(type) {
+	case *schema.Type_Named:
+		concrete, err := encoding.GetConcreteType(s.g.res.Meta.Decls, typ, nil)
+		if err != nil {
+			return nil, err
+		}
+		return s.concreteType(concrete)
+	case *schema.Type_Pointer:
+		return s.concreteType(t.Pointer.Base)
+	case *schema.Type_Config:
+		return s.concreteType(t.Config.Elem)
+	default:
+		return typ, nil
+	}
+}
+
+// Convert a schema type into a cue type
+func (s *service) toCueType(unknownType *schema.Type) (ast.Expr, error) {
+	switch typ := unknownType.GetTyp().(type) {
+	case nil:
+		return nil, errUnrepresentableType
+	case *schema.Type_Named:
+		if ref, isCustom := s.customType(typ.Named); isCustom {
+			// Custom types are represented by a reference to their hand written CUE
+			expr, err := s.cueReference(ref)
+			if err != nil {
+				return nil, fmt.Errorf("custom type %s: reference %w", s.typeName(unknownType), err)
+			}
+			return expr, nil
+		}
+		if ref, isShared := s.sharedType(typ.Named); isShared {
+			// Shared types are represented by a reference to their definition in the shared package
+			return s.cueReference(ref)
+		}
+		if s.isInlined(typ.Named) {
+			// inline the type if it's only used once
+			return s.namedTypeToCue(unknownType)
+		} else {
+			return s.typeUsage.CueIdent(typ.Named), nil
+		}
+	case *schema.Type_Struct:
+		if disc := discriminatorField(typ.Struct); disc != nil {
+			return s.unionToCue(typ.Struct, disc)
+		}
+
+		decls, err := s.structToFields(typ.Struct)
+		if err != nil {
+			return nil, err
+		}
+
+		// If requested, a struct with a single field is represented by that field's value
+		if s.g.opts.CollapseSingleFieldStructs && len(decls) == 1 {
+			if field, ok := decls[0].(*ast.Field); ok && field.Optional == token.NoPos && len(field.Attrs) == 0 {
+				return field.Value, nil
+			}
+		}
+
+		return newStruct(decls), nil
+	case *schema.Type_Map:
+		if err := s.checkMapKey(typ.Map.Key); err != nil {
+			return nil, err
+		}
+		keyType, err := s.mapKeyToCue(typ.Map.Key)
+		if err != nil {
+			return nil, err
+		}
+		if stru := typ.Map.Value.GetStruct(); stru != nil && s.typeUsage.ShapeCount(stru) > 1 {
+			// The same shape of struct is used by other maps, so they share a definition
+			return ast.NewStruct(ast.NewList(keyType), s.typeUsage.ShapeCueIdent(stru)), nil
+		}
+		valueType, err := s.toCueType(typ.Map.Value)
+		if err != nil {
+			return nil, err
+		}
+		return ast.NewStruct(ast.NewList(keyType), valueType), nil
+	case *schema.Type_List:
+		listType, err := s.toCueType(typ.List.Elem)
+		if err != nil {
+			return nil, err
+		}
+		return ast.NewList(&ast.Ellipsis{Type: listType}), nil
+	case *schema.Type_Builtin:
+		return s.builtinToCue(typ.Builtin)
+	case *schema.Type_Pointer:
+		// Pointers are not supported in CUE, so we convert the underlying
+		// type, which may be null if requested
+		base, err := s.toCueType(typ.Pointer.Base)
+		if err != nil {
+			return nil, err
+		}
+		return nullable(base, s.g.opts.NullablePointers), nil
+	case *schema.Type_Config:
+		// The config.Value type is a simple wrapper another type
+		// and from the point of the CUE files, the wrapper is invisible
+		return s.toCueType(typ.Config.Elem)
+	default:
+		panic(fmt.Sprintf("unexpected type: %T", typ))
+	}
+}
+
+// aliasField creates an optional field for the alias of the field with the given label,
+// along with a guard which gives the field the alias's value when the alias is set.
+//
+// The guard is needed as CUE can't reference optional fields, so the two fields can't
+// simply reference each other. Giving different values for both names is still an error,
+// as the field's own value then conflicts with the alias's.
+func (s *service) aliasField(f *schema.Field, label ast.Label, alias string) (*ast.Field, ast.Decl, error) {
+	name, isIdent, err := ast.LabelName(label)
+	if err != nil || !isIdent || !ast.IsValidIdent(alias) {
+		return nil, nil, fmt.Errorf("field %s: aliases require both the field name and alias to be valid CUE identifiers", f.Name)
+	}
+
+	aliasType, err := s.fieldTypeToCue(f)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	guard := &ast.Comprehension{
+		Clauses: []ast.Clause{&ast.IfClause{
+			Condition: ast.NewBinExpr(token.NEQ, ast.NewIdent(alias), &ast.BottomLit{}),
+		}},
+		Value: ast.NewStruct(ast.NewIdent(name), ast.NewIdent(alias)),
+	}
+	return &ast.Field{
+		Label:    ast.NewIdent(alias),
+		Value:    aliasType,
+		Optional: token.Blank.Pos(),
+	}, guard, nil
+}
+
+// cueReference returns a reference to a value within another CUE package, given as the
+// import path of the package followed by the path to the value (i.e. `acme.com/consts.#DefaultTimeout`),
+// and adds the import of the package. The package is named after the last element of its import path.
+//
+// Errors describe the reference (i.e. `"consts" must be ...`), so callers can say what gave it.
+func (s *service) cueReference(ref string) (ast.Expr, error) {
+	pkgStart := strings.LastIndex(ref, "/") + 1
+	importPath, valuePath, found := strings.Cut(ref[pkgStart:], ".")
+	importPath = ref[:pkgStart] + importPath
+	pkgName := importPath[pkgStart:]
+	if !found || !ast.IsValidIdent(pkgName) {
+		return nil, fmt.Errorf("%q must be an import path followed by the path to a value (i.e. `consts.#DefaultTimeout`)", ref)
+	}
+
+	selectors := strings.Split(valuePath, ".")
+	for _, sel := range selectors {
+		if !ast.IsValidIdent(sel) {
+			return nil, fmt.Errorf("%q must reference a value by identifiers", ref)
+		}
+	}
+
+	// Imports are referred to by their names, so they must be unique
+	for otherPath, otherName := range s.neededImports {
+		if otherName == pkgName && otherPath != importPath {
+			return nil, fmt.Errorf("%q imports a package named %s, which is already imported from %s", ref, pkgName, otherPath)
+		}
+	}
+	s.neededImports[importPath] = pkgName
+
+	return ast.NewSel(ast.NewIdent(pkgName), selectors...), nil
+}
+
+// customType returns the reference to the CUE representing the named type, if it is one of
+// the custom types given by Options.CustomTypes
+func (s *service) customType(named *schema.Named) (ref string, found bool) {
+	if len(s.g.opts.CustomTypes) == 0 {
+		return "", false
+	}
+	decl := s.g.res.Meta.Decls[named.Id]
+	ref, found = s.g.opts.CustomTypes[decl.Loc.PkgPath+"."+decl.Name]
+	return ref, found
+}
+
+// isInlined reports whether the named type is inlined at each of its uses, rather than
+// generated as a definition. Types used once are inlined unless they are recursive,
+// instantiate a generic type used elsewhere or DefineNamedTypes is set, as are enums
+// used up to InlineEnums times.
+func (s *service) isInlined(named *schema.Named) bool {
+	// Shared types are given a definition within the shared package
+	if _, isShared := s.sharedType(named); isShared || s.shared {
+		return false
+	}
+	usageCount := s.typeUsage.Count(named)
+	sharedGeneric := len(named.TypeArguments) > 0 && s.typeUsage.DeclCount(named) > 1
+	if usageCount <= 1 && !s.typeUsage.IsRecursive(named) && !sharedGeneric {
+		// The types passed to config.Load are given by #Config, so never need a definition
+		if !s.g.opts.DefineNamedTypes || s.isConfigStruct(named) {
+			return true
+		}
+	}
+	_, isEnum := s.g.res.App.Enums[named.Id]
+	return isEnum && usageCount <= s.g.opts.InlineEnums
+}
+
+// isConfigStruct reports whether the named type is passed to config.Load within the service
+func (s *service) isConfigStruct(named *schema.Named) bool {
+	for _, load := range s.svc.ConfigLoads {
+		if reflect.DeepEqual(load.ConfigStruct.Type.GetNamed(), named) {
+			return true
+		}
+	}
+	return false
+}
+
+// inlinedEnumMembers returns the members of the enum held by a field, if the InlineEnums
+// option is set and the enum is inlined into the field
+func (s *service) inlinedEnumMembers(typ *schema.Type) []string {
+	if s.g.opts.InlineEnums == 0 {
+		return nil
+	}
+
+	switch t := typ.Typ.(type) {
+	case *schema.Type_Pointer:
+		return s.inlinedEnumMembers(t.Pointer.Base)
+	case *schema.Type_Config:
+		return s.inlinedEnumMembers(t.Config.Elem)
+	case *schema.Type_Named:
+		values, isEnum := s.g.res.App.Enums[t.Named.Id]
+		if !isEnum || !s.isInlined(t.Named) {
+			return nil
+		}
+
+		members := make([]string, len(values))
+		for i, value := range values {
+			if value.Value.Kind() == constant.String {
+				members[i] = constant.StringVal(value.Value)
+			} else {
+				members[i] = value.Value.ExactString()
+			}
+		}
+		return members
+	default:
+		return nil
+	}
+}
+
+// fieldPolicies returns the constraints of the field policies matching the
+// path of the field currently being generated, ordered by their patterns.
+func (s *service) fieldPolicies() ([]ast.Expr, error) {
+	if len(s.g.opts.FieldPolicies) == 0 {
+		return nil, nil
+	}
+
+	patterns := make([]string, 0, len(s.g.opts.FieldPolicies))
+	for pattern := range s.g.opts.FieldPolicies {
+		patterns = append(patterns, pattern)
+	}
+	slices.Sort(patterns)
+
+	// Match the paths with / separators, so a * only matches a single label
+	fieldPath := strings.Join(s.fieldPath, "/")
+	var exprs []ast.Expr
+	for _, pattern := range patterns {
+		matched, err := path.Match(strings.ReplaceAll(pattern, ".", "/"), fieldPath)
+		if err != nil {
+			return nil, fmt.Errorf("invalid field policy pattern %q: %v", pattern, err)
+		}
+		if matched {
+			exprs = append(exprs, s.g.opts.FieldPolicies[pattern])
+		}
+	}
+	return exprs, nil
+}
+
+// environmentGuard wraps the declarations of a field in a comprehension, such that
+// they are only present when the application is running in one of the given environments.
+func (s *service) environmentGuard(envs []string, decls []ast.Decl) ast.Decl {
+	s.usesEnv = true
+
+	var condition ast.Expr
+	for _, env := range envs {
+		match := ast.NewBinExpr(token.EQL, ast.NewIdent("_env"), ast.NewString(env))
+		if condition == nil {
+			condition = match
+		} else {
+			condition = ast.NewBinExpr(token.LOR, condition, match)
+		}
+	}
+
+	return &ast.Comprehension{
+		Clauses: []ast.Clause{&ast.IfClause{Condition: condition}},
+		Value:   newStruct(decls),
+	}
+}
+
+// checkMapKey returns an error if the given map key type can't be represented in config.
+//
+// Config is decoded from JSON, in which object keys are always strings, so only maps keyed
+// by strings, integers, or types which are encoded as strings can be represented.
+func (s *service) checkMapKey(key *schema.Type) error {
+	concrete, err := s.concreteType(key)
+	if err != nil {
+		return err
+	}
+
+	switch concrete.GetBuiltin() {
+	case schema.Builtin_STRING, schema.Builtin_UUID, schema.Builtin_USER_ID, schema.Builtin_TIME,
+		schema.Builtin_INT, schema.Builtin_INT8, schema.Builtin_INT16, schema.Builtin_INT32, schema.Builtin_INT64,
+		schema.Builtin_UINT, schema.Builtin_UINT8, schema.Builtin_UINT16, schema.Builtin_UINT32, schema.Builtin_UINT64:
+		return nil
+	}
+
+	name := s.typeUsage.typeToDefinitionName(key)
+	if name == "" {
+		name = "struct"
+	}
+	return fmt.Errorf("maps with %s keys cannot be represented in config, only string and integer keys are supported", name)
+}
+
+// mapKeyToCue converts the key type of a map into the pattern constraint on its labels.
+//
+// Labels in CUE are always strings, so integer keys are matched by their decimal form and
+// integer enums by their values as strings, which the config unmarshalers convert back to
+// the key type when the config is loaded.
+func (s *service) mapKeyToCue(key *schema.Type) (ast.Expr, error) {
+	if named := key.GetNamed(); named != nil {
+		if values, isEnum := s.g.res.App.Enums[named.Id]; isEnum && values[0].Value.Kind() != constant.String {
+			options := make([]ast.Expr, len(values))
+			for i, value := range values {
+				options[i] = ast.NewString(value.Value.ExactString())
+			}
+			return ast.NewBinExpr(token.OR, options...), nil
+		}
+	}
+
+	concrete, err := s.concreteType(key)
+	if err != nil {
+		return nil, err
+	}
+	var pattern string
+	switch concrete.GetBuiltin() {
+	case schema.Builtin_INT, schema.Builtin_INT8, schema.Builtin_INT16, schema.Builtin_INT32, schema.Builtin_INT64:
+		pattern = signedIntKeyPattern
+	case schema.Builtin_UINT, schema.Builtin_UINT8, schema.Builtin_UINT16, schema.Builtin_UINT32, schema.Builtin_UINT64:
+		pattern = unsignedIntKeyPattern
+	case schema.Builtin_UUID:
+		pattern = uuidPattern
+	default:
+		return s.toCueType(key)
+	}
+	return &ast.UnaryExpr{Op: token.MAT, X: ast.NewString(pattern)}, nil
+}
+
+// namedTypeToCue converts the declaration a named type refers to into a CUE type.
+//
+// Enums are converted into a disjunction of their values, all other types
+// are converted based on their concrete type.
+func (s *service) namedTypeToCue(namedType *schema.Type) (ast.Expr, error) {
+	if values, isEnum := s.g.res.App.Enums[namedType.GetNamed().Id]; isEnum {
+		// If requested, string enums accept their values in any casing
+		if s.g.opts.CaseInsensitiveEnums && values[0].Value.Kind() == constant.String {
+			alternatives := make([]string, len(values))
+			for i, value := range values {
+				alternatives[i] = regexp.QuoteMeta(constant.StringVal(value.Value))
+			}
+			return ast.NewBinExpr(
+				token.AND,
+				ast.NewIdent("string"),
+				&ast.UnaryExpr{Op: token.MAT, X: ast.NewString("(?i)^(" + strings.Join(alternatives, "|") + ")$")},
+			), nil
+		}
+
+		options := make([]ast.Expr, len(values))
+		for i, value := range values {
+			options[i] = enumValueToCue(value)
+		}
+		return ast.NewBinExpr(token.OR, options...), nil
+	}
+
+	concrete, err := encoding.GetConcreteType(s.g.res.Meta.Decls, namedType, nil)
+	if err != nil {
+		return nil, err
+	}
+	return s.toCueType(concrete)
+}
+
+// nullable allows the given type to be null, according to the nullability
+func nullable(expr ast.Expr, nullability Nullability) ast.Expr {
+	switch nullability {
+	case NullPermitted:
+		return ast.NewBinExpr(token.OR, expr, ast.NewNull())
+	case NullDefault:
+		return ast.NewBinExpr(token.OR, &ast.UnaryExpr{Op: token.MUL, X: ast.NewNull()}, expr)
+	default:
+		return expr
+	}
+}
+
+// enumValueToCue converts the value of an enum constant into a CUE literal
+func enumValueToCue(value *est.EnumValue) ast.Expr {
+	if value.Value.Kind() == constant.String {
+		return ast.NewString(constant.StringVal(value.Value))
+	}
+	return ast.NewLit(token.INT, value.Value.ExactString())
+}
+
+// unsupportedBuiltin is used by the parser for builtin Go types which have no schema
+// representation, such as uintptr, complex64 and complex128.
+//
+// These are reported as errors rather than given a structured form, as the
+// runtime decodes config using encoding/json which can't decode them either.
+const unsupportedBuiltin schema.Builtin = -1
+
+// decimalPattern matches the decimal values which can be given in config for decimal types.
+//
+// big.Rat can also decode fractions (i.e. "3/2"), but config is kept to decimals so it reads the same for all decimal types.
+const decimalPattern = `^-?[0-9]+(\.[0-9]+)?$`
+
+// signedIntKeyPattern and unsignedIntKeyPattern match the labels of maps with integer keys
+const (
+	signedIntKeyPattern   = `^-?[0-9]+$`
+	unsignedIntKeyPattern = `^[0-9]+$`
+)
+
+// uuidPattern matches UUIDs in their canonical form (i.e. "6ba7b810-9dad-11d1-80b4-00c04fd430c8"),
+// and must be kept in sync with the pattern config.ReadUUID checks at runtime
+const uuidPattern = `^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`
 
-func (s *service) builtinToCue(builtin schema.Builtin) ast.Expr {
+// builtinToCue converts a builtin type into a CUE type, returning an error
+// for builtins which cannot be represented in config.
+func (s *service) builtinToCue(builtin schema.Builtin) (ast.Expr, error) {
 	switch builtin {
 	case schema.Builtin_ANY:
-		return ast.NewIdent("_") // top
+		return ast.NewIdent("_"), nil // top
 	case schema.Builtin_BOOL:
-		return ast.NewIdent("bool")
+		return ast.NewIdent("bool"), nil
 	case schema.Builtin_INT8:
-		return ast.NewIdent("int8")
+		return ast.NewIdent("int8"), nil
 	case schema.Builtin_INT16:
-		return ast.NewIdent("int16")
+		return ast.NewIdent("int16"), nil
 	case schema.Builtin_INT32:
-		return ast.NewIdent("int32")
+		return ast.NewIdent("int32"), nil
 	case schema.Builtin_INT64:
-		return ast.NewIdent("int64")
+		return ast.NewIdent("int64"), nil
 	case schema.Builtin_UINT8:
-		return ast.NewIdent("uint8")
+		return ast.NewIdent("uint8"), nil
 	case schema.Builtin_UINT16:
-		return ast.NewIdent("uint16")
+		return ast.NewIdent("uint16"), nil
 	case schema.Builtin_UINT32:
-		return ast.NewIdent("uint32")
+		return ast.NewIdent("uint32"), nil
 	case schema.Builtin_UINT64:
-		return ast.NewIdent("uint64")
+		return ast.NewIdent("uint64"), nil
 	case schema.Builtin_FLOAT32:
-		return ast.NewIdent("float32")
+		return ast.NewIdent("float32"), nil
 	case schema.Builtin_FLOAT64:
-		return ast.NewIdent("float64")
+		return ast.NewIdent("float64"), nil
 	case schema.Builtin_STRING:
-		return ast.NewIdent("string")
+		return ast.NewIdent("string"), nil
 	case schema.Builtin_BYTES:
-		return ast.NewIdent("bytes")
+		return ast.NewIdent("bytes"), nil
 	case schema.Builtin_TIME:
-		return ast.NewSel(ast.NewIdent("time"), "Time")
+		s.neededImports["time"] = "time"
+		return ast.NewSel(ast.NewIdent("time"), "Time"), nil
+	case schema.Builtin_DURATION:
+		// Durations are given as strings in config (i.e. "1h30m")
+		s.neededImports["time"] = "time"
+		return ast.NewBinExpr(token.AND, ast.NewIdent("string"), ast.NewSel(ast.NewIdent("time"), "Duration")), nil
 	case schema.Builtin_UUID:
-		return ast.NewIdent("string")
+		// UUIDs are given in their canonical form, which is the only form the runtime decodes from config
+		return ast.NewBinExpr(token.AND, ast.NewIdent("string"), &ast.UnaryExpr{Op: token.MAT, X: ast.NewString(uuidPattern)}), nil
 	case schema.Builtin_JSON:
-		return ast.NewIdent("string")
+		// Raw JSON is given as a string holding the encoded value
+		s.neededImports["encoding/json"] = "json"
+		return ast.NewBinExpr(token.AND, ast.NewIdent("string"), ast.NewSel(ast.NewIdent("json"), "Valid")), nil
 	case schema.Builtin_USER_ID:
-		return ast.NewIdent("string")
+		return ast.NewIdent("string"), nil
 	case schema.Builtin_INT:
-		return ast.NewIdent("int")
+		return ast.NewIdent("int"), nil
 	case schema.Builtin_UINT:
-		return ast.NewIdent("uint")
+		return ast.NewIdent("uint"), nil
+	case schema.Builtin_NUMBER:
+		return ast.NewIdent("number"), nil
+	case schema.Builtin_DECIMAL, schema.Builtin_RAT:
+		// Decimals are given as strings in config (i.e. "19.99"), so they don't lose precision
+		return ast.NewBinExpr(token.AND, ast.NewIdent("string"), &ast.UnaryExpr{Op: token.MAT, X: ast.NewString(decimalPattern)}), nil
+	case unsupportedBuiltin:
+		return nil, errors.New("uintptr, complex64 and complex128 values cannot be represented in config, use an integer, float or string type instead")
 	default:
-		panic(fmt.Sprintf("unknown builtin: %s", builtin))
+		return nil, fmt.Errorf("unknown builtin: %s", builtin)
 	}
 }
 
@@ -0,0 +1,251 @@
+package cuegen
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"reflect"
+
+	"cuelang.org/go/cue/ast"
+	"cuelang.org/go/cue/ast/astutil"
+
+	"encr.dev/parser/encoding"
+	"encr.dev/parser/est"
+	schema "encr.dev/proto/encore/parser/schema/v1"
+)
+
+// sharedTypes are the named types generated into Options.SharedPackage
+type sharedTypes struct {
+	named []*schema.Named // in the order they were found
+	gen   *service        // generates the shared package, naming its definitions
+}
+
+// SharedDefinitions generates the CUE file of Options.SharedPackage, holding a definition for each
+// named type used by the config of more than one service. The files UserFacing generates for those
+// services import the package, so it must be placed where CUE resolves imports from, such as within
+// `cue.mod/gen/` under its import path.
+//
+// Nil is returned if the option isn't set, or no types are shared between services.
+func (g *Generator) SharedDefinitions() ([]byte, error) {
+	shared, err := g.sharedTypes()
+	if err != nil || shared == nil || len(shared.named) == 0 {
+		return nil, err
+	}
+	return shared.gen.generateShared()
+}
+
+// sharedTypes finds the types to generate into Options.SharedPackage, if set.
+//
+// A named type is shared if it's used within the config of more than one service, unless it has
+// fields only present in some environments (or uses types which do), as those are guarded on the
+// environment of the service. The types passed to config.Load are not shared themselves, as their
+// fields are given at the top level of each service's config.
+func (g *Generator) sharedTypes() (*sharedTypes, error) {
+	if g.opts.SharedPackage == "" || g.shared != nil {
+		return g.shared, nil
+	}
+	if name := path.Base(g.opts.SharedPackage); !ast.IsValidIdent(name) {
+		return nil, fmt.Errorf("invalid shared package %q: the last element of its import path must be a valid CUE identifier", g.opts.SharedPackage)
+	}
+
+	shared := &sharedTypes{
+		gen: g.newService(context.Background(), &est.Service{Name: path.Base(g.opts.SharedPackage)}),
+	}
+	shared.gen.shared = true
+
+	f := &sharedTypeFinder{
+		gen:      shared.gen,
+		named:    make(map[string]*schema.Named),
+		services: make(map[string]map[string]bool),
+		uses:     make(map[string][]string),
+		local:    make(map[string]bool),
+	}
+	for _, svc := range g.res.App.Services {
+		for _, load := range svc.ConfigLoads {
+			// The config type itself isn't shared, only the types used by its fields
+			concrete, err := encoding.GetConcreteType(g.res.Meta.Decls, load.ConfigStruct.Type, nil)
+			if err != nil {
+				return nil, err
+			}
+			if err := f.find(svc.Name, "", concrete); err != nil {
+				return nil, fmt.Errorf("service %s: %w", svc.Name, err)
+			}
+		}
+	}
+
+	// Types using other types which can't be shared can't be shared either, which
+	// is repeated until no more are found as those types may be used in turn
+	for changed := true; changed; {
+		changed = false
+		for key, uses := range f.uses {
+			for _, used := range uses {
+				if !f.local[key] && f.local[used] {
+					f.local[key] = true
+					changed = true
+				}
+			}
+		}
+	}
+
+	for _, key := range f.order {
+		if len(f.services[key]) > 1 && !f.local[key] {
+			shared.named = append(shared.named, f.named[key])
+		}
+	}
+
+	// Count the uses of the types within the shared package up front, so their
+	// definitions are named and known to be recursive before any service refers to them
+	for _, named := range shared.named {
+		typ := &schema.Type{Typ: &schema.Type_Named{Named: named}}
+		if err := shared.gen.countNamedUsages(typ); err != nil {
+			return nil, err
+		}
+		if err := shared.gen.markRecursiveTypes(typ, nil); err != nil {
+			return nil, err
+		}
+	}
+	g.shared = shared
+	return shared, nil
+}
+
+// sharedTypeFinder records the named types used by the config of each service
+type sharedTypeFinder struct {
+	gen      *service
+	order    []string                   // the keys of the named types, in the order they were found
+	named    map[string]*schema.Named   // key -> named type
+	services map[string]map[string]bool // key -> the services using the type
+	uses     map[string][]string        // key -> the keys of the named types its fields use
+	local    map[string]bool            // key -> whether the type must be generated by each service
+}
+
+// find records the named types used within the type by the service. Uses of them
+// are recorded against the named type with the given key, if any.
+func (f *sharedTypeFinder) find(svcName string, parent string, typ *schema.Type) error {
+	switch t := typ.Typ.(type) {
+	case *schema.Type_Named:
+		// The fields of custom types are never generated, so aren't walked
+		if _, isCustom := f.gen.customType(t.Named); isCustom {
+			return nil
+		}
+		key := f.gen.typeUsage.typeKey(typ)
+		if parent != "" {
+			f.uses[parent] = append(f.uses[parent], key)
+		}
+		if _, found := f.named[key]; !found {
+			f.order = append(f.order, key)
+			f.named[key] = t.Named
+			f.services[key] = make(map[string]bool)
+		} else if f.services[key][svcName] {
+			// The type has already been walked for this service, which also ends recursion
+			return nil
+		}
+		f.services[key][svcName] = true
+
+		concrete, err := encoding.GetConcreteType(f.gen.g.res.Meta.Decls, typ, nil)
+		if err != nil {
+			return err
+		}
+		return f.find(svcName, key, concrete)
+	case *schema.Type_Struct:
+		for _, field := range t.Struct.Fields {
+			envs, err := fieldEnvironments(field)
+			if err != nil {
+				return err
+			}
+			if len(envs) > 0 && parent != "" {
+				f.local[parent] = true
+			}
+			if field.Typ.GetTyp() == nil {
+				return fmt.Errorf("field %s: %w", field.Name, errUnrepresentableType)
+			}
+			if err := f.find(svcName, parent, field.Typ); err != nil {
+				return err
+			}
+		}
+	case *schema.Type_Map:
+		if err := f.find(svcName, parent, t.Map.Key); err != nil {
+			return err
+		}
+		return f.find(svcName, parent, t.Map.Value)
+	case *schema.Type_List:
+		return f.find(svcName, parent, t.List.Elem)
+	case *schema.Type_Pointer:
+		return f.find(svcName, parent, t.Pointer.Base)
+	case *schema.Type_Config:
+		return f.find(svcName, parent, t.Config.Elem)
+	}
+	return nil
+}
+
+// sharedType returns the reference to the definition of the named type within Options.SharedPackage,
+// if the type is shared between services and isn't being generated into the shared package itself
+func (s *service) sharedType(named *schema.Named) (ref string, found bool) {
+	if s.shared || s.g.opts.SharedPackage == "" {
+		return "", false
+	}
+	shared, err := s.g.sharedTypes()
+	if err != nil || !shared.contains(named) {
+		return "", false
+	}
+	return s.g.opts.SharedPackage + "." + shared.gen.typeUsage.CueIdent(named).Name, true
+}
+
+// contains reports whether the named type is one of the shared types
+func (t *sharedTypes) contains(named *schema.Named) bool {
+	for _, other := range t.named {
+		if reflect.DeepEqual(other, named) {
+			return true
+		}
+	}
+	return false
+}
+
+// isRecursive reports whether the named type refers back to itself, including
+// types which are shared and so aren't counted within the service
+func (s *service) isRecursive(named *schema.Named) bool {
+	if _, isShared := s.sharedType(named); isShared {
+		return s.g.shared.gen.typeUsage.IsRecursive(named)
+	}
+	return s.typeUsage.IsRecursive(named)
+}
+
+// standalone returns a generator of files which are evaluated on their own, rather than alongside
+// the shared package, such that the types which would be shared are generated within each file
+func (g *Generator) standalone() *Generator {
+	if g.opts.SharedPackage == "" {
+		return g
+	}
+	opts := *g.opts
+	opts.SharedPackage = ""
+	return NewGenerator(g.res, &opts)
+}
+
+// generateShared generates the file of the shared package, with a definition for each of the shared types
+func (s *service) generateShared() ([]byte, error) {
+	s.file = &ast.File{}
+	s.neededImports = make(map[string]string)
+	s.file.Decls = append(s.file.Decls, &ast.Package{Name: ast.NewIdent(s.svc.Name)})
+	s.file.AddComment(&ast.CommentGroup{
+		List: []*ast.Comment{
+			{Text: "// Code generated by encore. DO NOT EDIT."},
+			{Text: "//"},
+			{Text: "// The contents of this file are generated from the types used by the config"},
+			{Text: "// of more than one service, which the CUE files of those services import."},
+			{Text: "//"},
+			{Text: "// For more information about this file, see:"},
+			{Text: "// https://encore.dev/docs/develop/config"},
+		},
+	})
+
+	definitions, err := s.generateDefinitions()
+	if err != nil {
+		return nil, err
+	}
+	s.addImports()
+	s.file.Decls = append(s.file.Decls, definitions...)
+
+	if err := astutil.Sanitize(s.file); err != nil {
+		return nil, err
+	}
+	return s.format()
+}
@@ -35,7 +35,7 @@ package svc
 	// MagicNumber is complicated and requires
 	// a multi-line comment to explain it.
 	MagicNumber: int
-	ID:          string // An ID
+	ID:          string & =~"^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$" // An ID
 	PublicKey:   bytes
 }
 #Config
@@ -9,6 +9,8 @@
 // https://encore.dev/docs/develop/config
 package svc
 
+import "time"
+
 // #Meta contains metadata about the running Encore application.
 // The values in this struct will be injected by Encore upon deployment and can be
 // referenced from other config values for example when configuring a callback URL:
@@ -21,7 +23,6 @@ package svc
 		Cloud: "aws" | "azure" | "gcp" | "encore" | "local"        @tag(CloudType) // The cloud provider that the application is running in
 	}
 }
-import "time"
 
 // #Config is the top level configuration for the application and is generated
 // from the Go types you've passed into `config.Load[T]()`. Encore uses a definition
@@ -36,8 +37,8 @@ import "time"
 	// MagicNumber is complicated and requires
 	// a multi-line comment to explain it.
 	MagicNumber: int
-	Start:       time.Time // The time at which the service was first started
-	ID:          string    // An ID
+	Start:       time.Time                                                                                  // The time at which the service was first started
+	ID:          string & =~"^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$" // An ID
 	PublicKey:   bytes
 	AdminUsers: [...string]
 }
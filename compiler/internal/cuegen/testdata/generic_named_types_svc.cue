@@ -34,10 +34,10 @@ package svc
 	GRPC:    #DisablableOption_uint64 // The options for the GRPC server
 	List1:   #List_string             // A list of strings
 	List2:   #List_string
-	List3: [...int]
-	Map1: #Map_string_string
-	Map2: [int]: string
-	Map3: #Map_string_string
+	List3:   #List_int
+	Map1:    #Map_string_string
+	Map2:    #Map_int_string
+	Map3:    #Map_string_string
 }
 #Config
 
@@ -53,8 +53,15 @@ package svc
 	Disabled: bool // True if this is disabled
 }
 
+#List_int: [...int]
+
 #List_string: [...string]
 
+// A nice generic map
+#Map_int_string: {
+	[=~"^-?[0-9]+$"]: string
+}
+
 // A nice generic map
 #Map_string_string: {
 	[string]: string
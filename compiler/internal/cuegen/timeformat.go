@@ -0,0 +1,93 @@
+package cuegen
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// timeLayoutChunks maps the elements of a Go reference time layout
+// (see https://pkg.go.dev/time#pkg-constants) to a regex which matches them.
+//
+// The chunks are ordered such that longer chunks are matched before any
+// shorter chunk which is a prefix of them (i.e. "January" before "Jan").
+var timeLayoutChunks = []struct {
+	chunk string
+	regex string
+}{
+	{"January", "(January|February|March|April|May|June|July|August|September|October|November|December)"},
+	{"Jan", "(Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec)"},
+	{"Monday", "(Monday|Tuesday|Wednesday|Thursday|Friday|Saturday|Sunday)"},
+	{"Mon", "(Mon|Tue|Wed|Thu|Fri|Sat|Sun)"},
+	{"MST", "[A-Z]{3,5}"},
+	{"2006", "[0-9]{4}"},
+	{"Z07:00:00", "(Z|[+-][0-9]{2}:[0-9]{2}:[0-9]{2})"},
+	{"Z07:00", "(Z|[+-][0-9]{2}:[0-9]{2})"},
+	{"Z070000", "(Z|[+-][0-9]{6})"},
+	{"Z0700", "(Z|[+-][0-9]{4})"},
+	{"Z07", "(Z|[+-][0-9]{2})"},
+	{"-07:00:00", "[+-][0-9]{2}:[0-9]{2}:[0-9]{2}"},
+	{"-07:00", "[+-][0-9]{2}:[0-9]{2}"},
+	{"-070000", "[+-][0-9]{6}"},
+	{"-0700", "[+-][0-9]{4}"},
+	{"-07", "[+-][0-9]{2}"},
+	{"002", "(00[1-9]|0[1-9][0-9]|[12][0-9]{2}|3[0-5][0-9]|36[0-6])"},
+	{"__2", "( {2}[1-9]| [1-9][0-9]|[12][0-9]{2}|3[0-5][0-9]|36[0-6])"},
+	{"_2", "( [1-9]|[12][0-9]|3[01])"},
+	{"01", "(0[1-9]|1[0-2])"},
+	{"02", "(0[1-9]|[12][0-9]|3[01])"},
+	{"03", "(0[1-9]|1[0-2])"},
+	{"04", "[0-5][0-9]"},
+	{"05", "[0-5][0-9]"},
+	{"06", "[0-9]{2}"},
+	{"15", "([01][0-9]|2[0-3])"},
+	{"PM", "(AM|PM)"},
+	{"pm", "(am|pm)"},
+	{"1", "([1-9]|1[0-2])"},
+	{"2", "([1-9]|[12][0-9]|3[01])"},
+	{"3", "([1-9]|1[0-2])"},
+	{"4", "[0-5]?[0-9]"},
+	{"5", "[0-5]?[0-9]"},
+}
+
+// fractionalSecondsRegex matches the fractional seconds elements of a layout,
+// i.e. ".000" (fixed number of digits) or ",999" (optional trailing zeros)
+var fractionalSecondsRegex = regexp.MustCompile(`^[.,](0+|9+)([^0-9]|$)`)
+
+// timeLayoutToRegex converts a Go reference time layout (such as "2006-01-02")
+// into an anchored regex which matches strings in that layout.
+func timeLayoutToRegex(layout string) string {
+	var regex strings.Builder
+	regex.WriteString("^")
+
+layoutLoop:
+	for len(layout) > 0 {
+		if match := fractionalSecondsRegex.FindStringSubmatch(layout); match != nil {
+			separator := regexp.QuoteMeta(layout[:1])
+			digits := strconv.Itoa(len(match[1]))
+			if match[1][0] == '0' {
+				regex.WriteString(separator + "[0-9]{" + digits + "}")
+			} else {
+				regex.WriteString("(" + separator + "[0-9]{1," + digits + "})?")
+			}
+			layout = layout[1+len(match[1]):]
+			continue
+		}
+
+		for _, chunk := range timeLayoutChunks {
+			if strings.HasPrefix(layout, chunk.chunk) {
+				regex.WriteString(chunk.regex)
+				layout = layout[len(chunk.chunk):]
+				continue layoutLoop
+			}
+		}
+
+		// Otherwise the next rune is a literal
+		r := []rune(layout)[0]
+		regex.WriteString(regexp.QuoteMeta(string(r)))
+		layout = layout[len(string(r)):]
+	}
+
+	regex.WriteString("$")
+	return regex.String()
+}
@@ -0,0 +1,49 @@
+package cuegen
+
+import (
+	"regexp"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestTimeLayoutToRegex(t *testing.T) {
+	c := qt.New(t)
+
+	tests := []struct {
+		layout  string
+		valid   []string
+		invalid []string
+	}{
+		{
+			layout:  "2006-01-02",
+			valid:   []string{"2023-01-31", "1999-12-01"},
+			invalid: []string{"2023-13-01", "2023-01-32", "2023-1-1", "2023-01-01T00:00:00Z"},
+		},
+		{
+			layout:  "15:04",
+			valid:   []string{"00:00", "23:59"},
+			invalid: []string{"24:00", "12:60", "1:00"},
+		},
+		{
+			layout:  "2006-01-02T15:04:05.000Z07:00",
+			valid:   []string{"2023-01-31T12:30:45.123Z", "2023-01-31T12:30:45.000+01:00"},
+			invalid: []string{"2023-01-31T12:30:45Z", "2023-01-31T12:30:45.1234Z"},
+		},
+		{
+			layout:  "Jan _2 15:04:05.999",
+			valid:   []string{"Feb  3 01:02:03", "Feb 13 01:02:03.45"},
+			invalid: []string{"Feb 3 01:02:03", "February 13 01:02:03"},
+		},
+	}
+
+	for _, test := range tests {
+		regex := regexp.MustCompile(timeLayoutToRegex(test.layout))
+		for _, valid := range test.valid {
+			c.Check(regex.MatchString(valid), qt.IsTrue, qt.Commentf("layout %q should match %q", test.layout, valid))
+		}
+		for _, invalid := range test.invalid {
+			c.Check(regex.MatchString(invalid), qt.IsFalse, qt.Commentf("layout %q should not match %q", test.layout, invalid))
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package cuegen
+
+import (
+	"fmt"
+	"go/constant"
+	"strconv"
+	"strings"
+
+	"cuelang.org/go/cue/ast"
+	"cuelang.org/go/cue/token"
+	"golang.org/x/exp/slices"
+
+	schema "encr.dev/proto/encore/parser/schema/v1"
+)
+
+// discriminatorField returns the field which discriminates between the variants of the
+// struct, or nil if the struct is not a union
+func discriminatorField(stru *schema.Struct) *schema.Field {
+	for _, f := range stru.Fields {
+		if tag := fieldTag(f, "discriminator"); tag != nil && tag.Name != "false" {
+			return f
+		}
+	}
+	return nil
+}
+
+// discriminatorAttribute returns the @discriminator attribute for fields holding the given type,
+// or nil if the type is not a union
+func (s *service) discriminatorAttribute(typ *schema.Type) (*ast.Attribute, error) {
+	concrete, err := s.concreteType(typ)
+	if err != nil {
+		return nil, err
+	}
+	if concrete.GetStruct() == nil {
+		return nil, nil
+	}
+
+	disc := discriminatorField(concrete.GetStruct())
+	if disc == nil {
+		return nil, nil
+	}
+	return &ast.Attribute{Text: fmt.Sprintf("@discriminator(%s)", strconv.Quote(fieldLabel(disc)))}, nil
+}
+
+// unionToCue converts a struct with a discriminator field into a disjunction of its variants,
+// each of which constrains the discriminator to the value identifying that variant.
+//
+// A struct is a discriminated union when one of its fields is tagged as the discriminator
+// (i.e. `discriminator:"true"`). The value of the discriminator picks the variant of the union, and
+// the other fields list the variants they belong to (i.e. `variant:"s3,gcs"`), or belong to every
+// variant if they have no variant tag.
+//
+// For example:
+//
+//	type Storage struct {
+//	    Kind    string `json:"kind" discriminator:"true"`
+//	    Bucket  string `json:"bucket"`
+//	    Region  string `json:"region" variant:"s3"`
+//	    Project string `json:"project" variant:"gcs"`
+//	}
+//
+// is represented as a disjunction of a struct for each variant:
+//
+//	{kind: "s3", bucket: string, region: string} | {kind: "gcs", bucket: string, project: string}
+func (s *service) unionToCue(stru *schema.Struct, disc *schema.Field) (ast.Expr, error) {
+	discType, err := s.concreteType(disc.Typ)
+	if err != nil {
+		return nil, err
+	}
+	if discType.GetBuiltin() != schema.Builtin_STRING {
+		return nil, fmt.Errorf("field %s: discriminator fields must be strings", disc.Name)
+	}
+
+	// The variants are the values of the discriminator if it's an enum, otherwise those named by the fields
+	var variants []string
+	isEnum := false
+	if named := disc.Typ.GetNamed(); named != nil {
+		if values, found := s.g.res.App.Enums[named.Id]; found {
+			isEnum = true
+			for _, value := range values {
+				variants = append(variants, constant.StringVal(value.Value))
+			}
+		}
+	}
+	for _, f := range stru.Fields {
+		for _, variant := range fieldVariants(f) {
+			if !slices.Contains(variants, variant) {
+				if isEnum {
+					return nil, fmt.Errorf("field %s: variant %q is not a value of the discriminator %s", f.Name, variant, disc.Name)
+				}
+				variants = append(variants, variant)
+			}
+		}
+	}
+	if len(variants) == 0 {
+		return nil, fmt.Errorf("field %s: discriminated unions must have at least one variant", disc.Name)
+	}
+
+	discLabel := fieldLabel(disc)
+	options := make([]ast.Expr, len(variants))
+	for i, variant := range variants {
+		variantStruct := &schema.Struct{}
+		for _, f := range stru.Fields {
+			if fieldVariants := fieldVariants(f); len(fieldVariants) == 0 || slices.Contains(fieldVariants, variant) {
+				variantStruct.Fields = append(variantStruct.Fields, f)
+			}
+		}
+
+		decls, err := s.structToFields(variantStruct)
+		if err != nil {
+			return nil, err
+		}
+
+		// Pin the discriminator to the value of this variant
+		for _, decl := range decls {
+			// Each field is given its own line, as the variants would otherwise be formatted on a
+			// single line when held by a field, unless their fields are separated by comments
+			if decl.Pos().RelPos() == token.NoRelPos {
+				ast.SetRelPos(decl, token.Newline)
+			}
+			if field, ok := decl.(*ast.Field); ok {
+				if name, _, _ := ast.LabelName(field.Label); name == discLabel {
+					field.Value = ast.NewString(variant)
+					field.Optional = token.NoPos
+					s.addRequiredAttribute(field)
+				}
+			}
+		}
+		options[i] = newStruct(decls)
+	}
+
+	return ast.NewBinExpr(token.OR, options...), nil
+}
+
+// fieldVariants returns the variants of a union the field belongs to, or nil if it belongs to all of them
+func fieldVariants(f *schema.Field) []string {
+	tag := fieldTag(f, "variant")
+	if tag == nil {
+		return nil
+	}
+
+	var variants []string
+	for _, variant := range append([]string{tag.Name}, tag.Options...) {
+		if variant = strings.TrimSpace(variant); variant != "" {
+			variants = append(variants, variant)
+		}
+	}
+	return variants
+}
@@ -0,0 +1,47 @@
+package cuegen
+
+import (
+	"bytes"
+)
+
+// UserSectionMarker starts the section at the end of a generated file in which users can write
+// their own CUE, such as constraints between the generated fields. Everything from the line
+// holding the marker to the end of the file is kept when the file is regenerated.
+const UserSectionMarker = "// encore:user-section"
+
+// PreserveUserSection returns the newly generated content of a file with the user section of
+// the previously generated content appended to it, so the declarations within it are unified
+// with the regenerated fields. The generated content is returned as is if there was no user section.
+//
+// The user section follows any checksum of the file, so editing it does not fail VerifyChecksum.
+func (g *Generator) PreserveUserSection(generated, previous []byte) []byte {
+	_, user := splitUserSection(previous)
+	if len(user) == 0 {
+		return generated
+	}
+
+	content := make([]byte, 0, len(generated)+len(user)+2)
+	content = append(content, generated...)
+	if len(content) > 0 && !bytes.HasSuffix(content, []byte("\n")) {
+		content = append(content, '\n')
+	}
+	content = append(content, '\n')
+	content = append(content, user...)
+	if !bytes.HasSuffix(content, []byte("\n")) {
+		content = append(content, '\n')
+	}
+	return content
+}
+
+// splitUserSection splits the content of a generated file into the content generated
+// by Encore and the user section, which starts with the line holding UserSectionMarker
+func splitUserSection(content []byte) (generated, user []byte) {
+	if bytes.HasPrefix(content, []byte(UserSectionMarker)) {
+		return nil, content
+	}
+	idx := bytes.Index(content, []byte("\n"+UserSectionMarker))
+	if idx < 0 {
+		return content, nil
+	}
+	return content[:idx+1], content[idx+1:]
+}
@@ -1,12 +1,170 @@
 package cuegen
 
 import (
+	"fmt"
 	"strings"
+	"unicode"
 
 	"cuelang.org/go/cue/ast"
 	"cuelang.org/go/cue/token"
+
+	schema "encr.dev/proto/encore/parser/schema/v1"
 )
 
+// fieldTag returns the struct tag with the given key on the field, or nil if the field has no such tag
+func fieldTag(f *schema.Field, key string) *schema.Tag {
+	for _, tag := range f.Tags {
+		if tag.Key == key {
+			return tag
+		}
+	}
+	return nil
+}
+
+// tagValue returns the full value of a struct tag, as the parser splits the value
+// on commas into the tag name and options
+func tagValue(tag *schema.Tag) string {
+	return strings.Join(append([]string{tag.Name}, tag.Options...), ",")
+}
+
+// hasTypeParameters reports whether the type refers to any type parameters, other
+// than through the declarations of named types
+func hasTypeParameters(typ *schema.Type) bool {
+	switch t := typ.Typ.(type) {
+	case *schema.Type_TypeParameter:
+		return true
+	case *schema.Type_Named:
+		for _, arg := range t.Named.TypeArguments {
+			if hasTypeParameters(arg) {
+				return true
+			}
+		}
+	case *schema.Type_Struct:
+		for _, f := range t.Struct.Fields {
+			if hasTypeParameters(f.Typ) {
+				return true
+			}
+		}
+	case *schema.Type_Map:
+		return hasTypeParameters(t.Map.Key) || hasTypeParameters(t.Map.Value)
+	case *schema.Type_List:
+		return hasTypeParameters(t.List.Elem)
+	case *schema.Type_Pointer:
+		return hasTypeParameters(t.Pointer.Base)
+	case *schema.Type_Config:
+		return hasTypeParameters(t.Config.Elem)
+	}
+	return false
+}
+
+// fieldEnvironments returns the environments a field is limited to by its env tag
+// (i.e. `env:"prod,staging"`), or nil if it is present in all environments
+func fieldEnvironments(f *schema.Field) ([]string, error) {
+	tag := fieldTag(f, "env")
+	if tag == nil {
+		return nil, nil
+	}
+
+	var envs []string
+	for _, env := range append([]string{tag.Name}, tag.Options...) {
+		if env = strings.TrimSpace(env); env == "" {
+			return nil, fmt.Errorf("field %s: the env tag requires a comma separated list of environment names", f.Name)
+		}
+		envs = append(envs, env)
+	}
+	return envs, nil
+}
+
+// withoutDeprecation returns the doc comment without any "Deprecated:" paragraphs
+func withoutDeprecation(doc string) string {
+	var paragraphs []string
+	for _, paragraph := range strings.Split(strings.TrimSpace(doc), "\n\n") {
+		if !strings.HasPrefix(strings.TrimSpace(paragraph), "Deprecated:") {
+			paragraphs = append(paragraphs, paragraph)
+		}
+	}
+	return strings.TrimSpace(strings.Join(paragraphs, "\n\n"))
+}
+
+// deprecationNotice returns the text of any "Deprecated:" paragraphs of the doc comment on a
+// single line (i.e. "use ListenAddress instead"), and whether there were any such paragraphs
+func deprecationNotice(doc string) (notice string, deprecated bool) {
+	var notices []string
+	for _, paragraph := range strings.Split(strings.TrimSpace(doc), "\n\n") {
+		if paragraph = strings.TrimSpace(paragraph); strings.HasPrefix(paragraph, "Deprecated:") {
+			notices = append(notices, strings.Join(strings.Fields(strings.TrimPrefix(paragraph, "Deprecated:")), " "))
+			deprecated = true
+		}
+	}
+	return strings.TrimSpace(strings.Join(notices, " ")), deprecated
+}
+
+// fieldLabel returns the name the field is given in the config, which is the
+// name given in its json tag if there is one
+func fieldLabel(f *schema.Field) string {
+	if tag := fieldTag(f, "json"); tag != nil && tag.Name != "" {
+		return tag.Name
+	}
+	return f.Name
+}
+
+// isOptionalField reports whether the field has been marked as optional using
+// either `json:",omitempty"` or `cue:",opt"`
+func isOptionalField(f *schema.Field) bool {
+	for _, key := range []string{"json", "cue"} {
+		tag := fieldTag(f, key)
+		if tag == nil {
+			continue
+		}
+		for _, option := range tag.Options {
+			if (key == "json" && option == "omitempty") || (key == "cue" && option == "opt") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// packageName converts a service name into a valid CUE package name, by replacing any
+// characters which can't be used in an identifier with underscores, and adding a
+// prefix or suffix to names which start with a digit or are keywords
+func packageName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+
+	if name == "" || unicode.IsDigit([]rune(name)[0]) {
+		name = "svc_" + name
+	}
+	if token.Lookup(name) != token.IDENT {
+		name += "_"
+	}
+	return name
+}
+
+// isExcluded reports whether the field has been excluded from the config using `json:"-"`
+func isExcluded(f *schema.Field) bool {
+	tag := fieldTag(f, "json")
+	return tag != nil && tag.Name == "-" && len(tag.Options) == 0
+}
+
+// isSensitive reports whether the field has been marked as sensitive using `encore:"sensitive"`
+func isSensitive(f *schema.Field) bool {
+	tag := fieldTag(f, "encore")
+	if tag == nil {
+		return false
+	}
+	for _, option := range append([]string{tag.Name}, tag.Options...) {
+		if option == "sensitive" {
+			return true
+		}
+	}
+	return false
+}
+
 // addCommentToField adds the given string to a Field
 //
 // If the str is a single line, then the comment group will be positioned at
@@ -18,17 +176,35 @@ func addCommentToField(field *ast.Field, str string) {
 	lines := strings.Split(strings.TrimSpace(str), "\n")
 
 	// Position 4 = after the attached node, position 0 = before the attached node
+	// (each attribute on the field after the first moves the end of the node along by one,
+	// while list values are printed without an indent so end one position earlier, unless
+	// they're followed by an attribute)
 	commentPosition := int8(4)
-	_, isStruct := field.Value.(*ast.StructLit)
-	if len(lines) > 1 || isStruct {
+	if _, isList := field.Value.(*ast.ListLit); isList && len(field.Attrs) == 0 {
+		commentPosition = 3
+	}
+	if len(field.Attrs) > 1 {
+		commentPosition += int8(len(field.Attrs) - 1)
+	}
+	if len(lines) > 1 || spansMultipleLines(field.Value) {
 		commentPosition = 0
 	}
+	addCommentGroup(field, lines, commentPosition)
+}
+
+// addLeadingCommentToField adds the comment to the field as a doc comment above
+// it, regardless of how many lines the comment or field spans
+func addLeadingCommentToField(field *ast.Field, str string) {
+	addCommentGroup(field, strings.Split(strings.TrimSpace(str), "\n"), 0)
+}
+
+func addCommentGroup(field *ast.Field, lines []string, commentPosition int8) {
 	grp := &ast.CommentGroup{
 		Position: commentPosition,
 	}
 
 	for _, line := range lines {
-		grp.List = append(grp.List, &ast.Comment{Text: "// " + line})
+		grp.List = append(grp.List, &ast.Comment{Text: strings.TrimSpace("// " + line)})
 	}
 
 	// If this comment is multiline, then the first line should be positioned on a NewSection for force an empty line
@@ -40,40 +216,48 @@ func addCommentToField(field *ast.Field, str string) {
 	field.AddComment(grp)
 }
 
-// commentAlreadyPresent returns true if the field already contains all of the comment of `contains`
-// within one of it's existing comment groups
-func commentAlreadyPresent(field *ast.Field, contains *ast.CommentGroup) bool {
-	if len(contains.List) == 0 {
+// spansMultipleLines reports whether the value will be printed across multiple
+// lines, as it contains a struct, in which case a trailing comment would be
+// printed after the end of the value rather than on the field's line.
+func spansMultipleLines(expr ast.Expr) bool {
+	switch expr := expr.(type) {
+	case *ast.StructLit:
 		return true
-	}
-
-commentGroupLoop:
-	for _, c := range field.Comments() {
-		// Range over this group comment
-	groupLineLoop:
-		for i, line := range c.List {
-			if i+len(contains.List) > len(c.List) {
-				// If we've not got enough lines to contain the entire comment, then
-				// we can try the next comment group
-				continue commentGroupLoop
-			}
-
-			// If we find the first line then great, let's check it
-			if strings.TrimSpace(line.Text) == strings.TrimSpace(contains.List[0].Text) {
-				for j, containsLine := range contains.List {
-					if strings.TrimSpace(c.List[i+j].Text) != strings.TrimSpace(containsLine.Text) {
-						continue groupLineLoop
-					}
-				}
-
-				// If here the entire comment group is contained within field already
+	case *ast.ListLit:
+		for _, elem := range expr.Elts {
+			if spansMultipleLines(elem) {
 				return true
 			}
 		}
+	case *ast.Ellipsis:
+		return expr.Type != nil && spansMultipleLines(expr.Type)
+	case *ast.BinaryExpr:
+		return spansMultipleLines(expr.X) || spansMultipleLines(expr.Y)
 	}
 	return false
 }
 
+// commentText returns the text of the given comment lines, normalized such that
+// the same comment is given the same text wherever it is positioned
+func commentText(lines []*ast.Comment) string {
+	texts := make([]string, len(lines))
+	for i, line := range lines {
+		texts[i] = strings.TrimSpace(line.Text)
+	}
+	return strings.Join(texts, "\n")
+}
+
+// addCommentTexts adds the text of every run of lines within the comment group
+// to seen, so that a comment is treated as present if a field's existing
+// comments already contain all of it
+func addCommentTexts(seen map[string]bool, grp *ast.CommentGroup) {
+	for i := range grp.List {
+		for j := i + 1; j <= len(grp.List); j++ {
+			seen[commentText(grp.List[i:j])] = true
+		}
+	}
+}
+
 func hasCommentInPosition(field *ast.Field, pos int8) bool {
 	for _, c := range field.Comments() {
 		if len(c.List) > 1 {
@@ -85,3 +269,12 @@ func hasCommentInPosition(field *ast.Field, pos int8) bool {
 	}
 	return false
 }
+
+// newStruct creates a struct containing the given declarations.
+//
+// Unlike ast.NewStruct, this accepts any declaration, including comprehensions.
+func newStruct(decls []ast.Decl) *ast.StructLit {
+	stru := ast.NewStruct()
+	stru.Elts = decls
+	return stru
+}
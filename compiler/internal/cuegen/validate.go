@@ -0,0 +1,882 @@
+package cuegen
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"cuelang.org/go/cue/ast"
+	"cuelang.org/go/cue/literal"
+	"cuelang.org/go/cue/parser"
+	"cuelang.org/go/cue/token"
+
+	schema "encr.dev/proto/encore/parser/schema/v1"
+)
+
+// validateRule is a single rule from a go-playground `validate` struct tag (i.e. `min=1`)
+type validateRule struct {
+	name  string
+	param string
+}
+
+// parseValidateTag parses the rules within a `validate` struct tag
+func parseValidateTag(tag *schema.Tag) []validateRule {
+	var rules []validateRule
+	for _, rule := range append([]string{tag.Name}, tag.Options...) {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+
+		name, param, _ := strings.Cut(rule, "=")
+		rules = append(rules, validateRule{name: name, param: param})
+	}
+	return rules
+}
+
+// fieldRules returns the rules of a `validate` struct tag which apply to the field itself,
+// rather than to its elements
+func fieldRules(tag *schema.Tag) []validateRule {
+	rules, _, _ := splitDive(parseValidateTag(tag))
+	return rules
+}
+
+// validateConstraints converts the rules of a `validate` struct tag on a field into CUE constraints
+// which should be unified with the field's value.
+//
+// Some constraints can't be expressed on the field itself, in which case they are returned as
+// hidden sibling fields which must be added to the same struct as the field.
+//
+// Rules which have no CUE equivalent are ignored, as they will still be checked
+// at runtime by the validator.
+func (s *service) validateConstraints(f *schema.Field, label ast.Label) (constraints []ast.Expr, siblings []*ast.Field, err error) {
+	tag := fieldTag(f, "validate")
+	if tag == nil {
+		return nil, nil, nil
+	}
+
+	typ, err := s.concreteType(f.Typ)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.rulesConstraints(f, label, typ, parseValidateTag(tag))
+}
+
+// errNotExpressible is returned when converting a rule which can't be expressed in CUE,
+// such as a rule on a type CUE has no equivalent check for, so the rule can be ignored
+var errNotExpressible = errors.New("validation rule can't be expressed in CUE")
+
+// rulesConstraints converts validation rules into CUE constraints on a value of the given type.
+//
+// The label is nil when the value is the element of a list or map, which hidden sibling
+// fields can't refer to, so rules needing them are ignored.
+func (s *service) rulesConstraints(f *schema.Field, label ast.Label, typ *schema.Type, rules []validateRule) (constraints []ast.Expr, siblings []*ast.Field, err error) {
+	rules, elemRules, dive := splitDive(rules)
+
+	omitEmpty := false
+	for _, rule := range rules {
+		var (
+			exprs   []ast.Expr
+			expr    ast.Expr
+			sibling *ast.Field
+			err     error
+		)
+		switch rule.name {
+		case "omitempty":
+			omitEmpty = true
+		case "min", "max", "len":
+			exprs, sibling, err = s.lengthOrBoundConstraint(f, label, typ, rule)
+		case "gt", "gte", "lt", "lte":
+			exprs, sibling, err = s.comparisonConstraint(f, label, typ, rule)
+		case "oneof":
+			expr, err = s.oneOfConstraint(f, typ, rule)
+		case "email", "url", "uuid", "alpha", "alphanum", "numeric", "lowercase", "uppercase", "ip", "ipv4":
+			expr, err = s.stringFormatConstraint(f, typ, rule)
+		case "unique":
+			exprs, sibling, err = s.uniqueConstraint(f, label, typ, rule)
+		case "dir", "dirpath", "file", "filepath":
+			if typ.GetBuiltin() != schema.Builtin_STRING {
+				continue
+			}
+			// Whether the path exists can only be checked at runtime, but it must at least be a path
+			expr = &ast.UnaryExpr{Op: token.MAT, X: ast.NewString(pathPattern)}
+		case "startswith", "endswith", "contains":
+			if !s.g.opts.StringContentRules {
+				continue
+			}
+			expr, err = s.stringContentConstraint(f, typ, rule)
+		}
+		if errors.Is(err, errNotExpressible) {
+			continue
+		} else if err != nil {
+			return nil, nil, err
+		}
+
+		if expr != nil {
+			exprs = append(exprs, expr)
+		}
+		constraints = append(constraints, exprs...)
+		if sibling != nil {
+			siblings = append(siblings, sibling)
+		}
+	}
+
+	if dive {
+		expr, err := s.diveConstraint(f, typ, elemRules)
+		if err != nil {
+			return nil, nil, err
+		}
+		if expr != nil {
+			constraints = append(constraints, expr)
+		}
+	}
+
+	// The validator doesn't check the other rules of an omitempty field holding its zero value,
+	// so the zero value is allowed alongside them. Hidden sibling fields can't be made to depend
+	// on the field's value, so their rules are left to the validator.
+	if omitEmpty && len(constraints) > 0 {
+		zero := zeroValue(typ)
+		if zero == nil {
+			return nil, nil, nil
+		}
+		either := ast.NewBinExpr(token.OR, zero, &ast.ParenExpr{X: ast.NewBinExpr(token.AND, constraints...)})
+		return []ast.Expr{&ast.ParenExpr{X: either}}, nil, nil
+	} else if omitEmpty {
+		return nil, nil, nil
+	}
+
+	return constraints, siblings, nil
+}
+
+// splitDive splits validation rules at the first `dive`, returning the rules before it which
+// apply to the field itself, and the rules after it which apply to each of its elements
+func splitDive(rules []validateRule) (own, elem []validateRule, dive bool) {
+	for i, rule := range rules {
+		if rule.name == "dive" {
+			return rules[:i], rules[i+1:], true
+		}
+	}
+	return rules, nil, false
+}
+
+// diveConstraint converts the rules following a `dive` into a constraint on each element of
+// a list or value of a map, or nil if none of the rules can be expressed in CUE.
+func (s *service) diveConstraint(f *schema.Field, typ *schema.Type, rules []validateRule) (ast.Expr, error) {
+	var elem *schema.Type
+	switch t := typ.Typ.(type) {
+	case *schema.Type_List:
+		elem = t.List.Elem
+	case *schema.Type_Map:
+		elem = t.Map.Value
+	default:
+		return nil, nil
+	}
+	for _, rule := range rules {
+		// Rules on the keys of a map are given between `keys` and `endkeys`, which we don't translate
+		if rule.name == "keys" {
+			return nil, nil
+		}
+	}
+
+	elemTyp, err := s.concreteType(elem)
+	if err != nil {
+		return nil, err
+	}
+	constraints, _, err := s.rulesConstraints(f, nil, elemTyp, rules)
+	if err != nil || len(constraints) == 0 {
+		return nil, err
+	}
+
+	value := ast.NewBinExpr(token.AND, constraints...)
+	if typ.GetList() != nil {
+		return ast.NewList(&ast.Ellipsis{Type: value}), nil
+	}
+	return ast.NewStruct(ast.NewList(ast.NewIdent("string")), value), nil
+}
+
+// zeroValue returns the zero value of the type as a CUE expression, or nil if it has none
+// which can be given in config
+func zeroValue(typ *schema.Type) ast.Expr {
+	switch {
+	case typ.GetBuiltin() == schema.Builtin_STRING:
+		return ast.NewString("")
+	case typ.GetBuiltin() == schema.Builtin_BOOL:
+		return ast.NewBool(false)
+	case isNumberType(typ):
+		return ast.NewLit(token.INT, "0")
+	case typ.GetList() != nil:
+		return ast.NewList()
+	case typ.GetMap() != nil:
+		return ast.NewCall(ast.NewIdent("close"), ast.NewStruct())
+	default:
+		return nil
+	}
+}
+
+// pathPattern matches non-empty strings which are valid paths on any filesystem, which is
+// any string without a null byte
+const pathPattern = `^[^\x00]+$`
+
+// isPathField reports whether the field holds a filesystem path, according to its `validate` struct tag
+func isPathField(f *schema.Field) bool {
+	tag := fieldTag(f, "validate")
+	if tag == nil {
+		return false
+	}
+	for _, rule := range fieldRules(tag) {
+		switch rule.name {
+		case "dir", "dirpath", "file", "filepath":
+			return true
+		}
+	}
+	return false
+}
+
+// lengthOrBoundConstraint converts a `min`, `max` or `len` rule into a CUE constraint.
+//
+// Like go-playground's validator, these rules are bounds on numbers and lengths on strings, lists and maps.
+func (s *service) lengthOrBoundConstraint(f *schema.Field, label ast.Label, typ *schema.Type, rule validateRule) ([]ast.Expr, *ast.Field, error) {
+	switch t := typ.Typ.(type) {
+	case *schema.Type_Builtin:
+		switch t.Builtin {
+		case schema.Builtin_STRING:
+			n, err := lengthParam(f, rule)
+			if err != nil {
+				return nil, nil, err
+			}
+			if s.g.opts.StringLengthInBytes {
+				sibling, err := byteLengthConstraint(f, label, rule.name, n)
+				return nil, sibling, err
+			}
+			return lengthConstraints(s.importedCall("strings", "MinRunes"), s.importedCall("strings", "MaxRunes"), rule.name, n), nil, nil
+
+		case schema.Builtin_INT, schema.Builtin_INT8, schema.Builtin_INT16, schema.Builtin_INT32, schema.Builtin_INT64,
+			schema.Builtin_UINT, schema.Builtin_UINT8, schema.Builtin_UINT16, schema.Builtin_UINT32, schema.Builtin_UINT64,
+			schema.Builtin_FLOAT32, schema.Builtin_FLOAT64, schema.Builtin_NUMBER:
+			bound, err := numberLit(rule.param)
+			if err != nil {
+				return nil, nil, fmt.Errorf("field %s: invalid %s validation parameter %q: %v", f.Name, rule.name, rule.param, err)
+			}
+			switch rule.name {
+			case "min":
+				return []ast.Expr{&ast.UnaryExpr{Op: token.GEQ, X: bound}}, nil, nil
+			case "max":
+				return []ast.Expr{&ast.UnaryExpr{Op: token.LEQ, X: bound}}, nil, nil
+			default:
+				return []ast.Expr{bound}, nil, nil
+			}
+		}
+
+	case *schema.Type_List:
+		n, err := lengthParam(f, rule)
+		if err != nil {
+			return nil, nil, err
+		}
+		return listLengthConstraints(s.importedCall("list", "MaxItems"), rule.name, n), nil, nil
+
+	case *schema.Type_Map:
+		n, err := lengthParam(f, rule)
+		if err != nil {
+			return nil, nil, err
+		}
+		return lengthConstraints(s.importedCall("struct", "MinFields"), s.importedCall("struct", "MaxFields"), rule.name, n), nil, nil
+	}
+
+	return nil, nil, errNotExpressible
+}
+
+// comparisonConstraint converts a `gt`, `gte`, `lt` or `lte` rule into a CUE constraint.
+//
+// Like go-playground's validator, these are bounds on numbers and lengths on strings, lists and maps,
+// with gte and lte being equivalent to min and max.
+func (s *service) comparisonConstraint(f *schema.Field, label ast.Label, typ *schema.Type, rule validateRule) ([]ast.Expr, *ast.Field, error) {
+	if isNumberType(typ) && (rule.name == "gt" || rule.name == "lt") {
+		bound, err := numberLit(rule.param)
+		if err != nil {
+			return nil, nil, fmt.Errorf("field %s: invalid %s validation parameter %q: %v", f.Name, rule.name, rule.param, err)
+		}
+		op := token.GTR
+		if rule.name == "lt" {
+			op = token.LSS
+		}
+		return []ast.Expr{&ast.UnaryExpr{Op: op, X: bound}}, nil, nil
+	}
+	if !isNumberType(typ) && typ.GetBuiltin() != schema.Builtin_STRING && typ.GetList() == nil && typ.GetMap() == nil {
+		return nil, nil, errNotExpressible
+	}
+
+	equivalent := validateRule{name: "min", param: rule.param}
+	if rule.name == "lt" || rule.name == "lte" {
+		equivalent.name = "max"
+	}
+	if rule.name == "gt" || rule.name == "lt" {
+		// Lengths are whole numbers, so an exclusive bound is the next inclusive one
+		n, err := lengthParam(f, rule)
+		if err != nil {
+			return nil, nil, err
+		}
+		if rule.name == "gt" {
+			n++
+		} else if n == 0 {
+			return nil, nil, fmt.Errorf("field %s: invalid lt validation parameter %q: no length is less than zero", f.Name, rule.param)
+		} else {
+			n--
+		}
+		equivalent.param = strconv.Itoa(n)
+	}
+	return s.lengthOrBoundConstraint(f, label, typ, equivalent)
+}
+
+// oneOfConstraint converts a `oneof` rule on a string or integer into a disjunction of the
+// values it lists, which are separated by spaces and may be quoted (i.e. `oneof='a b' c`).
+func (s *service) oneOfConstraint(f *schema.Field, typ *schema.Type, rule validateRule) (ast.Expr, error) {
+	values := oneOfValues.FindAllString(rule.param, -1)
+	if len(values) == 0 {
+		return nil, fmt.Errorf("field %s: the oneof validation rule requires at least one value", f.Name)
+	}
+
+	options := make([]ast.Expr, len(values))
+	for i, value := range values {
+		if len(value) > 1 && strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'") {
+			value = value[1 : len(value)-1]
+		}
+
+		switch {
+		case typ.GetBuiltin() == schema.Builtin_STRING:
+			options[i] = ast.NewString(value)
+		case isNumberType(typ) && !isFloatType(typ):
+			if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+				return nil, fmt.Errorf("field %s: invalid oneof validation value %q: expected an integer", f.Name, value)
+			}
+			options[i] = ast.NewLit(token.INT, value)
+		default:
+			return nil, errNotExpressible
+		}
+	}
+	return ast.NewBinExpr(token.OR, options...), nil
+}
+
+// oneOfValues matches the values listed by a `oneof` rule
+var oneOfValues = regexp.MustCompile(`'[^']*'|\S+`)
+
+// stringFormats are the patterns strings must match for the format rules of go-playground's validator
+var stringFormats = map[string]string{
+	"email":    `^[^@\s]+@[^@\s]+\.[^@\s]+$`,
+	"url":      `^[a-zA-Z][a-zA-Z0-9+.-]*:[^\s]+$`,
+	"uuid":     `^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`,
+	"alpha":    `^[a-zA-Z]+$`,
+	"alphanum": `^[a-zA-Z0-9]+$`,
+	"numeric":  `^[-+]?[0-9]+(?:\.[0-9]+)?$`,
+}
+
+// stringFormatConstraint converts a rule requiring a string to be of a format (i.e. `email`) into a CUE constraint.
+//
+// The constraints are more lenient than the validator where the format is hard to match exactly,
+// such as for email addresses, so config is only rejected when the validator would also reject it.
+func (s *service) stringFormatConstraint(f *schema.Field, typ *schema.Type, rule validateRule) (ast.Expr, error) {
+	if typ.GetBuiltin() != schema.Builtin_STRING {
+		return nil, errNotExpressible
+	}
+
+	switch rule.name {
+	case "ip":
+		return s.importedCall("net", "IP")(), nil
+	case "ipv4":
+		return s.importedCall("net", "IPv4")(), nil
+	case "lowercase":
+		return &ast.UnaryExpr{Op: token.NMAT, X: ast.NewString(uppercaseLetters)}, nil
+	case "uppercase":
+		return &ast.UnaryExpr{Op: token.NMAT, X: ast.NewString(lowercaseLetters)}, nil
+	default:
+		return &ast.UnaryExpr{Op: token.MAT, X: ast.NewString(stringFormats[rule.name])}, nil
+	}
+}
+
+// uppercaseLetters and lowercaseLetters match the letters which are changed when a string is
+// converted to the other case, including titlecase letters (such as "ǅ") which change either way
+const (
+	uppercaseLetters = `[\p{Lu}\p{Lt}]`
+	lowercaseLetters = `[\p{Ll}\p{Lt}]`
+)
+
+// isNumberType reports whether the type is a builtin number
+func isNumberType(typ *schema.Type) bool {
+	switch typ.GetBuiltin() {
+	case schema.Builtin_INT, schema.Builtin_INT8, schema.Builtin_INT16, schema.Builtin_INT32, schema.Builtin_INT64,
+		schema.Builtin_UINT, schema.Builtin_UINT8, schema.Builtin_UINT16, schema.Builtin_UINT32, schema.Builtin_UINT64,
+		schema.Builtin_FLOAT32, schema.Builtin_FLOAT64, schema.Builtin_NUMBER:
+		return true
+	default:
+		return false
+	}
+}
+
+// isFloatType reports whether the type is a builtin number which may have a fractional part
+func isFloatType(typ *schema.Type) bool {
+	switch typ.GetBuiltin() {
+	case schema.Builtin_FLOAT32, schema.Builtin_FLOAT64, schema.Builtin_NUMBER:
+		return true
+	default:
+		return false
+	}
+}
+
+// uniqueConstraint converts a `unique` rule on a list into a CUE constraint.
+//
+// Without a parameter the items of the list must be unique. With a parameter (i.e. `unique=Name`)
+// the list must contain structs, and the named field must be unique across them. This is checked
+// by a hidden sibling field which indexes the list by that field, as any duplicate key would
+// then conflict on the index it maps to.
+func (s *service) uniqueConstraint(f *schema.Field, label ast.Label, typ *schema.Type, rule validateRule) ([]ast.Expr, *ast.Field, error) {
+	list := typ.GetList()
+	if list == nil {
+		// Uniqueness of map values has no CUE equivalent
+		if typ.GetMap() != nil {
+			return nil, nil, nil
+		}
+		return nil, nil, errNotExpressible
+	}
+
+	if rule.param == "" {
+		return []ast.Expr{s.importedCall("list", "UniqueItems")()}, nil, nil
+	}
+
+	if label == nil {
+		return nil, nil, errNotExpressible
+	}
+	name, isIdent, err := ast.LabelName(label)
+	if err != nil || !isIdent {
+		return nil, nil, fmt.Errorf("field %s: unique validation requires the field name to be a valid CUE identifier", f.Name)
+	}
+
+	// Find the label of the field which must be unique within the list's elements
+	elem, err := s.concreteType(list.Elem)
+	if err != nil {
+		return nil, nil, err
+	}
+	var key string
+	for _, elemField := range elem.GetStruct().GetFields() {
+		if elemField.Name == rule.param {
+			key = elemField.Name
+			if tag := fieldTag(elemField, "json"); tag != nil && tag.Name != "" {
+				key = tag.Name
+			}
+			break
+		}
+	}
+	if key == "" {
+		return nil, nil, fmt.Errorf("field %s: unique validation parameter %q is not a field of the list's elements", f.Name, rule.param)
+	}
+	if !ast.IsValidIdent(key) {
+		return nil, nil, fmt.Errorf("field %s: unique validation requires the field %s to have a valid CUE identifier as its name", f.Name, rule.param)
+	}
+
+	index, err := parser.ParseExpr("unique constraint", fmt.Sprintf(`{for i, x in %s {"\(x.%s)": i}}`, name, key))
+	if err != nil {
+		return nil, nil, err
+	}
+	return nil, &ast.Field{
+		Label: ast.NewIdent(fmt.Sprintf("_%s_unique%s", name, rule.param)),
+		Value: index,
+	}, nil
+}
+
+// lengthAttributes returns attributes mirroring the `min`, `max` and `len` rules on a
+// string or list field, named after the equivalent JSON Schema keywords.
+func (s *service) lengthAttributes(f *schema.Field) ([]*ast.Attribute, error) {
+	tag := fieldTag(f, "validate")
+	if tag == nil {
+		return nil, nil
+	}
+
+	typ, err := s.concreteType(f.Typ)
+	if err != nil {
+		return nil, err
+	}
+
+	var keyword string
+	switch {
+	case typ.GetBuiltin() == schema.Builtin_STRING:
+		keyword = "Length"
+	case typ.GetList() != nil:
+		keyword = "Items"
+	default:
+		return nil, nil
+	}
+
+	var attrs []*ast.Attribute
+	for _, rule := range fieldRules(tag) {
+		var prefixes []string
+		switch rule.name {
+		case "min":
+			prefixes = []string{"min"}
+		case "max":
+			prefixes = []string{"max"}
+		case "len":
+			prefixes = []string{"min", "max"}
+		default:
+			continue
+		}
+
+		n, err := lengthParam(f, rule)
+		if err != nil {
+			return nil, err
+		}
+		for _, prefix := range prefixes {
+			attrs = append(attrs, &ast.Attribute{Text: fmt.Sprintf("@%s%s(%d)", prefix, keyword, n)})
+		}
+	}
+	return attrs, nil
+}
+
+// integerRanges are the bounds of the sized integer types, as CUE number literals
+var integerRanges = map[schema.Builtin][2]string{
+	schema.Builtin_INT8:   {"-128", "127"},
+	schema.Builtin_INT16:  {"-32768", "32767"},
+	schema.Builtin_INT32:  {"-2147483648", "2147483647"},
+	schema.Builtin_INT64:  {"-9223372036854775808", "9223372036854775807"},
+	schema.Builtin_UINT:   {"0", ""},
+	schema.Builtin_UINT8:  {"0", "255"},
+	schema.Builtin_UINT16: {"0", "65535"},
+	schema.Builtin_UINT32: {"0", "4294967295"},
+	schema.Builtin_UINT64: {"0", "18446744073709551615"},
+}
+
+// boundAttributes returns attributes mirroring the bounds of a number field, named after
+// the equivalent JSON Schema keywords. The `min`, `max` and `len` rules of the field's
+// `validate` tag take precedence over the range of its type.
+func (s *service) boundAttributes(f *schema.Field) ([]*ast.Attribute, error) {
+	typ, err := s.concreteType(f.Typ)
+	if err != nil {
+		return nil, err
+	}
+
+	var minimum, maximum string
+	switch builtin := typ.GetBuiltin(); builtin {
+	case schema.Builtin_INT, schema.Builtin_FLOAT32, schema.Builtin_FLOAT64, schema.Builtin_NUMBER:
+		// Only bounded by the validate tag
+	default:
+		bounds, isInteger := integerRanges[builtin]
+		if !isInteger {
+			return nil, nil
+		}
+		minimum, maximum = bounds[0], bounds[1]
+	}
+
+	// Whichever of the type's range and the validate rules is tighter bounds the field
+	if tag := fieldTag(f, "validate"); tag != nil {
+		for _, rule := range fieldRules(tag) {
+			if rule.name != "min" && rule.name != "max" && rule.name != "len" {
+				continue
+			}
+			bound, ok := new(big.Rat).SetString(rule.param)
+			if !ok {
+				return nil, fmt.Errorf("field %s: invalid %s validation parameter %q", f.Name, rule.name, rule.param)
+			}
+			if rule.name != "max" && (minimum == "" || bound.Cmp(mustRat(minimum)) > 0) {
+				minimum = rule.param
+			}
+			if rule.name != "min" && (maximum == "" || bound.Cmp(mustRat(maximum)) < 0) {
+				maximum = rule.param
+			}
+		}
+	}
+
+	var attrs []*ast.Attribute
+	if minimum != "" {
+		attrs = append(attrs, &ast.Attribute{Text: fmt.Sprintf("@minimum(%s)", minimum)})
+	}
+	if maximum != "" {
+		attrs = append(attrs, &ast.Attribute{Text: fmt.Sprintf("@maximum(%s)", maximum)})
+	}
+	return attrs, nil
+}
+
+// mustRat parses a number which is known to be valid
+func mustRat(number string) *big.Rat {
+	r, ok := new(big.Rat).SetString(number)
+	if !ok {
+		panic(fmt.Sprintf("invalid number %q", number))
+	}
+	return r
+}
+
+// constraintAttributes returns attributes mirroring a constraint from a `cue` struct tag, named
+// after the equivalent JSON Schema keywords, or nil if any part of the constraint has no such keyword
+func constraintAttributes(expr ast.Expr) []*ast.Attribute {
+	switch expr := expr.(type) {
+	case *ast.ParenExpr:
+		return constraintAttributes(expr.X)
+	case *ast.BinaryExpr:
+		// Each side of a conjunction is a separate constraint (i.e. `>=0 & <=1`)
+		if expr.Op != token.AND {
+			return nil
+		}
+		x, y := constraintAttributes(expr.X), constraintAttributes(expr.Y)
+		if x == nil || y == nil {
+			return nil
+		}
+		return append(x, y...)
+	case *ast.UnaryExpr:
+		lit, ok := expr.X.(*ast.BasicLit)
+		if !ok {
+			return nil
+		}
+
+		var keyword string
+		switch expr.Op {
+		case token.MAT:
+			if lit.Kind != token.STRING {
+				return nil
+			}
+			pattern, err := literal.Unquote(lit.Value)
+			if err != nil {
+				return nil
+			}
+
+			// Escaped quotes can't be given in attributes, so patterns with quotes are given as raw strings
+			quoted := strconv.Quote(pattern)
+			if strings.Contains(pattern, `"`) {
+				if strings.Contains(pattern, `"#`) {
+					return nil
+				}
+				quoted = `#"` + pattern + `"#`
+			}
+			return []*ast.Attribute{{Text: fmt.Sprintf("@pattern(%s)", quoted)}}
+		case token.GEQ:
+			keyword = "minimum"
+		case token.LEQ:
+			keyword = "maximum"
+		case token.GTR:
+			keyword = "exclusiveMinimum"
+		case token.LSS:
+			keyword = "exclusiveMaximum"
+		default:
+			return nil
+		}
+		if lit.Kind != token.INT && lit.Kind != token.FLOAT {
+			return nil
+		}
+		return []*ast.Attribute{{Text: fmt.Sprintf("@%s(%s)", keyword, lit.Value)}}
+	default:
+		return nil
+	}
+}
+
+// stringContentConstraint converts a `startswith`, `endswith` or `contains` rule on a string into a CUE constraint
+func (s *service) stringContentConstraint(f *schema.Field, typ *schema.Type, rule validateRule) (ast.Expr, error) {
+	if typ.GetBuiltin() != schema.Builtin_STRING {
+		return nil, errNotExpressible
+	}
+
+	switch rule.name {
+	case "startswith":
+		return &ast.UnaryExpr{Op: token.MAT, X: ast.NewString("^" + regexp.QuoteMeta(rule.param))}, nil
+	case "endswith":
+		return &ast.UnaryExpr{Op: token.MAT, X: ast.NewString(regexp.QuoteMeta(rule.param) + "$")}, nil
+	default:
+		return s.importedCall("strings", "Contains")(ast.NewString(rule.param)), nil
+	}
+}
+
+// requiredUnless converts a `required_unless` rule (i.e. `required_unless=Mode manual`) into
+// comprehensions which require the field unless every one of the other fields named in the rule
+// has the given value, along with a note documenting the condition.
+//
+// Like go-playground's validator, an optional field which isn't set is treated as having
+// its zero value.
+func (s *service) requiredUnless(f *schema.Field, stru *schema.Struct, label ast.Label) (decls []ast.Decl, note string, err error) {
+	tag := fieldTag(f, "validate")
+	if tag == nil {
+		return nil, "", nil
+	}
+
+	name, isIdent, err := ast.LabelName(label)
+	if err != nil || !isIdent {
+		return nil, "", fmt.Errorf("field %s: required_unless validation requires the field name to be a valid CUE identifier", f.Name)
+	}
+	require := func(clauses ...ast.Clause) ast.Decl {
+		return &ast.Comprehension{
+			Clauses: clauses,
+			Value:   ast.NewStruct(ast.NewIdent(name), ast.NewIdent("_")),
+		}
+	}
+
+	var conditions []string
+	for _, rule := range parseValidateTag(tag) {
+		if rule.name != "required_unless" {
+			continue
+		}
+
+		params := strings.Fields(rule.param)
+		if len(params) == 0 || len(params)%2 != 0 {
+			return nil, "", fmt.Errorf("field %s: invalid required_unless validation parameter %q: expected pairs of field names and values", f.Name, rule.param)
+		}
+
+		for i := 0; i < len(params); i += 2 {
+			other, value := structField(stru, params[i]), params[i+1]
+			if other == nil {
+				return nil, "", fmt.Errorf("field %s: required_unless validation refers to unknown field %s", f.Name, params[i])
+			}
+			otherLabel := fieldLabel(other)
+			if !ast.IsValidIdent(otherLabel) {
+				return nil, "", fmt.Errorf("field %s: required_unless validation requires the field %s to have a valid CUE identifier as its name", f.Name, other.Name)
+			}
+			lit, err := s.scalarLiteral(other, rule.name, value)
+			if err != nil {
+				return nil, "", err
+			}
+
+			differs := &ast.IfClause{Condition: ast.NewBinExpr(token.NEQ, ast.NewIdent(otherLabel), lit)}
+			if !isOptionalField(other) {
+				decls = append(decls, require(differs))
+			} else {
+				// Optional fields can only be referenced once we know they are set
+				if !isZeroLit(lit) {
+					decls = append(decls, require(&ast.IfClause{Condition: ast.NewBinExpr(token.EQL, ast.NewIdent(otherLabel), &ast.BottomLit{})}))
+				}
+				decls = append(decls, require(&ast.IfClause{Condition: ast.NewBinExpr(token.NEQ, ast.NewIdent(otherLabel), &ast.BottomLit{})}, differs))
+			}
+			conditions = append(conditions, fmt.Sprintf("%s is %s", otherLabel, value))
+		}
+	}
+	if len(conditions) == 0 {
+		return nil, "", nil
+	}
+
+	return decls, "required unless " + strings.Join(conditions, " and "), nil
+}
+
+// structField returns the field of the struct with the given Go name, or nil
+// if there is no such field in the config
+func structField(stru *schema.Struct, name string) *schema.Field {
+	for _, f := range stru.Fields {
+		if f.Name == name && !isExcluded(f) {
+			return f
+		}
+	}
+	return nil
+}
+
+// isZeroLit reports whether the literal is the zero value of its type
+func isZeroLit(lit *ast.BasicLit) bool {
+	switch lit.Kind {
+	case token.STRING:
+		return lit.Value == `""`
+	case token.FALSE:
+		return true
+	case token.INT, token.FLOAT:
+		f, err := strconv.ParseFloat(lit.Value, 64)
+		return err == nil && f == 0
+	}
+	return false
+}
+
+// lengthConstraints returns the constraints for a `min`, `max` or `len` rule using the given validator functions
+func lengthConstraints(minFunc, maxFunc func(args ...ast.Expr) ast.Expr, rule string, n int) []ast.Expr {
+	switch rule {
+	case "min":
+		return []ast.Expr{minFunc(ast.NewLit(token.INT, strconv.Itoa(n)))}
+	case "max":
+		return []ast.Expr{maxFunc(ast.NewLit(token.INT, strconv.Itoa(n)))}
+	default:
+		return []ast.Expr{
+			minFunc(ast.NewLit(token.INT, strconv.Itoa(n))),
+			maxFunc(ast.NewLit(token.INT, strconv.Itoa(n))),
+		}
+	}
+}
+
+// listLengthConstraints returns the constraints for a `min`, `max` or `len` rule on a list.
+//
+// Minimum lengths are expressed as a list of that many elements followed by an
+// ellipsis (i.e. `[_, _, ...]`), rather than with `list.MinItems`, as the latter is
+// not satisfied by the open list the field is declared as.
+func listLengthConstraints(maxFunc func(args ...ast.Expr) ast.Expr, rule string, n int) []ast.Expr {
+	elems := func(ellipsis bool) ast.Expr {
+		list := make([]ast.Expr, n, n+1)
+		for i := range list {
+			list[i] = ast.NewIdent("_")
+		}
+		if ellipsis {
+			list = append(list, &ast.Ellipsis{})
+		}
+		return ast.NewList(list...)
+	}
+
+	switch rule {
+	case "min":
+		if n == 0 {
+			return nil
+		}
+		return []ast.Expr{elems(true)}
+	case "max":
+		return []ast.Expr{maxFunc(ast.NewLit(token.INT, strconv.Itoa(n)))}
+	default:
+		return []ast.Expr{elems(false)}
+	}
+}
+
+// byteLengthConstraint returns a hidden field which checks the length of the string field in bytes.
+//
+// CUE has no validator for the byte length of a string, so we instead compare
+// `len()` of the field, which for strings counts bytes, against the bound.
+func byteLengthConstraint(f *schema.Field, label ast.Label, rule string, n int) (*ast.Field, error) {
+	if label == nil {
+		return nil, errNotExpressible
+	}
+	name, isIdent, err := ast.LabelName(label)
+	if err != nil || !isIdent {
+		return nil, fmt.Errorf("field %s: byte length validation requires the field name to be a valid CUE identifier", f.Name)
+	}
+
+	length := ast.NewCall(ast.NewIdent("len"), ast.NewIdent(name))
+	bound := ast.NewLit(token.INT, strconv.Itoa(n))
+
+	var check ast.Expr
+	switch rule {
+	case "min":
+		check = ast.NewBinExpr(token.GEQ, length, bound)
+	case "max":
+		check = ast.NewBinExpr(token.LEQ, length, bound)
+	default:
+		check = ast.NewBinExpr(token.EQL, length, bound)
+	}
+
+	return &ast.Field{
+		Label: ast.NewIdent(fmt.Sprintf("_%s_%sBytes", name, rule)),
+		Value: ast.NewBinExpr(token.AND, ast.NewIdent("true"), check),
+	}, nil
+}
+
+// lengthParam parses the parameter of a length rule
+func lengthParam(f *schema.Field, rule validateRule) (int, error) {
+	n, err := strconv.Atoi(rule.param)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("field %s: invalid %s validation parameter %q: expected a non-negative integer", f.Name, rule.name, rule.param)
+	}
+	return n, nil
+}
+
+// numberLit parses a number into a CUE literal
+func numberLit(str string) (*ast.BasicLit, error) {
+	if _, err := strconv.ParseInt(str, 10, 64); err == nil {
+		return ast.NewLit(token.INT, str), nil
+	}
+	if _, err := strconv.ParseFloat(str, 64); err != nil {
+		return nil, err
+	}
+	return ast.NewLit(token.FLOAT, str), nil
+}
+
+// importedCall returns a function which creates a call to the given function
+// within a CUE package, marking the package as needing to be imported.
+func (s *service) importedCall(pkg, function string) func(args ...ast.Expr) ast.Expr {
+	return func(args ...ast.Expr) ast.Expr {
+		s.neededImports[pkg] = pkg
+		return ast.NewCall(ast.NewSel(ast.NewIdent(pkg), function), args...)
+	}
+}
@@ -2,10 +2,18 @@ package compiler
 
 import (
 	"bytes"
+	"errors"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+
+	"encr.dev/compiler/internal/cuegen"
 	"encr.dev/parser/est"
+	"encr.dev/pkg/cueutil"
 	"encr.dev/pkg/errinsrc/srcerrors"
 )
 
@@ -40,6 +48,39 @@ func (b *builder) GenUserFacing() (err error) {
 	return nil
 }
 
+// GenConfigDocs generates a markdown reference of the config of each service
+// in the app which loads config, keyed by the name of the service.
+func GenConfigDocs(appRoot string) (docs map[string][]byte, err error) {
+	b := &builder{
+		cfg:     &Config{},
+		appRoot: appRoot,
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			if b, ok := e.(bailout); ok {
+				err = b.err
+			} else {
+				err = srcerrors.UnhandledPanic(e)
+			}
+		}
+	}()
+
+	if err := b.parseApp(); err != nil {
+		return nil, err
+	}
+	docs = make(map[string][]byte)
+	for _, svc := range b.res.App.Services {
+		doc, err := b.cuegen.MarkdownDocs(svc)
+		if err != nil {
+			return nil, err
+		}
+		if doc != nil {
+			docs[svc.Name] = doc
+		}
+	}
+	return docs, nil
+}
+
 func (b *builder) genUserFacing() error {
 	for _, svc := range b.res.App.Services {
 		if err := b.generateUserFacingGoCode(svc); err != nil {
@@ -50,7 +91,7 @@ func (b *builder) genUserFacing() error {
 			return err
 		}
 	}
-	return nil
+	return b.generateSharedCueFile(b.appRoot)
 }
 
 func (b *builder) generateUserFacingGoCode(svc *est.Service) (err error) {
@@ -73,17 +114,202 @@ func (b *builder) generateUserFacingGoCode(svc *est.Service) (err error) {
 
 func (b *builder) generateUserFacingCueCode(svc *est.Service) (err error) {
 	dst := filepath.Join(b.appRoot, svc.Root.RelPath, "encore.gen.cue")
+	previous, err := os.ReadFile(dst)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	// Keep the record of any config files scaffolded for the service
+	if files := cuegen.ScaffoldedFiles(previous); files != "" && b.scaffolded[svc.Name] == "" {
+		b.recordScaffolded(svc, files)
+	}
+
 	f, err := b.cuegen.UserFacing(svc)
 	if err != nil {
 		return err
 	}
 
 	if f == nil || len(f) == 0 {
-		// No need for any generated code. Try to remove the existing file
-		// if it's there as it's no longer needed.
+		// No need for any generated code. Try to remove the existing files
+		// if they're there as they're no longer needed.
+		_ = os.Remove(dst)
+		_ = os.Remove(filepath.Join(b.appRoot, svc.Root.RelPath, "encore.gen.schema.json"))
+		return nil
+	}
+
+	// Keep any constraints the user has written within the file
+	if previous != nil {
+		f = b.cuegen.PreserveUserSection(f, previous)
+	}
+
+	if err := os.WriteFile(dst, f, 0644); err != nil {
+		return err
+	}
+	return b.generateUserFacingJSONSchema(svc)
+}
+
+// sharedCuePackage is the import path of the CUE package holding the definitions of the
+// types used by the config of more than one service, if enabled in encore.app
+const sharedCuePackage = "encore.gen/config"
+
+// generateSharedCueFile writes the shared CUE package within the cue.mod directory under root,
+// from where the CUE files of the services import it. If no types are shared, any previously
+// generated file is removed.
+func (b *builder) generateSharedCueFile(root string) error {
+	dir := filepath.Join(root, "cue.mod", "gen", filepath.FromSlash(sharedCuePackage))
+	dst := filepath.Join(dir, "encore.gen.cue")
+	f, err := b.cuegen.SharedDefinitions()
+	if err != nil {
+		return err
+	}
+
+	if len(f) == 0 {
+		_ = os.Remove(dst)
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(dst, f, 0644)
+}
+
+// generateUserFacingJSONSchema writes a JSON Schema document describing the config of the
+// service, if the app has enabled it. Otherwise any previously generated document is removed.
+func (b *builder) generateUserFacingJSONSchema(svc *est.Service) error {
+	dst := filepath.Join(b.appRoot, svc.Root.RelPath, "encore.gen.schema.json")
+	if !b.appConfig.JSONSchema {
 		_ = os.Remove(dst)
 		return nil
 	}
 
+	f, err := b.cuegen.JSONSchema(svc)
+	if err != nil {
+		return err
+	}
 	return os.WriteFile(dst, f, 0644)
 }
+
+// ScaffoldConfig writes skeleton config files for each environment of the services in the app,
+// returning the names of the files written for each service by service name.
+//
+// Config is only scaffolded for apps which have no config files of their own yet, and only for
+// services which have not been scaffolded before, as recorded in the header of their generated
+// CUE file, so files the user has since deleted are not recreated. Existing files are never overwritten.
+func ScaffoldConfig(appRoot string) (written map[string][]string, err error) {
+	b := &builder{
+		cfg:     &Config{},
+		appRoot: appRoot,
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			if b, ok := e.(bailout); ok {
+				err = b.err
+			} else {
+				err = srcerrors.UnhandledPanic(e)
+			}
+		}
+	}()
+
+	for _, fn := range []func() error{
+		b.parseApp,
+		b.pickupConfigFiles,
+	} {
+		if err := fn(); err != nil {
+			return nil, err
+		}
+	}
+	if hasUserConfig, err := b.hasUserConfigFiles(); err != nil || hasUserConfig {
+		return nil, err
+	}
+
+	written = make(map[string][]string)
+	for _, svc := range b.res.App.Services {
+		if len(svc.ConfigLoads) == 0 {
+			continue
+		}
+		previous, err := os.ReadFile(filepath.Join(b.appRoot, svc.Root.RelPath, "encore.gen.cue"))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		} else if cuegen.ScaffoldedFiles(previous) != "" {
+			continue
+		}
+
+		files, err := b.scaffoldCueConfig(svc)
+		if err != nil {
+			return nil, err
+		} else if len(files) == 0 {
+			continue
+		}
+		written[svc.Name] = files
+
+		// Record the scaffolding in the service's generated file
+		b.recordScaffolded(svc, strings.Join(files, ", "))
+		if err := b.generateUserFacingCueCode(svc); err != nil {
+			return nil, err
+		}
+	}
+	return written, nil
+}
+
+// hasUserConfigFiles reports whether the app has any config files other than those Encore generates
+func (b *builder) hasUserConfigFiles() (found bool, err error) {
+	err = fs.WalkDir(b.configFiles, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || found {
+			return err
+		}
+		if strings.HasPrefix(path, "cue.mod/") || strings.Contains(path, "/cue.mod/") {
+			return nil
+		}
+		name := d.Name()
+		found = (filepath.Ext(name) == ".cue" && name != "encore.gen.cue") || cueutil.IsConfigDataFile(name)
+		return nil
+	})
+	return found, err
+}
+
+// scaffoldCueConfig writes skeleton config files for each environment of the service,
+// returning the names of the files written. Existing files are never overwritten.
+func (b *builder) scaffoldCueConfig(svc *est.Service) (written []string, err error) {
+	dir := filepath.Join(b.appRoot, svc.Root.RelPath)
+	files, err := b.cuegen.EnvironmentScaffolds(svc)
+	if err != nil {
+		return nil, err
+	}
+
+	names := maps.Keys(files)
+	slices.Sort(names)
+	for _, name := range names {
+		f, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		_, err = f.Write(files[name])
+		if err2 := f.Close(); err == nil {
+			err = err2
+		}
+		if err != nil {
+			return nil, err
+		}
+		written = append(written, name)
+	}
+	return written, nil
+}
+
+// recordScaffolded records the config files scaffolded for the service, so the record is
+// kept in the header of its generated CUE file
+func (b *builder) recordScaffolded(svc *est.Service, files string) {
+	if b.scaffolded == nil {
+		b.scaffolded = make(map[string]string)
+	}
+	b.scaffolded[svc.Name] = files
+}
+
+// cueServiceMetadata returns the metadata recorded in the header of the generated CUE file of the service
+func (b *builder) cueServiceMetadata(svc *est.Service) map[string]string {
+	if files := b.scaffolded[svc.Name]; files != "" {
+		return map[string]string{cuegen.ScaffoldedMetadata: files}
+	}
+	return nil
+}
@@ -247,6 +247,11 @@ func (b *builder) generateCueFiles(svc *est.Service) (err error) {
 		return nil
 	}
 
+	// Keep any constraints the user has written within the app's copy of the file
+	if previous, err := os.ReadFile(filepath.Join(b.appRoot, svc.Root.RelPath, "encore.gen.cue")); err == nil {
+		f = b.cuegen.PreserveUserSection(f, previous)
+	}
+
 	dst := filepath.Join(b.workdir, filepath.FromSlash(svc.Root.RelPath), "encore.gen.cue")
 	return os.WriteFile(dst, f, 0644)
 }
@@ -131,6 +131,14 @@ func ConvertBuiltInSchemaToJenType(builtin schema.Builtin) *Statement {
 		return Qual("encore.dev/types/uuid", "UUID")
 	case schema.Builtin_JSON:
 		return Qual("encoding/json", "RawMessage")
+	case schema.Builtin_NUMBER:
+		return Qual("encoding/json", "Number")
+	case schema.Builtin_DURATION:
+		return Qual("time", "Duration")
+	case schema.Builtin_DECIMAL:
+		return Qual("github.com/shopspring/decimal", "Decimal")
+	case schema.Builtin_RAT:
+		return Qual("math/big", "Rat")
 	case schema.Builtin_USER_ID:
 		return Qual("encore.dev/beta/auth", "UID")
 	case schema.Builtin_INT:
@@ -235,6 +235,32 @@ func (b *MarshallingCodeGenerator) builtinFromString(t schema.Builtin, slice boo
 		fn = methodDescription{true, "ToJSON", String(), Qual("encoding/json", "RawMessage"), false, []Code{
 			Return(Qual("encoding/json", "RawMessage").Call(Id("s"))),
 		}}
+	case schema.Builtin_DURATION:
+		fn = methodDescription{true, "ToDuration", String(), Qual("time", "Duration"), false, []Code{
+			List(Id("x"), Err()).Op(":=").Qual("strconv", "ParseInt").Call(Id("s"), Lit(10), Lit(64)),
+			Id("e").Dot("setErr").Call(Lit("invalid parameter"), Id("field"), Err()),
+			Return(Qual("time", "Duration").Call(Id("x"))),
+		}}
+	case schema.Builtin_DECIMAL:
+		fn = methodDescription{true, "ToDecimal", String(), Qual("github.com/shopspring/decimal", "Decimal"), false, []Code{
+			List(Id("v"), Err()).Op(":=").Qual("github.com/shopspring/decimal", "NewFromString").Call(Id("s")),
+			Id("e").Dot("setErr").Call(Lit("invalid parameter"), Id("field"), Err()),
+			Return(Id("v")),
+		}}
+	case schema.Builtin_RAT:
+		fn = methodDescription{true, "ToRat", String(), Qual("math/big", "Rat"), false, []Code{
+			Var().Id("v").Qual("math/big", "Rat"),
+			If(List(Id("_"), Id("ok")).Op(":=").Id("v").Dot("SetString").Call(Id("s")), Op("!").Id("ok")).Block(
+				Id("e").Dot("setErr").Call(Lit("invalid parameter"), Id("field"), Qual("fmt", "Errorf").Call(Lit("invalid rational number: %q"), Id("s"))),
+			),
+			Return(Id("v")),
+		}}
+	case schema.Builtin_NUMBER:
+		fn = methodDescription{true, "ToNumber", String(), Qual("encoding/json", "Number"), false, []Code{
+			List(Id("_"), Err()).Op(":=").Qual("strconv", "ParseFloat").Call(Id("s"), Lit(64)),
+			Id("e").Dot("setErr").Call(Lit("invalid parameter"), Id("field"), Err()),
+			Return(Qual("encoding/json", "Number").Call(Id("s"))),
+		}}
 	default:
 		type kind int
 		const (
@@ -359,6 +385,22 @@ func (b *MarshallingCodeGenerator) builtinToString(t schema.Builtin, slice bool)
 		fn = methodDescription{false, "FromJSON", Qual("encoding/json", "RawMessage"), String(), false, []Code{
 			Return(String().Call(Id("s"))),
 		}}
+	case schema.Builtin_DURATION:
+		fn = methodDescription{false, "FromDuration", Qual("time", "Duration"), String(), false, []Code{
+			Return(Qual("strconv", "FormatInt").Call(Int64().Call(Id("s")), Lit(10))),
+		}}
+	case schema.Builtin_DECIMAL:
+		fn = methodDescription{false, "FromDecimal", Qual("github.com/shopspring/decimal", "Decimal"), String(), false, []Code{
+			Return(Id("s").Dot("String").Call()),
+		}}
+	case schema.Builtin_RAT:
+		fn = methodDescription{false, "FromRat", Qual("math/big", "Rat"), String(), false, []Code{
+			Return(Id("s").Dot("RatString").Call()),
+		}}
+	case schema.Builtin_NUMBER:
+		fn = methodDescription{false, "FromNumber", Qual("encoding/json", "Number"), String(), false, []Code{
+			Return(Id("s").Dot("String").Call()),
+		}}
 	default:
 		type kind int
 		const (
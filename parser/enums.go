@@ -0,0 +1,228 @@
+package parser
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/token"
+
+	"golang.org/x/exp/slices"
+
+	"encr.dev/parser/est"
+	schema "encr.dev/proto/encore/parser/schema/v1"
+)
+
+// parseEnums collects the constants declared for every named builtin type
+// (i.e. `type Level string`) within the package declaring that type.
+//
+// It returns a map of decl id to the enum values of that decl. Decls which have
+// no constants, or have constants we are unable to evaluate, are not included.
+func (p *parser) parseEnums() map[uint32][]*est.EnumValue {
+	enums := make(map[uint32][]*est.EnumValue)
+
+	for _, decl := range p.decls {
+		if len(decl.TypeParams) > 0 || !isEnumBuiltin(decl.Type) {
+			continue
+		}
+
+		pkg, found := p.pkgMap[decl.Loc.GetPkgPath()]
+		if !found {
+			continue
+		}
+
+		if values := enumValues(pkg, decl.Name); len(values) > 0 {
+			enums[decl.Id] = values
+		}
+	}
+
+	return enums
+}
+
+// isEnumBuiltin reports whether typ is a builtin which can be the underlying type of an enum
+func isEnumBuiltin(typ *schema.Type) bool {
+	builtin, ok := typ.GetTyp().(*schema.Type_Builtin)
+	if !ok {
+		return false
+	}
+
+	switch builtin.Builtin {
+	case schema.Builtin_STRING,
+		schema.Builtin_INT, schema.Builtin_INT8, schema.Builtin_INT16, schema.Builtin_INT32, schema.Builtin_INT64,
+		schema.Builtin_UINT, schema.Builtin_UINT8, schema.Builtin_UINT16, schema.Builtin_UINT32, schema.Builtin_UINT64:
+		return true
+	default:
+		return false
+	}
+}
+
+// constSpec is a constant declared within a package, with the type and value Go gives it
+// (which are repeated from the previous spec in the const block if not given)
+type constSpec struct {
+	name string
+	typ  ast.Expr // nil if the constant is untyped
+	expr ast.Expr
+	iota int64
+	doc  *ast.CommentGroup
+}
+
+// packageConsts returns the constants declared within pkg, in the order they are declared
+func packageConsts(pkg *est.Package) []constSpec {
+	var consts []constSpec
+	for _, file := range pkg.Files {
+		for _, decl := range file.AST.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.CONST {
+				continue
+			}
+
+			// Track the last type and values within the const block, as Go repeats
+			// them for any spec which declares neither (i.e. `iota` based enums).
+			var (
+				typ   ast.Expr
+				exprs []ast.Expr
+			)
+			for iota, spec := range gen.Specs {
+				spec := spec.(*ast.ValueSpec)
+				if spec.Type != nil || len(spec.Values) > 0 {
+					typ, exprs = spec.Type, spec.Values
+				}
+
+				doc := spec.Doc
+				if doc == nil || doc.Text() == "" {
+					doc = spec.Comment
+				}
+				for i, name := range spec.Names {
+					if i >= len(exprs) {
+						break
+					}
+					consts = append(consts, constSpec{name: name.Name, typ: typ, expr: exprs[i], iota: int64(iota), doc: doc})
+				}
+			}
+		}
+	}
+	return consts
+}
+
+// enumValues returns the constants declared with the type typeName within pkg.
+//
+// If any of those constants cannot be evaluated, nil is returned as we
+// can not know the full set of values.
+func enumValues(pkg *est.Package, typeName string) []*est.EnumValue {
+	consts := packageConsts(pkg)
+	byName := make(map[string]constSpec, len(consts))
+	for _, c := range consts {
+		byName[c.name] = c
+	}
+
+	var values []*est.EnumValue
+	for _, c := range consts {
+		if c.name == "_" || constTypeName(c, byName, nil) != typeName {
+			continue
+		}
+
+		value := evalConstExpr(unconvert(c.expr, c.typ), c.iota, byName, nil)
+		if value.Kind() == constant.Unknown {
+			return nil
+		}
+
+		// Constants may alias the values of others (i.e. `Default = Info`), but each value is only listed once
+		if slices.IndexFunc(values, func(v *est.EnumValue) bool { return constant.Compare(v.Value, token.EQL, value) }) >= 0 {
+			continue
+		}
+
+		values = append(values, &est.EnumValue{
+			Name:  c.name,
+			Doc:   c.doc.Text(),
+			Value: value,
+		})
+	}
+
+	return values
+}
+
+// constTypeName returns the name of the type of the constant, which is either given
+// explicitly, by a conversion such as `Level("debug")`, or by the constant it is
+// declared as (i.e. `Default Level = Info`). It is empty for untyped constants.
+func constTypeName(c constSpec, consts map[string]constSpec, seen []string) string {
+	typ := c.typ
+	if typ == nil {
+		switch expr := c.expr.(type) {
+		case *ast.CallExpr:
+			if len(expr.Args) == 1 {
+				typ = expr.Fun
+			}
+		case *ast.Ident:
+			if other, found := consts[expr.Name]; found && !slices.Contains(seen, expr.Name) {
+				return constTypeName(other, consts, append(seen, c.name))
+			}
+		}
+	}
+	if ident, ok := typ.(*ast.Ident); ok {
+		return ident.Name
+	}
+	return ""
+}
+
+// unconvert returns the value within a conversion such as `Level("debug")`, if the constant has no explicit type
+func unconvert(expr, typ ast.Expr) ast.Expr {
+	if call, ok := expr.(*ast.CallExpr); ok && typ == nil && len(call.Args) == 1 {
+		return call.Args[0]
+	}
+	return expr
+}
+
+// evalConstExpr evaluates a constant expression consisting of literals, iota and
+// references to the other constants declared within the package.
+//
+// If the expression cannot be evaluated, a value of kind constant.Unknown is returned.
+func evalConstExpr(expr ast.Expr, iota int64, consts map[string]constSpec, seen []string) constant.Value {
+	switch expr := expr.(type) {
+	case *ast.BasicLit:
+		return constant.MakeFromLiteral(expr.Value, expr.Kind, 0)
+
+	case *ast.Ident:
+		if expr.Name == "iota" {
+			return constant.MakeInt64(iota)
+		}
+		// The referenced constant is evaluated with its own iota, guarding against cycles
+		if other, found := consts[expr.Name]; found && !slices.Contains(seen, expr.Name) {
+			return evalConstExpr(unconvert(other.expr, other.typ), other.iota, consts, append(seen, expr.Name))
+		}
+
+	case *ast.ParenExpr:
+		return evalConstExpr(expr.X, iota, consts, seen)
+
+	case *ast.UnaryExpr:
+		return constant.UnaryOp(expr.Op, evalConstExpr(expr.X, iota, consts, seen), 0)
+
+	case *ast.BinaryExpr:
+		x, y := evalConstExpr(expr.X, iota, consts, seen), evalConstExpr(expr.Y, iota, consts, seen)
+		if x.Kind() == constant.Unknown || y.Kind() == constant.Unknown {
+			return constant.MakeUnknown()
+		}
+		if (x.Kind() == constant.String) != (y.Kind() == constant.String) {
+			return constant.MakeUnknown()
+		}
+
+		switch expr.Op {
+		case token.SHL, token.SHR:
+			shift, ok := constant.Uint64Val(y)
+			if !ok {
+				return constant.MakeUnknown()
+			}
+			return constant.Shift(x, expr.Op, uint(shift))
+		case token.QUO:
+			if constant.Sign(y) == 0 {
+				return constant.MakeUnknown()
+			}
+			if x.Kind() == constant.Int && y.Kind() == constant.Int {
+				return constant.BinaryOp(x, token.QUO_ASSIGN, y)
+			}
+		case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ,
+			token.LAND, token.LOR:
+			return constant.MakeUnknown()
+		}
+		return constant.BinaryOp(x, expr.Op, y)
+	}
+
+	return constant.MakeUnknown()
+}
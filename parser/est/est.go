@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"go/ast"
+	"go/constant"
 	"go/token"
 	"time"
 
@@ -25,11 +26,21 @@ type Application struct {
 	PubSubTopics  []*PubSubTopic
 	CacheClusters []*CacheCluster
 	Decls         []*schema.Decl
+	Enums         map[uint32][]*EnumValue // decl id -> enum values
 	AuthHandler   *AuthHandler
 	Middleware    []*Middleware
 	Metrics       []*Metric
 }
 
+// EnumValue is a constant declared with a named builtin type.
+// Together, the constants declared for a type within the package
+// which declares that type make up the enum values of that type.
+type EnumValue struct {
+	Name  string         // the name of the constant
+	Doc   string         // the documentation of the constant
+	Value constant.Value // the value of the constant
+}
+
 type File struct {
 	Name       string          // file name ("foo.go")
 	Pkg        *Package        // package it belongs to
@@ -290,6 +290,8 @@ func (p *parser) validateCacheKeyspace(ks *est.CacheKeyspace, con cacheKeyspaceC
 				return fmt.Errorf("'any'/'interface{}' is not supported")
 			case schema.Builtin_JSON:
 				return fmt.Errorf("json.RawMessage is not supported")
+			case schema.Builtin_NUMBER:
+				return fmt.Errorf("json.Number is not supported")
 			case schema.Builtin_FLOAT64, schema.Builtin_FLOAT32:
 				return fmt.Errorf("floating point values are not supported")
 			}
@@ -71,6 +71,10 @@ type parser struct {
 
 	// schema types -> ast.Node mappings (used for errors)
 	schemaToAST map[any]ast.Node
+
+	// the declaration and struct field whose type is being resolved (used for errors)
+	resolvingDecl  string
+	resolvingField string
 }
 
 // Config represents the configuration options for parsing.
@@ -122,6 +126,9 @@ var defaultTrackedPackages = names.TrackedPackages{
 	"context":       "context",
 	"encoding/json": "json",
 	"time":          "time",
+	"math/big":      "big",
+
+	"github.com/shopspring/decimal": "decimal",
 }
 
 func (p *parser) Parse() (res *Result, err error) {
@@ -184,6 +191,7 @@ func (p *parser) Parse() (res *Result, err error) {
 		PubSubTopics:  p.pubSubTopics,
 		CacheClusters: p.cacheClusters,
 		Decls:         p.decls,
+		Enums:         p.parseEnums(),
 		AuthHandler:   p.authHandler,
 		Middleware:    p.middleware,
 		Metrics:       p.metrics,
@@ -724,10 +732,24 @@ func (p *parser) validateApp() {
 	p.validateConfigTypes()
 }
 
+// configOnlyBuiltins are the builtin types which can only be used in config, as they have
+// no representation in the generated API clients, keyed by the Go type they're given by
+var configOnlyBuiltins = map[schema.Builtin]string{
+	schema.Builtin_NUMBER:   "json.Number",
+	schema.Builtin_DURATION: "time.Duration",
+	schema.Builtin_DECIMAL:  "decimal.Decimal",
+	schema.Builtin_RAT:      "big.Rat",
+}
+
 func (p *parser) validateTypeDoesntUseConfigTypes(pos token.Pos, param *est.Param) {
 	err := schema.Walk(p.decls, param.Type, func(n any) error {
-		if _, ok := n.(*schema.ConfigValue); ok {
+		switch n := n.(type) {
+		case *schema.ConfigValue:
 			return errors.New("config.Value")
+		case schema.Builtin:
+			if name, ok := configOnlyBuiltins[n]; ok {
+				return errors.New(name)
+			}
 		}
 		return nil
 	})
@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/fatih/structtag"
+	"google.golang.org/protobuf/proto"
 
 	"encr.dev/parser/est"
 	"encr.dev/pkg/idents"
@@ -78,7 +79,12 @@ func (p *parser) resolveType(pkg *est.Package, file *est.File, expr ast.Expr, ty
 				}
 			}
 
-			p.errf(expr.Pos(), "undefined type: %s", expr.Name)
+			if expr.Name == "error" {
+				// error is an interface, rather than a type we don't know of
+				p.errf(expr.Pos(), "%scannot use interface types in Encore schema definitions, such as error", p.resolvingFieldPrefix())
+			} else {
+				p.errf(expr.Pos(), "undefined type: %s", expr.Name)
+			}
 
 		case *ast.SelectorExpr:
 			// pkg.T
@@ -96,6 +102,10 @@ func (p *parser) resolveType(pkg *est.Package, file *est.File, expr ast.Expr, ty
 						return p.parseDecl(otherPkg, d, typeParameters)
 					}
 				} else {
+					if pkgPath == "" {
+						// The package isn't tracked, so refer to it by the name it was imported as
+						pkgPath = pkgName.Name
+					}
 					return p.parseEncoreBuiltin(expr.Pos(), pkgPath, expr.Sel.Name)
 				}
 			}
@@ -116,12 +126,32 @@ func (p *parser) resolveType(pkg *est.Package, file *est.File, expr ast.Expr, ty
 				}
 			}
 
+			// Fields promoted from embedded structs are added once all the
+			// fields declared directly in the struct are known, as those shadow them.
+			var embeds []embeddedStruct
+
 			for _, field := range expr.Fields.List {
-				typ := p.resolveType(pkg, file, field.Type, typeParameters)
-				if len(field.Names) == 0 {
-					p.err(field.Pos(), "cannot use anonymous fields in Encore struct types")
+				typ := p.resolveFieldType(pkg, file, field, typeParameters)
+				names := field.Names
+				if len(names) == 0 {
+					name := embeddedName(field.Type)
+					if name == nil {
+						p.errf(field.Pos(), "cannot embed %s in Encore struct types, only named struct types can be embedded", types.ExprString(field.Type))
+						continue
+					}
+
+					names = []*ast.Ident{name}
+				}
+				opts := p.parseStructTag(field.Tag, st, names[0].Name, typ)
+
+				// As with encoding/json, an embedded struct is only a field of its own when given a JSON name
+				if len(field.Names) == 0 && opts.JSONName == "" {
+					if fields := p.embeddedFields(st, field, typ); fields != nil {
+						inheritVariantTag(fields, opts.Tags)
+						embeds = append(embeds, embeddedStruct{index: len(st.Fields), fields: fields})
+					}
+					continue
 				}
-				opts := p.parseStructTag(field.Tag, st, field.Names[0].Name, typ)
 
 				// Validate the names to make sure we don't have any name collisions
 				switch js := opts.JSONName; true {
@@ -138,12 +168,12 @@ func (p *parser) resolveType(pkg *est.Package, file *est.File, expr ast.Expr, ty
 
 				case js == "":
 					// Check field names
-					for _, name := range field.Names {
+					for _, name := range names {
 						checkName(name.Pos(), name.Name, "field")
 					}
 				}
 
-				for _, name := range field.Names {
+				for _, name := range names {
 					// Skip unexported fields
 					if !ast.IsExported(name.Name) {
 						p.hasUnexportedFields[st] = field
@@ -174,6 +204,9 @@ func (p *parser) resolveType(pkg *est.Package, file *est.File, expr ast.Expr, ty
 					st.Fields = append(st.Fields, f)
 				}
 			}
+			if len(embeds) > 0 {
+				p.promoteEmbeddedFields(st, embeds)
+			}
 			return &schema.Type{Typ: &schema.Type_Struct{Struct: st}}
 
 		case *ast.MapType:
@@ -190,7 +223,7 @@ func (p *parser) resolveType(pkg *est.Package, file *est.File, expr ast.Expr, ty
 			return &schema.Type{Typ: &schema.Type_List{List: &schema.List{Elem: elem}}}
 
 		case *ast.InterfaceType:
-			p.err(expr.Pos(), "cannot use interface types in Encore schema definitions")
+			p.errf(expr.Pos(), "%scannot use interface types in Encore schema definitions", p.resolvingFieldPrefix())
 
 		case *ast.ChanType:
 			p.err(expr.Pos(), "cannot use channel types in Encore schema definitions")
@@ -243,6 +276,48 @@ func (p *parser) resolveType(pkg *est.Package, file *est.File, expr ast.Expr, ty
 	return typ
 }
 
+// resolveDeclType resolves the type of the declaration with the given name.
+func (p *parser) resolveDeclType(pkg *est.Package, file *est.File, name string, expr ast.Expr, typeParameters typeParameterLookup) *schema.Type {
+	prevDecl, prevField := p.resolvingDecl, p.resolvingField
+	p.resolvingDecl, p.resolvingField = name, ""
+	defer func() { p.resolvingDecl, p.resolvingField = prevDecl, prevField }()
+
+	return p.resolveType(pkg, file, expr, typeParameters)
+}
+
+// resolveFieldType resolves the type of a field within a struct.
+func (p *parser) resolveFieldType(pkg *est.Package, file *est.File, field *ast.Field, typeParameters typeParameterLookup) *schema.Type {
+	prevField := p.resolvingField
+	name := ""
+	if len(field.Names) > 0 {
+		name = field.Names[0].Name
+	} else if ident := embeddedName(field.Type); ident != nil {
+		name = ident.Name
+	}
+	if name != "" && prevField != "" {
+		// The field is within an anonymous struct, which is the type of another field
+		p.resolvingField = prevField + "." + name
+	} else if name != "" {
+		p.resolvingField = name
+	}
+	defer func() { p.resolvingField = prevField }()
+
+	return p.resolveType(pkg, file, field.Type, typeParameters)
+}
+
+// resolvingFieldPrefix returns the prefix for errors about the type of the struct field
+// being resolved, naming the field (i.e. "field Config.Timeout: "), if any.
+func (p *parser) resolvingFieldPrefix() string {
+	if p.resolvingField == "" {
+		return ""
+	}
+	name := p.resolvingField
+	if p.resolvingDecl != "" {
+		name = p.resolvingDecl + "." + name
+	}
+	return "field " + name + ": "
+}
+
 func (p *parser) parseEncoreBuiltin(pos token.Pos, pkgPath, name string) *schema.Type {
 	switch {
 	case pkgPath == uuidImportPath && name == "UUID":
@@ -251,10 +326,18 @@ func (p *parser) parseEncoreBuiltin(pos token.Pos, pkgPath, name string) *schema
 		return &schema.Type{Typ: &schema.Type_Builtin{Builtin: schema.Builtin_USER_ID}}
 	case pkgPath == "time" && name == "Time":
 		return &schema.Type{Typ: &schema.Type_Builtin{Builtin: schema.Builtin_TIME}}
+	case pkgPath == "time" && name == "Duration":
+		return &schema.Type{Typ: &schema.Type_Builtin{Builtin: schema.Builtin_DURATION}}
 	case pkgPath == "encoding/json" && name == "RawMessage":
 		return &schema.Type{Typ: &schema.Type_Builtin{Builtin: schema.Builtin_JSON}}
+	case pkgPath == "encoding/json" && name == "Number":
+		return &schema.Type{Typ: &schema.Type_Builtin{Builtin: schema.Builtin_NUMBER}}
+	case pkgPath == "github.com/shopspring/decimal" && name == "Decimal":
+		return &schema.Type{Typ: &schema.Type_Builtin{Builtin: schema.Builtin_DECIMAL}}
+	case pkgPath == "math/big" && name == "Rat":
+		return &schema.Type{Typ: &schema.Type_Builtin{Builtin: schema.Builtin_RAT}}
 	}
-	p.errf(pos, "%s.%s is not a supported type in Encore\n\tnote: you can only use types defined within your Encore app and builtins\n\tbuiltins also include time.Time, json.RawMessage, and encore.dev/types/uuid.UUID", pkgPath, name)
+	p.errf(pos, "%s%s.%s is not a supported type in Encore\n\tnote: you can only use types defined within your Encore app and builtins\n\tbuiltins also include time.Time, time.Duration, json.RawMessage, json.Number, decimal.Decimal, big.Rat, and encore.dev/types/uuid.UUID", p.resolvingFieldPrefix(), pkgPath, name)
 	p.errors.Abort()
 	return nil
 }
@@ -291,6 +374,125 @@ func schemaTags(tags []*structtag.Tag) []*schema.Tag {
 	return rtn
 }
 
+// embeddedStruct holds the fields promoted from a struct embedded in another,
+// along with the index in the outer struct's fields they're promoted at.
+type embeddedStruct struct {
+	index  int
+	fields []*schema.Field
+}
+
+// embeddedName returns the name Go gives to an embedded field of the given type,
+// or nil if the type can't be embedded in Encore struct types.
+func embeddedName(expr ast.Expr) *ast.Ident {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		return expr
+	case *ast.SelectorExpr:
+		return expr.Sel
+	default:
+		return nil
+	}
+}
+
+// embeddedFields returns copies of the fields of the struct embedded by field
+// in the struct outer.
+func (p *parser) embeddedFields(outer *schema.Struct, field *ast.Field, typ *schema.Type) []*schema.Field {
+	named := typ.GetNamed()
+	if named == nil {
+		p.errf(field.Pos(), "cannot embed %s in Encore struct types, only named struct types can be embedded", types.ExprString(field.Type))
+		return nil
+	}
+	decl := p.decls[named.Id]
+	if decl.Type == nil {
+		p.errf(field.Pos(), "cannot embed %s within itself", decl.Name)
+		return nil
+	}
+	st := decl.Type.GetStruct()
+	if st == nil {
+		p.errf(field.Pos(), "cannot embed %s in Encore struct types, only named struct types can be embedded", types.ExprString(field.Type))
+		return nil
+	}
+
+	if unexported, ok := p.hasUnexportedFields[st]; ok {
+		p.hasUnexportedFields[outer] = unexported
+	}
+	fields := make([]*schema.Field, len(st.Fields))
+	for i, f := range st.Fields {
+		fields[i] = proto.Clone(f).(*schema.Field)
+		p.schemaToAST[fields[i]] = p.schemaToAST[f]
+	}
+	return fields
+}
+
+// inheritVariantTag adds the variant tag of an embedded struct (i.e. `variant:"s3"`) to the fields promoted
+// from it which don't list variants themselves, so a struct embedded for each variant of a discriminated
+// union of config gives the fields of that variant.
+func inheritVariantTag(fields []*schema.Field, tags []*structtag.Tag) {
+	var variant *structtag.Tag
+	for _, tag := range tags {
+		if tag.Key == "variant" {
+			variant = tag
+		}
+	}
+	if variant == nil {
+		return
+	}
+
+	for _, f := range fields {
+		hasVariant := false
+		for _, tag := range f.Tags {
+			hasVariant = hasVariant || tag.Key == "variant"
+		}
+		if !hasVariant {
+			f.Tags = append(f.Tags, schemaTags([]*structtag.Tag{variant})...)
+		}
+	}
+}
+
+// promoteEmbeddedFields adds the fields promoted from embedded structs to st.
+// As with Go and encoding/json, fields declared in st shadow promoted fields
+// of the same name, while promoted fields sharing a name are ambiguous.
+func (p *parser) promoteEmbeddedFields(st *schema.Struct, embeds []embeddedStruct) {
+	declared := make(map[string]bool)
+	for _, f := range st.Fields {
+		declared[f.Name] = true
+		declared[encodedName(f)] = true
+	}
+
+	promoted := make(map[string]*schema.Field)
+	fields := make([]*schema.Field, 0, len(st.Fields))
+	next := 0
+	for _, embed := range embeds {
+		fields = append(fields, st.Fields[next:embed.index]...)
+		next = embed.index
+
+		for _, f := range embed.fields {
+			if declared[f.Name] || declared[encodedName(f)] {
+				continue
+			}
+			for _, name := range []string{f.Name, encodedName(f)} {
+				if other, ok := promoted[name]; ok {
+					pp := p.fset.Position(p.schemaToAST[other].Pos())
+					p.errf(p.schemaToAST[f].Pos(), "embedded field name %s conflicts with field promoted from another embedded struct (defined at %s)", name, pp)
+					break
+				}
+			}
+			promoted[f.Name] = f
+			promoted[encodedName(f)] = f
+			fields = append(fields, f)
+		}
+	}
+	st.Fields = append(fields, st.Fields[next:]...)
+}
+
+// encodedName returns the name a field is encoded with in JSON.
+func encodedName(f *schema.Field) string {
+	if f.JsonName != "" && f.JsonName != "-" {
+		return f.JsonName
+	}
+	return f.Name
+}
+
 // parseStructTag parses the struct tag to determine any encore-specific options
 // and the JSON name, if any.
 func (p *parser) parseStructTag(tag *ast.BasicLit, structType *schema.Struct, fieldName string, fieldType *schema.Type) structFieldOptions {
@@ -32,7 +32,7 @@ func (p *parser) parseDecl(pkg *est.Package, d *names.PkgDecl, _ typeParameterLo
 		p.declMap[key] = decl
 		p.decls = append(p.decls, decl)
 
-		decl.Type = p.resolveType(pkg, d.File, d.Spec.(*ast.TypeSpec).Type, nil)
+		decl.Type = p.resolveDeclType(pkg, d.File, d.Name, d.Spec.(*ast.TypeSpec).Type, nil)
 	}
 
 	return &schema.Type{Typ: &schema.Type_Named{
@@ -62,7 +62,7 @@ func (p *parser) parseDecl(pkg *est.Package, d *names.PkgDecl, typeParameters ty
 			}
 		}
 
-		decl.Type = p.resolveType(pkg, d.File, spec.Type, typeParameterLookup)
+		decl.Type = p.resolveDeclType(pkg, d.File, d.Name, spec.Type, typeParameterLookup)
 	}
 
 	return &schema.Type{Typ: &schema.Type_Named{
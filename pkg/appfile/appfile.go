@@ -38,6 +38,29 @@ type File struct {
 
 	// CgoEnabled enables building with cgo.
 	CgoEnabled bool `json:"cgo_enabled,omitempty"`
+
+	// Config configures the CUE files Encore generates to describe
+	// the config of each service.
+	Config *Config `json:"config,omitempty"`
+}
+
+type Config struct {
+	// DefineNamedTypes generates a CUE definition for every named type
+	// used in config, rather than only those used more than once.
+	DefineNamedTypes bool `json:"define_named_types,omitempty"`
+
+	// JSONSchema additionally generates a JSON Schema document describing
+	// the config of each service, for tools working with JSON or YAML config.
+	JSONSchema bool `json:"json_schema,omitempty"`
+
+	// SharedDefinitions generates the CUE definitions of types used by
+	// the config of more than one service into a single shared package,
+	// which the CUE files of those services import.
+	SharedDefinitions bool `json:"shared_definitions,omitempty"`
+
+	// NullablePointers allows pointer fields to be null, and makes null
+	// their default, so environments can leave them unset.
+	NullablePointers bool `json:"nullable_pointers,omitempty"`
 }
 
 type CORS struct {
@@ -0,0 +1,180 @@
+// Package configdiff compares the resolved config of the services of an app,
+// such as between two environments or two revisions of the app.
+package configdiff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"cuelang.org/go/cue/ast"
+)
+
+// Change is a value within the config of a service which differs between the two configs.
+//
+// Values are given as JSON, with From being nil for values which were added and To being
+// nil for values which were removed. Objects and lists are compared by their elements, so
+// a Change is only given for an entire object or list if it was added, removed or replaced
+// by a value of another kind.
+type Change struct {
+	Path string          `json:"path"` // the path to the value (i.e. `Database.Hosts[0]`), empty for the entire config
+	From json.RawMessage `json:"from,omitempty"`
+	To   json.RawMessage `json:"to,omitempty"`
+}
+
+// Service is the changes to the config of a single service.
+type Service struct {
+	Name    string   `json:"service"`
+	Changes []Change `json:"changes"`
+}
+
+// Diff compares the configs of each service, given as JSON keyed by the name of the service
+// as computed for the runtime. Only services whose config differs are returned, ordered by name.
+//
+// A service only present within one of the configs has all of its config added or removed.
+func Diff(from, to map[string]string) ([]Service, error) {
+	names := make([]string, 0, len(from)+len(to))
+	for name := range from {
+		names = append(names, name)
+	}
+	for name := range to {
+		if _, found := from[name]; !found {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var services []Service
+	for _, name := range names {
+		var d differ
+		fromValue, err := decode(from[name])
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %w", name, err)
+		}
+		toValue, err := decode(to[name])
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %w", name, err)
+		}
+		if err := d.diff("", fromValue, toValue); err != nil {
+			return nil, fmt.Errorf("service %s: %w", name, err)
+		}
+		if len(d.changes) > 0 {
+			services = append(services, Service{Name: name, Changes: d.changes})
+		}
+	}
+	return services, nil
+}
+
+// absent is the value of config which isn't present, such as that of a service only in one of the configs
+type absent struct{}
+
+// decode decodes the JSON of a config, without losing the precision of its numbers
+func decode(config string) (any, error) {
+	if config == "" {
+		return absent{}, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader([]byte(config)))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+type differ struct {
+	changes []Change
+}
+
+// diff records the changes between the two values at the given path
+func (d *differ) diff(path string, from, to any) error {
+	switch fromValue := from.(type) {
+	case map[string]any:
+		if toValue, ok := to.(map[string]any); ok {
+			return d.diffObjects(path, fromValue, toValue)
+		}
+	case []any:
+		if toValue, ok := to.([]any); ok {
+			return d.diffLists(path, fromValue, toValue)
+		}
+	}
+
+	fromJSON, err := encode(from)
+	if err != nil {
+		return err
+	}
+	toJSON, err := encode(to)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(fromJSON, toJSON) {
+		d.changes = append(d.changes, Change{Path: path, From: fromJSON, To: toJSON})
+	}
+	return nil
+}
+
+func (d *differ) diffObjects(path string, from, to map[string]any) error {
+	keys := make([]string, 0, len(from)+len(to))
+	for key := range from {
+		keys = append(keys, key)
+	}
+	for key := range to {
+		if _, found := from[key]; !found {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fromValue, found := from[key]
+		if !found {
+			fromValue = absent{}
+		}
+		toValue, found := to[key]
+		if !found {
+			toValue = absent{}
+		}
+		if err := d.diff(fieldPath(path, key), fromValue, toValue); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *differ) diffLists(path string, from, to []any) error {
+	for i := 0; i < len(from) || i < len(to); i++ {
+		var fromValue, toValue any = absent{}, absent{}
+		if i < len(from) {
+			fromValue = from[i]
+		}
+		if i < len(to) {
+			toValue = to[i]
+		}
+		if err := d.diff(fmt.Sprintf("%s[%d]", path, i), fromValue, toValue); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encode encodes the value as JSON, or nil if it's absent
+func encode(value any) (json.RawMessage, error) {
+	if _, isAbsent := value.(absent); isAbsent {
+		return nil, nil
+	}
+	return json.Marshal(value)
+}
+
+// fieldPath returns the path to the field of the object at path, quoting
+// the name of the field if it isn't a valid identifier, as CUE does
+func fieldPath(path string, name string) string {
+	if !ast.IsValidIdent(name) {
+		name = strconv.Quote(name)
+	}
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,40 @@
+package configdiff
+
+import (
+	"encoding/json"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestDiff(t *testing.T) {
+	c := qt.New(t)
+	from := map[string]string{
+		"email":   `{"Sender": "noreply@example.com"}`,
+		"legacy":  `{"Enabled": true}`,
+		"payment": `{"Database": {"Host": "db.staging", "Port": 5432}, "Regions": ["eu", "us"], "Rates": {"en-GB": 1.2}, "Retries": 3}`,
+	}
+	to := map[string]string{
+		"email":   `{"Sender": "noreply@example.com"}`,
+		"metrics": `{"Interval": 10}`,
+		"payment": `{"Database": {"Host": "db.prod", "Port": 5432, "SSL": true}, "Regions": ["eu"], "Rates": {"en-GB": 1.25}, "Retries": {"Max": 3}}`,
+	}
+
+	diff, err := Diff(from, to)
+	c.Assert(err, qt.IsNil)
+	c.Assert(diff, qt.DeepEquals, []Service{
+		{Name: "legacy", Changes: []Change{
+			{Path: "", From: json.RawMessage(`{"Enabled":true}`)},
+		}},
+		{Name: "metrics", Changes: []Change{
+			{Path: "", To: json.RawMessage(`{"Interval":10}`)},
+		}},
+		{Name: "payment", Changes: []Change{
+			{Path: "Database.Host", From: json.RawMessage(`"db.staging"`), To: json.RawMessage(`"db.prod"`)},
+			{Path: "Database.SSL", To: json.RawMessage(`true`)},
+			{Path: `Rates."en-GB"`, From: json.RawMessage(`1.2`), To: json.RawMessage(`1.25`)},
+			{Path: "Regions[1]", From: json.RawMessage(`"us"`)},
+			{Path: "Retries", From: json.RawMessage(`3`), To: json.RawMessage(`{"Max":3}`)},
+		}},
+	})
+}
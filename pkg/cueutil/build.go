@@ -17,6 +17,8 @@ import (
 	"cuelang.org/go/cue/load"
 	"cuelang.org/go/cue/parser"
 	"cuelang.org/go/cue/token"
+	"cuelang.org/go/encoding/json"
+	"cuelang.org/go/encoding/yaml"
 	"golang.org/x/text/encoding/unicode"
 	"golang.org/x/text/transform"
 
@@ -27,40 +29,87 @@ import (
 // LoadFromFS takes a given filesystem object and the app-relative path to the service's root package
 // and loads the full configuration needed for that service.
 func LoadFromFS(filesys fs.FS, serviceRelPath string, meta *Meta) (cue.Value, error) {
+	value, _, err := loadFromFS(filesys, serviceRelPath, meta, true)
+	return value, err
+}
+
+// ValidateFromFS validates the configuration of the service against its schema, as `cue vet` does
+// without requiring values to be concrete. Values which depend on tags meta leaves empty, such as
+// the name of the environment, are left incomplete rather than reported as missing, while values
+// which conflict with the schema are still reported. It returns the deprecated fields the config
+// files of the service set, as LoadFromFSWithDeprecations does.
+func ValidateFromFS(filesys fs.FS, serviceRelPath string, meta *Meta) ([]DeprecatedField, error) {
+	value, root, err := loadFromFS(filesys, serviceRelPath, meta, false)
+	if err != nil {
+		return nil, err
+	}
+	return findDeprecatedFields(value, root), nil
+}
+
+// LoadFromFSWithDeprecations loads the configuration of the service as LoadFromFS does, and
+// additionally returns the fields the config files of the service set which are deprecated.
+func LoadFromFSWithDeprecations(filesys fs.FS, serviceRelPath string, meta *Meta) (cue.Value, []DeprecatedField, error) {
+	value, root, err := loadFromFS(filesys, serviceRelPath, meta, true)
+	if err != nil {
+		return cue.Value{}, nil, err
+	}
+	return value, findDeprecatedFields(value, root), nil
+}
+
+// loadFromFS loads the configuration of the service, along with the path of the temporary directory it
+// was loaded from. The directory is removed once loaded, but is still referred to by the positions of the value.
+//
+// If concrete is set every value of the configuration must be concrete, otherwise only conflicts are reported.
+func loadFromFS(filesys fs.FS, serviceRelPath string, meta *Meta, concrete bool) (value cue.Value, root string, err error) {
 	// Work out of a temporary directory
 	tmpPath, err := os.MkdirTemp("", "encr-cfg-")
 	if err != nil {
-		return cue.Value{}, eerror.Wrap(err, "config", "unable to create temporary directory", nil)
+		return cue.Value{}, "", eerror.Wrap(err, "config", "unable to create temporary directory", nil)
 	}
 	defer func() { _ = os.RemoveAll(tmpPath) }()
 
 	// Write the FS to the file system
 	err = writeFSToPath(filesys, tmpPath)
 	if err != nil {
-		return cue.Value{}, err
+		return cue.Value{}, "", err
 	}
 
 	// Find all config files for the service
 	configFilesForService, err := allFilesUnder(filesys, serviceRelPath)
 	if err != nil {
-		return cue.Value{}, eerror.Wrap(err, "config", "unable to list all config files for service", map[string]any{"path": serviceRelPath})
+		return cue.Value{}, "", eerror.Wrap(err, "config", "unable to list all config files for service", map[string]any{"path": serviceRelPath})
+	}
+
+	// Inject the secrets the config files of the service are tagged with, as CUE fails to
+	// load the files if given a tag they don't use
+	tags := meta.ToTags()
+	if meta != nil && len(meta.Secrets) > 0 {
+		names, err := secretTags(filesys, configFilesForService)
+		if err != nil {
+			return cue.Value{}, "", err
+		}
+		for _, name := range names {
+			if secret, found := meta.Secrets[strings.TrimPrefix(name, SecretTagPrefix)]; found {
+				tags = append(tags, name+"="+secret)
+			}
+		}
 	}
 
 	// Tell CUE to load all the files
 	loaderCfg := &load.Config{
 		Dir:   tmpPath,
 		Tools: true,
-		Tags:  meta.ToTags(),
+		Tags:  tags,
 	}
 	pkgs := load.Instances(configFilesForService, loaderCfg)
 	for _, pkg := range pkgs {
 		if pkg.Err != nil {
-			return cue.Value{}, srcerrors.UnableToLoadCUEInstances(pkg.Err, tmpPath)
+			return cue.Value{}, "", srcerrors.UnableToLoadCUEInstances(pkg.Err, tmpPath)
 		}
 
 		// Non CUE files may be orphaned (JSON/YAML), so need to be parsed into the CUE AST and added to the package.
 		if err := addOrphanedFiles(pkg); err != nil {
-			return cue.Value{}, srcerrors.UnableToAddOrphanedCUEFiles(err, tmpPath)
+			return cue.Value{}, "", srcerrors.UnableToAddOrphanedCUEFiles(err, tmpPath)
 		}
 	}
 
@@ -68,10 +117,10 @@ func LoadFromFS(filesys fs.FS, serviceRelPath string, meta *Meta) (cue.Value, er
 	ctx := cuecontext.New()
 	values, err := ctx.BuildInstances(pkgs)
 	if err != nil {
-		return cue.Value{}, srcerrors.UnableToLoadCUEInstances(err, tmpPath)
+		return cue.Value{}, "", srcerrors.UnableToLoadCUEInstances(err, tmpPath)
 	}
 	if len(values) == 0 {
-		return cue.Value{}, eerror.New("config", "no values generated from config", nil)
+		return cue.Value{}, "", eerror.New("config", "no values generated from config", nil)
 	}
 
 	// Unify all returned values into a single value
@@ -82,12 +131,70 @@ func LoadFromFS(filesys fs.FS, serviceRelPath string, meta *Meta) (cue.Value, er
 		rtnValue = rtnValue.Unify(value)
 	}
 
-	// Validate the unified value is concrete
-	if err := rtnValue.Validate(cue.Concrete(true)); err != nil {
-		return cue.Value{}, srcerrors.CUEEvaluationFailed(err, tmpPath)
+	// Validate the unified value, which must be concrete to be given to the service
+	if err := rtnValue.Validate(cue.Concrete(concrete)); err != nil {
+		return cue.Value{}, "", srcerrors.CUEEvaluationFailed(err, tmpPath)
+	}
+	if meta != nil && len(meta.Env) > 0 {
+		if err := checkEnvFields(rtnValue, meta.Env); err != nil {
+			return cue.Value{}, "", err
+		}
 	}
 
-	return rtnValue, nil
+	return rtnValue, tmpPath, nil
+}
+
+// secretTags returns the names of the tags through which secrets are injected into the given CUE files
+func secretTags(filesys fs.FS, paths []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var names []string
+	for _, path := range paths {
+		if filepath.Ext(path) != ".cue" {
+			continue
+		}
+		data, err := fs.ReadFile(filesys, path)
+		if err != nil {
+			return nil, eerror.Wrap(err, "config", "unable to read config file", map[string]any{"path": path})
+		}
+		file, err := parser.ParseFile(path, data)
+		if err != nil {
+			// The error is reported when the file is loaded
+			continue
+		}
+
+		ast.Walk(file, func(node ast.Node) bool {
+			attr, ok := node.(*ast.Attribute)
+			if !ok {
+				return true
+			}
+			if key, body := attr.Split(); key == "tag" {
+				name, _, _ := strings.Cut(body, ",")
+				name = strings.TrimSpace(name)
+				if strings.HasPrefix(name, SecretTagPrefix) && !seen[name] {
+					seen[name] = true
+					names = append(names, name)
+				}
+			}
+			return false
+		}, nil)
+	}
+	return names, nil
+}
+
+// IsConfigDataFile reports whether the file at path gives config as YAML or JSON, rather than CUE.
+//
+// Such files are unified with the CUE files of the service they're within, so are validated
+// against the generated config schema. To not mistake other YAML and JSON files for config,
+// they must be named config (i.e. `config.yaml`) or end with .config (i.e. `prod.config.json`).
+func IsConfigDataFile(path string) bool {
+	ext := filepath.Ext(path)
+	switch ext {
+	case ".json", ".yaml", ".yml":
+	default:
+		return false
+	}
+	name := strings.TrimSuffix(filepath.Base(path), ext)
+	return name == "config" || strings.HasSuffix(name, ".config")
 }
 
 // allFilesUnder returns all files under the given path in the given filesystem.
@@ -173,6 +280,20 @@ func addOrphanedFiles(i *build.Instance) (err error) {
 			if err != nil {
 				return err
 			}
+		case build.JSON:
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			file, err = json.Extract(f.Filename, data)
+			if err != nil {
+				return err
+			}
+		case build.YAML:
+			file, err = yaml.Extract(f.Filename, r)
+			if err != nil {
+				return err
+			}
 		default:
 			return errors.New(fmt.Sprintf("unsupported encoding: %s", f.Encoding))
 		}
@@ -0,0 +1,240 @@
+package cueutil
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"cuelang.org/go/cue"
+	qt "github.com/frankban/quicktest"
+)
+
+func TestLoadFromFS_DataFiles(t *testing.T) {
+	c := qt.New(t)
+	schema := &fstest.MapFile{Data: []byte(`package svc
+
+#Config: {
+	Name:    string
+	Port:    int & >0
+	Regions: [...string]
+}
+#Config
+`)}
+
+	// Config can be given as YAML or JSON alongside the CUE files of the service
+	filesys := fstest.MapFS{
+		"svc/encore.gen.cue":   schema,
+		"svc/config.yaml":      {Data: []byte("Name: app\nRegions:\n  - eu\n  - us\n")},
+		"svc/port.config.json": {Data: []byte(`{"Port": 8080}`)},
+	}
+	value, err := LoadFromFS(filesys, "svc", nil)
+	c.Assert(err, qt.IsNil)
+	port, err := value.LookupPath(cue.ParsePath("Port")).Int64()
+	c.Assert(err, qt.IsNil)
+	c.Assert(port, qt.Equals, int64(8080))
+	regions, err := value.LookupPath(cue.ParsePath("Regions")).List()
+	c.Assert(err, qt.IsNil)
+	c.Assert(regions.Next(), qt.IsTrue)
+
+	// The values are validated against the schema
+	filesys["svc/port.config.json"] = &fstest.MapFile{Data: []byte(`{"Port": -1}`)}
+	_, err = LoadFromFS(filesys, "svc", nil)
+	c.Assert(err, qt.ErrorMatches, `(?s).*Port.*`)
+}
+
+func TestIsConfigDataFile(t *testing.T) {
+	c := qt.New(t)
+	for path, want := range map[string]bool{
+		"svc/config.yaml":           true,
+		"svc/config.yml":            true,
+		"svc/config.json":           true,
+		"svc/prod.config.yaml":      true,
+		"svc/config.cue":            false,
+		"svc/tsconfig.json":         false,
+		"svc/testdata/fixture.json": false,
+		"svc/config.yaml.bak":       false,
+	} {
+		c.Check(IsConfigDataFile(path), qt.Equals, want, qt.Commentf("path %s", path))
+	}
+}
+
+func TestLoadFromFSWithDeprecations(t *testing.T) {
+	c := qt.New(t)
+	filesys := fstest.MapFS{
+		"svc/encore.gen.cue": {Data: []byte(`package svc
+
+#Config: {
+	Addr:           string @deprecated("use ListenAddress instead.")
+	ListenAddress?: string
+	if ListenAddress != _|_ {
+		Addr: ListenAddress
+	}
+
+	Count?:    int @deprecated("use Replicas instead.")
+	Replicas?: int
+	if Replicas != _|_ {
+		Count: Replicas
+	}
+}
+#Config
+`)},
+		// Count is set from its replacement by the generated file, so isn't reported
+		"svc/config.cue":  {Data: []byte("package svc\n\nReplicas: 3\n")},
+		"svc/config.yaml": {Data: []byte("Addr: localhost:8080\n")},
+	}
+	_, deprecated, err := LoadFromFSWithDeprecations(filesys, "svc", nil)
+	c.Assert(err, qt.IsNil)
+	c.Assert(deprecated, qt.DeepEquals, []DeprecatedField{{
+		Path:   "Addr",
+		Notice: "use ListenAddress instead.",
+		File:   "svc/config.yaml",
+		Line:   1,
+	}})
+	c.Assert(deprecated[0].String(), qt.Equals, "svc/config.yaml:1: Addr is deprecated: use ListenAddress instead.")
+}
+
+func TestValidateFromFS_NamedEnvironments(t *testing.T) {
+	c := qt.New(t)
+	filesys := fstest.MapFS{
+		"svc/encore.gen.cue": {Data: []byte(`package svc
+
+#Meta: {
+	Environment: {
+		Name:  string                                              @tag(EnvName)
+		Type:  "production" | "development" | "ephemeral" | "test" @tag(EnvType)
+		Cloud: "aws" | "azure" | "gcp" | "encore" | "local"        @tag(CloudType)
+	}
+}
+
+#Config: {
+	Host: string
+	Port: int & >0
+}
+#Config
+`)},
+		// Production config is keyed by the name of the environment
+		"svc/config.cue": {Data: []byte(`package svc
+
+Port: 5432
+if #Meta.Environment.Name == "prod" {
+	Host: "db.prod"
+}
+if #Meta.Environment.Name == "staging" {
+	Host: "db.staging"
+}
+`)},
+	}
+	unnamed := &Meta{EnvType: EnvType_Production, CloudType: CloudType_Encore}
+
+	// Without the name of the environment the config is incomplete, which only fails when it must be concrete
+	_, err := LoadFromFS(filesys, "svc", unnamed)
+	c.Assert(err, qt.IsNotNil)
+	_, err = ValidateFromFS(filesys, "svc", unnamed)
+	c.Assert(err, qt.IsNil)
+
+	value, err := LoadFromFS(filesys, "svc", &Meta{EnvName: "prod", EnvType: EnvType_Production, CloudType: CloudType_Encore})
+	c.Assert(err, qt.IsNil)
+	host, err := value.LookupPath(cue.ParsePath("Host")).String()
+	c.Assert(err, qt.IsNil)
+	c.Assert(host, qt.Equals, "db.prod")
+
+	// Values which conflict with the schema are still reported
+	filesys["svc/port.cue"] = &fstest.MapFile{Data: []byte("package svc\n\nPort: \"5432\"\n")}
+	_, err = ValidateFromFS(filesys, "svc", unnamed)
+	c.Assert(err, qt.ErrorMatches, `(?s).*Port.*`)
+}
+
+func TestLoadFromFS_Secrets(t *testing.T) {
+	c := qt.New(t)
+	filesys := fstest.MapFS{
+		"svc/encore.gen.cue": {Data: []byte(`package svc
+
+#Config: {
+	APIKey: string @tag(SECRET_API_KEY,type=string) @secret()
+	Primary: {
+		Password: string @tag(SECRET_PRIMARY_PASSWORD,type=string) @secret()
+	}
+	Replica: {
+		Password: string @tag(SECRET_REPLICA_PASSWORD,type=string) @secret()
+		Port:     int    @tag(SECRET_REPLICA_PORT,type=int) @secret()
+	}
+}
+#Config
+`)},
+	}
+	meta := &Meta{Secrets: map[string]string{
+		"API_KEY":          "key",
+		"PRIMARY_PASSWORD": "hunter2",
+		"REPLICA_PASSWORD": "hunter3",
+		"REPLICA_PORT":     "5432",
+		"UNUSED":           "not injected",
+	}}
+
+	// Secrets are injected into the fields tagged with their names
+	value, err := LoadFromFS(filesys, "svc", meta)
+	c.Assert(err, qt.IsNil)
+	for path, want := range map[string]string{
+		"APIKey":           "key",
+		"Primary.Password": "hunter2",
+		"Replica.Password": "hunter3",
+	} {
+		got, err := value.LookupPath(cue.ParsePath(path)).String()
+		c.Assert(err, qt.IsNil, qt.Commentf("path %s", path))
+		c.Check(got, qt.Equals, want, qt.Commentf("path %s", path))
+	}
+	port, err := value.LookupPath(cue.ParsePath("Replica.Port")).Int64()
+	c.Assert(err, qt.IsNil)
+	c.Assert(port, qt.Equals, int64(5432))
+
+	// Fields whose secrets aren't given must be set by the config files
+	delete(meta.Secrets, "REPLICA_PASSWORD")
+	_, err = LoadFromFS(filesys, "svc", meta)
+	c.Assert(err, qt.ErrorMatches, `(?s).*Password.*`)
+}
+
+func TestLoadFromFS_Env(t *testing.T) {
+	c := qt.New(t)
+	filesys := fstest.MapFS{
+		"svc/encore.gen.cue": {Data: []byte(`package svc
+
+import "time"
+
+#Config: {
+	Workers?: int & >=1 & <=16 @env(WORKERS)
+	Timeout?: string & time.Duration @env(TIMEOUT)
+	Mode?:    "fast" | "safe" @env(MODE)
+	Database: {
+		Host?: string & =~"^[a-z.]+$" @env(DATABASE_HOST)
+	}
+}
+#Config
+`)},
+		"svc/config.cue": {Data: []byte("package svc\n\nWorkers: 4\nMode: \"safe\"\n")},
+	}
+
+	// Variables which satisfy the constraints of their fields are accepted,
+	// even when they differ from the value in the config files they override
+	meta := &Meta{Env: map[string]string{
+		"WORKERS":       "8",
+		"TIMEOUT":       "5s",
+		"MODE":          "fast",
+		"DATABASE_HOST": "db.internal",
+		"UNRELATED":     "not a field",
+	}}
+	value, err := LoadFromFS(filesys, "svc", meta)
+	c.Assert(err, qt.IsNil)
+	workers, err := value.LookupPath(cue.ParsePath("Workers")).Int64()
+	c.Assert(err, qt.IsNil)
+	c.Assert(workers, qt.Equals, int64(4))
+
+	// Variables which don't satisfy them are reported
+	for name, raw := range map[string]string{
+		"WORKERS":       "32",
+		"TIMEOUT":       "soon",
+		"MODE":          "slow",
+		"DATABASE_HOST": "DB",
+	} {
+		invalid := &Meta{Env: map[string]string{name: raw}}
+		_, err := LoadFromFS(filesys, "svc", invalid)
+		c.Check(err, qt.ErrorMatches, `(?s).*environment variable `+name+` is not a valid value.*`, qt.Commentf("%s=%s", name, raw))
+	}
+}
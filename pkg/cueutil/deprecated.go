@@ -0,0 +1,91 @@
+package cueutil
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/token"
+)
+
+// generatedFile is the name of the CUE files Encore generates, which may
+// set deprecated fields on behalf of the user (i.e. from their aliases)
+const generatedFile = "encore.gen.cue"
+
+// DeprecatedField is a field marked as deprecated by a `@deprecated(...)` attribute
+// in the generated config, which the config files of a service still set.
+type DeprecatedField struct {
+	Path   string // the path to the field within the config (i.e. `Database.Addr`)
+	Notice string // the deprecation notice, such as the field to use instead
+	File   string // the file setting the field, relative to the root of the config files
+	Line   int    // the line of the file the field is set on
+}
+
+func (f DeprecatedField) String() string {
+	msg := fmt.Sprintf("%s:%d: %s is deprecated", f.File, f.Line, f.Path)
+	if f.Notice != "" {
+		msg += ": " + f.Notice
+	}
+	return msg
+}
+
+// findDeprecatedFields returns the deprecated fields within the value which are set by
+// files other than those Encore generates, with the files given relative to root.
+func findDeprecatedFields(value cue.Value, root string) []DeprecatedField {
+	var fields []DeprecatedField
+	var walk func(v cue.Value)
+	walk = func(v cue.Value) {
+		switch v.IncompleteKind() {
+		case cue.StructKind:
+			iter, err := v.Fields()
+			if err != nil {
+				return
+			}
+			for iter.Next() {
+				field := iter.Value()
+				if attr := field.Attribute("deprecated"); attr.Err() == nil {
+					if pos, found := userPos(field); found {
+						notice, _ := attr.String(0)
+						file, err := filepath.Rel(root, pos.Filename())
+						if err != nil {
+							file = pos.Filename()
+						}
+						fields = append(fields, DeprecatedField{
+							Path:   field.Path().String(),
+							Notice: notice,
+							File:   filepath.ToSlash(file),
+							Line:   pos.Line(),
+						})
+					}
+				}
+				walk(field)
+			}
+		case cue.ListKind:
+			iter, err := v.List()
+			if err != nil {
+				return
+			}
+			for iter.Next() {
+				walk(iter.Value())
+			}
+		}
+	}
+	walk(value)
+	return fields
+}
+
+// userPos returns the position of the first of the values unified into v which
+// is given outside the files Encore generates, if there is one
+func userPos(v cue.Value) (token.Pos, bool) {
+	op, args := v.Expr()
+	if op != cue.AndOp {
+		pos := v.Pos()
+		return pos, pos.IsValid() && filepath.Base(pos.Filename()) != generatedFile
+	}
+	for _, arg := range args {
+		if pos, found := userPos(arg); found {
+			return pos, true
+		}
+	}
+	return token.NoPos, false
+}
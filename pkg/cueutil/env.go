@@ -0,0 +1,78 @@
+package cueutil
+
+import (
+	"fmt"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/encoding/json"
+
+	"encr.dev/pkg/eerror"
+)
+
+// checkEnvFields checks the values of the environment variables which fields of the config are read
+// from (i.e. `@env(DATABASE_URL)`) against the constraints the schema places on those fields.
+//
+// The runtime overrides the computed config with the variables when the config is loaded, so
+// without this the values would never be checked against the schema. As the variables replace
+// any value given in the config files, they are checked against the generated `#Config` definition
+// rather than the unified config.
+func checkEnvFields(value cue.Value, env map[string]string) error {
+	def := value.LookupPath(cue.ParsePath("#Config"))
+	if !def.Exists() {
+		return nil
+	}
+
+	var check func(v cue.Value, path []string) error
+	check = func(v cue.Value, path []string) error {
+		if v.IncompleteKind() != cue.StructKind {
+			return nil
+		}
+		iter, err := v.Fields(cue.Optional(true))
+		if err != nil {
+			return nil
+		}
+		for iter.Next() {
+			field := iter.Value()
+			fieldPath := append(path[:len(path):len(path)], iter.Selector().String())
+
+			attr := field.Attribute("env")
+			if attr.Err() != nil {
+				if err := check(field, fieldPath); err != nil {
+					return err
+				}
+				continue
+			}
+			name, _ := attr.String(0)
+			raw, found := env[name]
+			if !found {
+				continue
+			}
+
+			// Strings and durations are read from the variable as is, while other values
+			// are decoded from JSON, as the runtime reads them
+			var envValue cue.Value
+			if field.IncompleteKind()&cue.StringKind != 0 {
+				envValue = v.Context().Encode(raw)
+			} else if expr, err := json.Extract(name, []byte(raw)); err != nil {
+				return envFieldError(name, fieldPath, err)
+			} else {
+				envValue = v.Context().BuildExpr(expr)
+			}
+			if err := field.Unify(envValue).Validate(cue.Concrete(true)); err != nil {
+				return envFieldError(name, fieldPath, err)
+			}
+		}
+		return nil
+	}
+	return check(def, nil)
+}
+
+// envFieldError reports the value of the environment variable name doesn't satisfy the field at path
+func envFieldError(name string, path []string, err error) error {
+	return eerror.New(
+		"config",
+		fmt.Sprintf("the environment variable %s is not a valid value for %s: %v", name, strings.Join(path, "."), err),
+		map[string]any{"env": name},
+	)
+}
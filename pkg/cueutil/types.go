@@ -24,21 +24,39 @@ type Meta struct {
 	EnvName    string
 	EnvType    EnvType
 	CloudType  CloudType
+
+	// Secrets are the values of the app's secrets by name, which are injected into the fields
+	// of the config tagged with the name of the secret (i.e. `@tag(SECRET_DATABASE_PASSWORD)`
+	// for the secret DATABASE_PASSWORD), so the values are never stored in config files.
+	Secrets map[string]string
+
+	// Env are the environment variables the app is run with. Fields read from an environment
+	// variable (i.e. `@env(DATABASE_URL)`) are overridden with its value by the runtime, so the
+	// values of the variables which are set are checked against the constraints of their fields.
+	Env map[string]string
 }
 
+// SecretTagPrefix starts the names of the tags through which secrets are injected into config
+const SecretTagPrefix = "SECRET_"
+
 func (m *Meta) ToTags() []string {
 	if m == nil {
 		return nil
 	}
 
-	return []string{
-		tag("APIBaseURL", m.APIBaseURL),
-		tag("EnvName", m.EnvName),
-		tag("EnvType", m.EnvType),
-		tag("CloudType", m.CloudType),
-	}
+	var tags []string
+	tags = appendTag(tags, "APIBaseURL", m.APIBaseURL)
+	tags = appendTag(tags, "EnvName", m.EnvName)
+	tags = appendTag(tags, "EnvType", m.EnvType)
+	tags = appendTag(tags, "CloudType", m.CloudType)
+	return tags
 }
 
-func tag[T ~string](name string, value T) string {
-	return name + "=" + string(value)
+// appendTag appends the tag with the given value to tags. Empty values are left out,
+// so the field holding the tag is left incomplete rather than set to an empty string.
+func appendTag[T ~string](tags []string, name string, value T) []string {
+	if value == "" {
+		return tags
+	}
+	return append(tags, name+"="+string(value))
 }
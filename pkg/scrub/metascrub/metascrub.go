@@ -223,6 +223,10 @@ func (p *typeParser) typ(typ *schema.Type) declResult {
 		}
 		return out
 
+	case *schema.Type_Config:
+		// Config wrappers are represented by the value they wrap
+		return p.typ(t.Config.Elem)
+
 	case *schema.Type_Builtin:
 		// Nothing to do
 		return declResult{}
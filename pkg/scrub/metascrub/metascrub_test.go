@@ -13,6 +13,7 @@ import (
 	"encr.dev/parser"
 	"encr.dev/pkg/scrub"
 	meta "encr.dev/proto/encore/parser/meta/v1"
+	schema "encr.dev/proto/encore/parser/schema/v1"
 )
 
 func TestScrub(t *testing.T) {
@@ -154,6 +155,57 @@ func Foo(ctx context.Context, p *Params) error { return nil }
 	c.Assert(res.Headers, qt.DeepEquals, []string{"Foo"})
 }
 
+func TestScrubConfig(t *testing.T) {
+	c := qt.New(t)
+	md := testParse(c, `
+-- svc/svc.go --
+package svc
+import (
+	"context"
+
+	"encore.dev/config"
+)
+
+type Config struct {
+	Password config.String SCRUB
+	Database config.Value[Database]
+	Replicas config.Values[Database]
+	Name     config.String
+}
+
+type Database struct {
+	Host     string
+	Password string SCRUB
+}
+
+var _ = config.Load[*Config]()
+
+//encore:api public
+func Foo(ctx context.Context) error { return nil }
+`)
+
+	var cfg *schema.Decl
+	for _, decl := range md.Decls {
+		if decl.Name == "Config" {
+			cfg = decl
+		}
+	}
+	c.Assert(cfg, qt.IsNotNil)
+
+	cmp := New(md, zerolog.New(os.Stdout))
+	res := cmp.Compute(cfg.Type, 0)
+
+	f := func(name string) scrub.PathEntry {
+		return scrub.PathEntry{Kind: scrub.ObjectField, FieldName: strconv.Quote(name)}
+	}
+
+	c.Assert(res.Payload, qt.DeepEquals, []scrub.Path{
+		{f("Password")},
+		{f("Database"), f("Password")},
+		{f("Replicas"), f("Password")},
+	})
+}
+
 func testParse(c *qt.C, code string) *meta.Data {
 	code = strings.Replace(code, "SCRUB", "`encore:\"sensitive\"`", -1)
 	ar := txtar.Parse([]byte(code))
@@ -41,12 +41,16 @@ const (
 	Builtin_STRING  Builtin = 12
 	Builtin_BYTES   Builtin = 13
 	// Additional Encore Types
-	Builtin_TIME    Builtin = 14
-	Builtin_UUID    Builtin = 15
-	Builtin_JSON    Builtin = 16
-	Builtin_USER_ID Builtin = 17
-	Builtin_INT     Builtin = 18
-	Builtin_UINT    Builtin = 19
+	Builtin_TIME     Builtin = 14
+	Builtin_UUID     Builtin = 15
+	Builtin_JSON     Builtin = 16
+	Builtin_USER_ID  Builtin = 17
+	Builtin_INT      Builtin = 18
+	Builtin_UINT     Builtin = 19
+	Builtin_NUMBER   Builtin = 20 // encoding/json.Number
+	Builtin_DURATION Builtin = 21 // time.Duration
+	Builtin_DECIMAL  Builtin = 22 // github.com/shopspring/decimal.Decimal
+	Builtin_RAT      Builtin = 23 // math/big.Rat
 )
 
 // Enum value maps for Builtin.
@@ -72,28 +76,36 @@ var (
 		17: "USER_ID",
 		18: "INT",
 		19: "UINT",
+		20: "NUMBER",
+		21: "DURATION",
+		22: "DECIMAL",
+		23: "RAT",
 	}
 	Builtin_value = map[string]int32{
-		"ANY":     0,
-		"BOOL":    1,
-		"INT8":    2,
-		"INT16":   3,
-		"INT32":   4,
-		"INT64":   5,
-		"UINT8":   6,
-		"UINT16":  7,
-		"UINT32":  8,
-		"UINT64":  9,
-		"FLOAT32": 10,
-		"FLOAT64": 11,
-		"STRING":  12,
-		"BYTES":   13,
-		"TIME":    14,
-		"UUID":    15,
-		"JSON":    16,
-		"USER_ID": 17,
-		"INT":     18,
-		"UINT":    19,
+		"ANY":      0,
+		"BOOL":     1,
+		"INT8":     2,
+		"INT16":    3,
+		"INT32":    4,
+		"INT64":    5,
+		"UINT8":    6,
+		"UINT16":   7,
+		"UINT32":   8,
+		"UINT64":   9,
+		"FLOAT32":  10,
+		"FLOAT64":  11,
+		"STRING":   12,
+		"BYTES":    13,
+		"TIME":     14,
+		"UUID":     15,
+		"JSON":     16,
+		"USER_ID":  17,
+		"INT":      18,
+		"UINT":     19,
+		"NUMBER":   20,
+		"DURATION": 21,
+		"DECIMAL":  22,
+		"RAT":      23,
 	}
 )
 
@@ -1234,7 +1246,7 @@ var file_encore_parser_schema_v1_schema_proto_rawDesc = []byte{
 	0x6d, 0x61, 0x2e, 0x76, 0x31, 0x2e, 0x54, 0x79, 0x70, 0x65, 0x52, 0x04, 0x65, 0x6c, 0x65, 0x6d,
 	0x12, 0x22, 0x0a, 0x0c, 0x49, 0x73, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x73, 0x4c, 0x69, 0x73, 0x74,
 	0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0c, 0x49, 0x73, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x73,
-	0x4c, 0x69, 0x73, 0x74, 0x2a, 0xe5, 0x01, 0x0a, 0x07, 0x42, 0x75, 0x69, 0x6c, 0x74, 0x69, 0x6e,
+	0x4c, 0x69, 0x73, 0x74, 0x2a, 0x95, 0x02, 0x0a, 0x07, 0x42, 0x75, 0x69, 0x6c, 0x74, 0x69, 0x6e,
 	0x12, 0x07, 0x0a, 0x03, 0x41, 0x4e, 0x59, 0x10, 0x00, 0x12, 0x08, 0x0a, 0x04, 0x42, 0x4f, 0x4f,
 	0x4c, 0x10, 0x01, 0x12, 0x08, 0x0a, 0x04, 0x49, 0x4e, 0x54, 0x38, 0x10, 0x02, 0x12, 0x09, 0x0a,
 	0x05, 0x49, 0x4e, 0x54, 0x31, 0x36, 0x10, 0x03, 0x12, 0x09, 0x0a, 0x05, 0x49, 0x4e, 0x54, 0x33,
@@ -1248,7 +1260,10 @@ var file_encore_parser_schema_v1_schema_proto_rawDesc = []byte{
 	0x0a, 0x04, 0x54, 0x49, 0x4d, 0x45, 0x10, 0x0e, 0x12, 0x08, 0x0a, 0x04, 0x55, 0x55, 0x49, 0x44,
 	0x10, 0x0f, 0x12, 0x08, 0x0a, 0x04, 0x4a, 0x53, 0x4f, 0x4e, 0x10, 0x10, 0x12, 0x0b, 0x0a, 0x07,
 	0x55, 0x53, 0x45, 0x52, 0x5f, 0x49, 0x44, 0x10, 0x11, 0x12, 0x07, 0x0a, 0x03, 0x49, 0x4e, 0x54,
-	0x10, 0x12, 0x12, 0x08, 0x0a, 0x04, 0x55, 0x49, 0x4e, 0x54, 0x10, 0x13, 0x42, 0x28, 0x5a, 0x26,
+	0x10, 0x12, 0x12, 0x08, 0x0a, 0x04, 0x55, 0x49, 0x4e, 0x54, 0x10, 0x13, 0x12, 0x0a, 0x0a, 0x06,
+	0x4e, 0x55, 0x4d, 0x42, 0x45, 0x52, 0x10, 0x14, 0x12, 0x0c, 0x0a, 0x08, 0x44, 0x55, 0x52, 0x41,
+	0x54, 0x49, 0x4f, 0x4e, 0x10, 0x15, 0x12, 0x0b, 0x0a, 0x07, 0x44, 0x45, 0x43, 0x49, 0x4d, 0x41,
+	0x4c, 0x10, 0x16, 0x12, 0x07, 0x0a, 0x03, 0x52, 0x41, 0x54, 0x10, 0x17, 0x42, 0x28, 0x5a, 0x26,
 	0x65, 0x6e, 0x63, 0x72, 0x2e, 0x64, 0x65, 0x76, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x65,
 	0x6e, 0x63, 0x6f, 0x72, 0x65, 0x2f, 0x70, 0x61, 0x72, 0x73, 0x65, 0x72, 0x2f, 0x73, 0x63, 0x68,
 	0x65, 0x6d, 0x61, 0x2f, 0x76, 0x31, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
@@ -28,6 +28,10 @@ export enum Builtin {
   USER_ID = "USER_ID",
   INT = "INT",
   UINT = "UINT",
+  NUMBER = "NUMBER",
+  DURATION = "DURATION",
+  DECIMAL = "DECIMAL",
+  RAT = "RAT",
   UNRECOGNIZED = "UNRECOGNIZED",
 }
 
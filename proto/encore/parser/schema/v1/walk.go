@@ -1,13 +1,18 @@
 package v1
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
 )
 
+// SkipChildren is returned by the visitor of Walk to skip the nodes within the visited node,
+// continuing the walk with the node's siblings.
+var SkipChildren = errors.New("skip children")
+
 // Walk will perform a depth first walk of all schema nodes starting at node, calling visitor for each schema type found.
 //
-// If visitor returns false, the walk will be aborted.
+// If visitor returns an error, the walk will be aborted, unless it is SkipChildren.
 func Walk(decls []*Decl, node any, visitor func(node any) error) error {
 	namedChain := make([]uint32, 0, 10)
 	return walk(decls, node, visitor, namedChain)
@@ -15,7 +20,9 @@ func Walk(decls []*Decl, node any, visitor func(node any) error) error {
 
 func walk(decls []*Decl, node any, visitor func(node any) error, namedChain []uint32) error {
 	// Check the visitor against the node type
-	if err := visitor(node); err != nil {
+	if err := visitor(node); err == SkipChildren {
+		return nil
+	} else if err != nil {
 		return err
 	}
 
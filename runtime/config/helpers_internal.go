@@ -2,9 +2,15 @@ package config
 
 import (
 	"fmt"
+	"os"
+	"reflect"
+	"regexp"
 	"strings"
+	"time"
 
 	jsoniter "github.com/json-iterator/go"
+
+	"encore.dev/types/uuid"
 )
 
 type Unmarshaler[T any] func(itr *jsoniter.Iterator, path []string) T
@@ -78,6 +84,58 @@ func GetMetaForValue[T any](value func() T) (ValueID, ValuePath) {
 	return Singleton.extraction.ExtractedID, Singleton.extraction.ExtractedPath
 }
 
+// ReadEnv is a helper function that generated code can use to override the value of a config field
+// with the value of the environment variable name, if it is set. Strings and durations are read from
+// the variable as is, while other types are decoded from JSON (i.e. `true` or `8080`).
+func ReadEnv[T any](name string, pathToValue ValuePath, value *T) {
+	raw, found := os.LookupEnv(name)
+	if !found {
+		return
+	}
+
+	var err error
+	if duration, ok := any(value).(*time.Duration); ok {
+		*duration, err = time.ParseDuration(raw)
+	} else if rv := reflect.ValueOf(value).Elem(); rv.Kind() == reflect.String {
+		rv.SetString(raw)
+	} else {
+		err = jsoniter.ConfigCompatibleWithStandardLibrary.UnmarshalFromString(raw, value)
+	}
+	if err != nil {
+		panic(fmt.Sprintf("unable to read config field %s from the environment variable %s: %v", strings.Join(pathToValue, "."), name, err))
+	}
+}
+
+// ReadTime is a helper function that generated code can use to read a time from the JSON iterator
+// which is written in config using the given layout, as set by the `timeformat` tag of its field
+func ReadTime(itr *jsoniter.Iterator, layout string) time.Time {
+	value := itr.ReadString()
+	t, err := time.Parse(layout, value)
+	if err != nil {
+		panic(fmt.Sprintf("unable to decode the config: %v", err))
+	}
+	return t
+}
+
+// uuidPattern matches UUIDs in their canonical form, and must be kept in sync with the
+// pattern the compiler constrains UUID config fields to in the generated CUE
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// ReadUUID is a helper function that generated code can use to read a UUID from the JSON iterator.
+// Only the canonical form is accepted (i.e. "6ba7b810-9dad-11d1-80b4-00c04fd430c8"), rather than
+// all the forms uuid.FromString accepts, so the runtime accepts exactly what the config schema does.
+func ReadUUID(itr *jsoniter.Iterator) uuid.UUID {
+	value := itr.ReadString()
+	if !uuidPattern.MatchString(value) {
+		panic(fmt.Sprintf("unable to decode the config: invalid UUID: %q", value))
+	}
+	u, err := uuid.FromString(value)
+	if err != nil {
+		panic(fmt.Sprintf("unable to decode the config: %v", err))
+	}
+	return u
+}
+
 // ReadArray is a helper function that generated code can use to read an array from the JSON iterator
 func ReadArray[T any](itr *jsoniter.Iterator, cb func(itr *jsoniter.Iterator, idx int) T) []T {
 	rtn := make([]T, 0)
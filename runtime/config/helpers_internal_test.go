@@ -0,0 +1,87 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+
+	"encore.dev/types/uuid"
+)
+
+func TestReadTime(t *testing.T) {
+	launch := time.Date(2023, time.April, 1, 0, 0, 0, 0, time.UTC)
+	cutoff := time.Date(0, time.January, 1, 17, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		layout string
+		want   time.Time
+	}{
+		{"2006-01-02", launch},
+		{"15:04", cutoff},
+		{"02 Jan 06 15:04 MST", time.Date(2023, time.April, 1, 9, 15, 0, 0, time.UTC)},
+		{time.RFC3339, time.Date(2023, time.April, 1, 9, 15, 30, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		// Times are written in the computed config using the layout of their field
+		cfg, err := jsoniter.MarshalToString(map[string]string{"Time": test.want.Format(test.layout)})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got time.Time
+		itr := jsoniter.ParseString(jsoniter.ConfigDefault, cfg)
+		itr.ReadObjectCB(func(itr *jsoniter.Iterator, field string) bool {
+			got = ReadTime(itr, test.layout)
+			return true
+		})
+		if itr.Error != nil {
+			t.Fatalf("layout %q: %v", test.layout, itr.Error)
+		}
+		if !got.Equal(test.want) {
+			t.Errorf("layout %q: got %v, want %v", test.layout, got, test.want)
+		}
+	}
+}
+
+func TestReadTime_InvalidLayout(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("expected a panic for a time not in the layout")
+		}
+	}()
+
+	itr := jsoniter.ParseString(jsoniter.ConfigDefault, `"2023-04-01T00:00:00Z"`)
+	ReadTime(itr, "2006-01-02")
+}
+
+func TestReadUUID(t *testing.T) {
+	want := uuid.Must(uuid.FromString("6ba7b810-9dad-11d1-80b4-00c04fd430c8"))
+	for _, value := range []string{"6ba7b810-9dad-11d1-80b4-00c04fd430c8", "6BA7B810-9DAD-11D1-80B4-00C04FD430C8"} {
+		itr := jsoniter.ParseString(jsoniter.ConfigDefault, `"`+value+`"`)
+		if got := ReadUUID(itr); got != want {
+			t.Errorf("%q: got %v, want %v", value, got, want)
+		}
+	}
+}
+
+func TestReadUUID_NonCanonical(t *testing.T) {
+	// These were accepted by uuid.FromString before config UUIDs were limited to the canonical
+	// form, and are now rejected the same way the config schema rejects them
+	for _, value := range []string{
+		"{6ba7b810-9dad-11d1-80b4-00c04fd430c8}",
+		"urn:uuid:6ba7b810-9dad-11d1-80b4-00c04fd430c8",
+		"6ba7b8109dad11d180b400c04fd430c8",
+	} {
+		t.Run(value, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Fatalf("expected a panic for the non-canonical UUID %q", value)
+				}
+			}()
+
+			itr := jsoniter.ParseString(jsoniter.ConfigDefault, `"`+value+`"`)
+			ReadUUID(itr)
+		})
+	}
+}